@@ -0,0 +1,95 @@
+package dvactor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+)
+
+// 注册握手认证（ClusterConfig.AuthKeys 非空时开启）：
+//
+//	client → server: PkgRegisterSystemReq{SystemId, ClientNonce, hello}
+//	server → client: PkgRegisterChallenge{ServerNonce}
+//	client → server: PkgRegisterAuth{Mac = HMAC(key, client|clientId|serverId|ClientNonce|ServerNonce|clientHello)}
+//	server → client: PkgRegisterSystemRsp{Success, hello, Mac = HMAC(key, server|serverId|clientId|ServerNonce|ClientNonce|serverHello)}
+//
+// hello 为各自注册包里声明的版本区间与能力位，计入 MAC 后明文链路上的中间人无法降级版本或剥掉能力位。
+// 双方各自用 AuthKeys[0] 签名，用 AuthKeys 中任意一个校验，因此轮换期间两把密钥可以共存。
+const (
+	authNonceSize  = 32
+	authRoleClient = "dvactor-register-client"
+	authRoleServer = "dvactor-register-server"
+)
+
+func newAuthNonce() []byte {
+	nonce := make([]byte, authNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return nonce
+}
+
+// authHello 一方在注册包里声明的版本区间与能力位，按线上收到的原值计入 MAC。
+type authHello struct {
+	version      uint32
+	minVersion   uint32
+	capabilities uint64
+}
+
+// localAuthHello 本节点注册包里声明的值，须与 PkgRegisterSystemReq/Rsp 中发出的一致。
+func (cn *clusterNet) localAuthHello() authHello {
+	return authHello{version: ProtocolVersion, minVersion: MinProtocolVersion, capabilities: uint64(cn.localCapabilities())}
+}
+
+func authMac(key []byte, role string, fromId, toId vactor.SystemId, fromNonce, toNonce []byte, hello authHello) []byte {
+	var ids [8]byte
+	binary.BigEndian.PutUint32(ids[:4], uint32(fromId))
+	binary.BigEndian.PutUint32(ids[4:], uint32(toId))
+	var params [16]byte
+	binary.BigEndian.PutUint32(params[:4], hello.version)
+	binary.BigEndian.PutUint32(params[4:8], hello.minVersion)
+	binary.BigEndian.PutUint64(params[8:], hello.capabilities)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(role))
+	mac.Write(ids[:])
+	mac.Write(fromNonce)
+	mac.Write(toNonce)
+	mac.Write(params[:])
+	return mac.Sum(nil)
+}
+
+func (cn *clusterNet) authEnabled() bool {
+	return len(cn.clusterConfig.AuthKeys) > 0
+}
+
+// signAuth 用当前密钥（AuthKeys[0]）签名。
+func (cn *clusterNet) signAuth(role string, fromId, toId vactor.SystemId, fromNonce, toNonce []byte, hello authHello) []byte {
+	return authMac(cn.clusterConfig.AuthKeys[0], role, fromId, toId, fromNonce, toNonce, hello)
+}
+
+// verifyAuth 任意一个密钥校验通过即可。
+func (cn *clusterNet) verifyAuth(mac []byte, role string, fromId, toId vactor.SystemId, fromNonce, toNonce []byte, hello authHello) bool {
+	for _, key := range cn.clusterConfig.AuthKeys {
+		if hmac.Equal(mac, authMac(key, role, fromId, toId, fromNonce, toNonce, hello)) {
+			return true
+		}
+	}
+	return false
+}
+
+// registerAuthState 是 server 侧等待 PkgRegisterAuth 的会话状态，认证通过前绑定在 session 上。
+type registerAuthState struct {
+	info         *systemInfo
+	clientNonce  []byte
+	serverNonce  []byte
+	clientHello  authHello
+	stripe       uint32
+	stripes      uint32
+	version      uint32
+	capabilities Capability
+	messageTypes []*protocol.MessageTypeEntry
+}
@@ -0,0 +1,187 @@
+package dvactor
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	netClient "github.com/kofplayer/dvactor/engine/net/client"
+	memNetConnect "github.com/kofplayer/dvactor/engine/net/connect/mem"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// 轮换期间两节点密钥顺序不同（签名密钥不同）也能互连
+func TestRegisterAuthKeyRotation(t *testing.T) {
+	oldKey, newKey := []byte("old-cluster-secret"), []byte("new-cluster-secret")
+	systems := newInprocCluster(t, 2, nil, func(c *ClusterConfig) {
+		if c.LocalSystemId == 1 {
+			c.AuthKeys = [][]byte{oldKey, newKey}
+		} else {
+			c.AuthKeys = [][]byte{newKey, oldKey}
+		}
+	}, nil)
+	for _, s := range systems {
+		if n := atomic.LoadInt32(&s.(*system).clusterNet.connectedSystemCount); n != 2 {
+			t.Fatalf("system should be fully connected, got %v", n)
+		}
+	}
+}
+
+// waitInprocListen 等待 inproc 地址开始监听（server 在后台 goroutine 中 Start）
+func waitInprocListen(t *testing.T, address string) {
+	for i := 0; i < 100; i++ {
+		conn := memNetConnect.NewConnector()
+		conn.SetAddress(address)
+		conn.SetOnConnect(func() {})
+		if conn.Connect() == nil {
+			conn.Disconnect()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("inproc %v not listening", address)
+}
+
+type testRawClient struct {
+	cli          netClient.NetClient
+	msgs         chan *testRawMsg
+	disconnected chan struct{}
+}
+
+type testRawMsg struct {
+	msgId uint32
+	data  []byte
+}
+
+func newTestRawClient(t *testing.T, address string) *testRawClient {
+	rc := &testRawClient{
+		msgs:         make(chan *testRawMsg, 8),
+		disconnected: make(chan struct{}),
+	}
+	conn := memNetConnect.NewConnector()
+	conn.SetAddress(address)
+	rc.cli = netClient.NewNetClient()
+	rc.cli.SetConnector(conn)
+	rc.cli.SetOnDisconnect(func() { close(rc.disconnected) })
+	rc.cli.SetOnMessage(func(msgId uint32, data []byte) error {
+		rc.msgs <- &testRawMsg{msgId: msgId, data: append([]byte(nil), data...)}
+		return nil
+	})
+	if err := rc.cli.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return rc
+}
+
+func (rc *testRawClient) send(t *testing.T, pkgType protocol.PkgType, pkg proto.Message) {
+	data, _ := proto.Marshal(pkg)
+	if err := rc.cli.SendMessage(uint32(pkgType), data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (rc *testRawClient) recv(t *testing.T, pkgType protocol.PkgType, pkg proto.Message) {
+	select {
+	case msg := <-rc.msgs:
+		if msg.msgId != uint32(pkgType) {
+			t.Fatalf("expect pkg %v, got %v", pkgType, msg.msgId)
+		}
+		if err := proto.Unmarshal(msg.data, pkg); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("wait pkg %v timeout", pkgType)
+	}
+}
+
+func (rc *testRawClient) waitDisconnect(t *testing.T) {
+	select {
+	case <-rc.disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("server should close the session")
+	}
+}
+
+func TestRegisterAuthHandshake(t *testing.T) {
+	key := []byte("cluster-secret")
+	address := t.Name()
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{
+			{SystemId: 1, Address: "inproc://" + address},
+			{SystemId: 2, Address: "inproc://" + t.Name() + "/2"},
+		},
+		AuthKeys: [][]byte{key},
+	}).(*system)
+	cn := s.clusterNet
+	cn.server = NewServer(cn)
+	cn.server.Start()
+	defer cn.server.svr.Stop()
+	waitInprocListen(t, address)
+
+	// 未注册直接发信封：会话被关闭
+	rc := newTestRawClient(t, address)
+	rc.send(t, protocol.PkgType_PkgTypeEnvelopeSend, &protocol.PkgEnvelopeSend{})
+	rc.waitDisconnect(t)
+
+	// 密钥错误：收到认证失败并断开
+	rc = newTestRawClient(t, address)
+	clientNonce := newAuthNonce()
+	rc.send(t, protocol.PkgType_PkgTypeRegisterSystemReq, &protocol.PkgRegisterSystemReq{SystemId: 2, ClientNonce: clientNonce})
+	challenge := &protocol.PkgRegisterChallenge{}
+	rc.recv(t, protocol.PkgType_PkgTypeRegisterChallenge, challenge)
+	rc.send(t, protocol.PkgType_PkgTypeRegisterAuth, &protocol.PkgRegisterAuth{
+		Mac: authMac([]byte("wrong-secret"), authRoleClient, 2, 1, clientNonce, challenge.ServerNonce, authHello{}),
+	})
+	rsp := &protocol.PkgRegisterSystemRsp{}
+	rc.recv(t, protocol.PkgType_PkgTypeRegisterSystemRsp, rsp)
+	if vactor.ErrorCode(rsp.ErrorCode) != ErrorCodeRegisterAuthFail {
+		t.Fatalf("expect auth fail, got %v", rsp.ErrorCode)
+	}
+	rc.waitDisconnect(t)
+
+	// 密钥正确但注册包里的能力位被篡改（与签名时不一致）：认证失败
+	hello := authHello{version: ProtocolVersion, minVersion: MinProtocolVersion, capabilities: uint64(cn.localCapabilities())}
+	rc = newTestRawClient(t, address)
+	clientNonce = newAuthNonce()
+	rc.send(t, protocol.PkgType_PkgTypeRegisterSystemReq, &protocol.PkgRegisterSystemReq{SystemId: 2, ClientNonce: clientNonce,
+		ProtocolVersion: hello.version, MinProtocolVersion: hello.minVersion, Capabilities: 0})
+	challenge = &protocol.PkgRegisterChallenge{}
+	rc.recv(t, protocol.PkgType_PkgTypeRegisterChallenge, challenge)
+	rc.send(t, protocol.PkgType_PkgTypeRegisterAuth, &protocol.PkgRegisterAuth{
+		Mac: authMac(key, authRoleClient, 2, 1, clientNonce, challenge.ServerNonce, hello),
+	})
+	rsp = &protocol.PkgRegisterSystemRsp{}
+	rc.recv(t, protocol.PkgType_PkgTypeRegisterSystemRsp, rsp)
+	if vactor.ErrorCode(rsp.ErrorCode) != ErrorCodeRegisterAuthFail {
+		t.Fatalf("expect auth fail on tampered capabilities, got %v", rsp.ErrorCode)
+	}
+	rc.waitDisconnect(t)
+
+	// 密钥正确：注册成功，且 server 的应答证明可校验
+	rc = newTestRawClient(t, address)
+	defer rc.cli.Disconnect()
+	clientNonce = newAuthNonce()
+	rc.send(t, protocol.PkgType_PkgTypeRegisterSystemReq, &protocol.PkgRegisterSystemReq{SystemId: 2, ClientNonce: clientNonce,
+		ProtocolVersion: hello.version, MinProtocolVersion: hello.minVersion, Capabilities: hello.capabilities})
+	challenge = &protocol.PkgRegisterChallenge{}
+	rc.recv(t, protocol.PkgType_PkgTypeRegisterChallenge, challenge)
+	rc.send(t, protocol.PkgType_PkgTypeRegisterAuth, &protocol.PkgRegisterAuth{
+		Mac: authMac(key, authRoleClient, 2, 1, clientNonce, challenge.ServerNonce, hello),
+	})
+	rsp = &protocol.PkgRegisterSystemRsp{}
+	rc.recv(t, protocol.PkgType_PkgTypeRegisterSystemRsp, rsp)
+	if rsp.ErrorCode != protocol.ErrorCode_ErrorCodeSuccess {
+		t.Fatalf("register should succeed, got %v", rsp.ErrorCode)
+	}
+	serverHello := authHello{version: rsp.ProtocolVersion, minVersion: rsp.MinProtocolVersion, capabilities: rsp.Capabilities}
+	if !cn.verifyAuth(rsp.Mac, authRoleServer, 1, 2, challenge.ServerNonce, clientNonce, serverHello) {
+		t.Fatal("server proof invalid")
+	}
+	serverHello.minVersion++
+	if cn.verifyAuth(rsp.Mac, authRoleServer, 1, 2, challenge.ServerNonce, clientNonce, serverHello) {
+		t.Fatal("server proof should cover the version range")
+	}
+}
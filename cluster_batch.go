@@ -0,0 +1,190 @@
+package dvactor
+
+import (
+	"sync"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// DefaultBatchMaxBytes BatchConfig.MaxBytes 为 0 时单个批次的 data 上限（字节）。
+	DefaultBatchMaxBytes = 32 << 10
+	// DefaultBatchDelay BatchConfig.Delay 为 0 时批次的最长等待时间。
+	DefaultBatchDelay = 200 * time.Microsecond
+)
+
+// BatchConfig 跨信封合批配置。开启后注册时声明 CapabilityEnvelopeBatch，只对双方都开启的链路生效。
+type BatchConfig struct {
+	// MaxBytes: 批次 data 达到该字节数立即发出，不小于它的包不合批；0 使用 DefaultBatchMaxBytes
+	MaxBytes int
+	// Delay: 批次中第一个包最多等待的时间；0 使用 DefaultBatchDelay
+	Delay time.Duration
+}
+
+func (cn *clusterNet) initBatching() {
+	config := cn.clusterConfig.Batching
+	if config == nil {
+		return
+	}
+	cn.batchMaxBytes = config.MaxBytes
+	if cn.batchMaxBytes <= 0 {
+		cn.batchMaxBytes = DefaultBatchMaxBytes
+	}
+	cn.batchDelay = config.Delay
+	if cn.batchDelay <= 0 {
+		cn.batchDelay = DefaultBatchDelay
+	}
+}
+
+// batcher 返回 link 的批处理器；高优先级的包或该链路未协商合批时返回 nil。调用方须持有 info.lock 读锁。
+func (cn *clusterNet) batcher(info *systemInfo, link linkSender, priority netConnect.Priority) *envelopeBatcher {
+	if cn.batchMaxBytes == 0 || priority != netConnect.PriorityNormal || info.capabilities&CapabilityEnvelopeBatch == 0 {
+		return nil
+	}
+	info.batchLock.Lock()
+	defer info.batchLock.Unlock()
+	b, ok := info.batchers[link]
+	if !ok {
+		if info.batchers == nil {
+			info.batchers = make(map[linkSender]*envelopeBatcher)
+		}
+		b = &envelopeBatcher{
+			cn:       cn,
+			systemId: info.config.SystemId,
+			link:     link,
+			maxBytes: cn.batchMaxBytes,
+			delay:    cn.batchDelay,
+		}
+		info.batchers[link] = b
+	}
+	return b
+}
+
+// dropBatcher 在连接断开时丢弃它的批处理器，未发出的批次随连接一起失败，其中的包记为死信。
+func (info *systemInfo) dropBatcher(link linkSender) {
+	info.batchLock.Lock()
+	b, ok := info.batchers[link]
+	delete(info.batchers, link)
+	info.batchLock.Unlock()
+	if ok {
+		b.stop()
+	}
+}
+
+// envelopeBatcher 把同一连接上的普通优先级包合并成 PkgEnvelopeBatch。
+// 自适应：距上一帧已超过 delay（低负载）时直接发送，不增加延迟；否则并入批次，
+// 批次满 maxBytes 或等满 delay 时发出。不合批的包先冲刷批次再发送，连接上的顺序不变。
+// 批次发出失败或随连接丢弃时，其中的包记为出站死信（Send 早已返回成功）。
+type envelopeBatcher struct {
+	cn       *clusterNet
+	systemId vactor.SystemId
+	link     linkSender
+	maxBytes int
+	delay    time.Duration
+	lock     sync.Mutex
+	// 当前批次：按 PkgEnvelopeBatch 的线格式直接追加 Items
+	buf    *netConnect.Buffer
+	items  int
+	timer  *time.Timer
+	last   time.Time
+	closed bool
+}
+
+// batchable 判断 data 长度的包能否合批。
+func (b *envelopeBatcher) batchable(data []byte) bool {
+	return len(data) < b.maxBytes
+}
+
+// add 发送一个可合批的包，buf 的所有权随之转移。
+func (b *envelopeBatcher) add(msgId uint32, buf *netConnect.Buffer) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	if b.closed || b.buf == nil && now.Sub(b.last) >= b.delay {
+		b.last = now
+		return b.link.SendBuffer(msgId, buf)
+	}
+	data := buf.Data()
+	itemSize := protowire.SizeTag(1) + protowire.SizeVarint(uint64(msgId)) + protowire.SizeTag(2) + protowire.SizeBytes(len(data))
+	if b.buf != nil && len(b.buf.Data())+protowire.SizeTag(1)+protowire.SizeBytes(itemSize) > b.maxBytes {
+		if err := b.flushLocked(0); err != nil {
+			netConnect.PutBuffer(buf)
+			return err
+		}
+	}
+	if b.buf == nil {
+		b.buf = netConnect.GetBuffer()
+	}
+	// Items 字段：tag(1) + len + BatchItem{PkgType, Data}
+	b.buf.B = protowire.AppendTag(b.buf.B, 1, protowire.BytesType)
+	b.buf.B = protowire.AppendVarint(b.buf.B, uint64(itemSize))
+	b.buf.B = protowire.AppendTag(b.buf.B, 1, protowire.VarintType)
+	b.buf.B = protowire.AppendVarint(b.buf.B, uint64(msgId))
+	b.buf.B = protowire.AppendTag(b.buf.B, 2, protowire.BytesType)
+	b.buf.B = protowire.AppendBytes(b.buf.B, data)
+	b.items++
+	netConnect.PutBuffer(buf)
+	if len(b.buf.Data()) >= b.maxBytes {
+		// 本包的失败由调用方记录
+		return b.flushLocked(1)
+	}
+	if b.timer == nil && !b.closed {
+		b.timer = time.AfterFunc(b.delay, b.flush)
+	}
+	return nil
+}
+
+// sendDirect 先发出当前批次，再在同一把锁内调用 send，保证不合批的包排在批次之后。
+func (b *envelopeBatcher) sendDirect(send func() error) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := b.flushLocked(0); err != nil {
+		return err
+	}
+	b.last = time.Now()
+	return send()
+}
+
+func (b *envelopeBatcher) flush() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.flushLocked(0)
+}
+
+// flushLocked 发出当前批次。失败时批次缓冲已被回收，除最后 own 个由调用方自行记录的包外，其余按条记为死信。
+func (b *envelopeBatcher) flushLocked(own int) error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.buf == nil {
+		return nil
+	}
+	buf, items := b.buf, b.items
+	b.buf, b.items = nil, 0
+	b.last = time.Now()
+	err := b.link.SendBuffer(uint32(protocol.PkgType_PkgTypeEnvelopeBatch), buf)
+	if err != nil && items > own {
+		b.cn.lostBatchItems(b.systemId, items-own, err)
+	}
+	return err
+}
+
+func (b *envelopeBatcher) stop() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.closed = true
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.buf != nil {
+		b.cn.discardedBatch(b.systemId, b.buf.Data())
+		netConnect.PutBuffer(b.buf)
+		b.buf, b.items = nil, 0
+	}
+}
@@ -0,0 +1,161 @@
+package dvactor
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+type recordedFrame struct {
+	msgId uint32
+	data  string
+}
+
+// recordLink 记录发出的帧，代替真实连接
+type recordLink struct {
+	lock   sync.Mutex
+	frames []recordedFrame
+}
+
+func (l *recordLink) SendBuffer(msgId uint32, buf *netConnect.Buffer) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.frames = append(l.frames, recordedFrame{msgId, string(buf.Data())})
+	netConnect.PutBuffer(buf)
+	return nil
+}
+
+func (l *recordLink) snapshot() []recordedFrame {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]recordedFrame(nil), l.frames...)
+}
+
+func dataBuffer(data string) *netConnect.Buffer {
+	buf := netConnect.GetBuffer()
+	buf.B = append(buf.B, data...)
+	return buf
+}
+
+// 空闲时直接发送；连续的包合成一批，不合批的包排在批次之后
+func TestEnvelopeBatcher(t *testing.T) {
+	link := &recordLink{}
+	b := &envelopeBatcher{link: link, maxBytes: 64, delay: time.Hour}
+	b.add(1, dataBuffer("a"))
+	b.add(2, dataBuffer("b"))
+	b.add(3, dataBuffer("c"))
+	b.sendDirect(func() error { return link.SendBuffer(4, dataBuffer("d")) })
+
+	frames := link.snapshot()
+	if len(frames) != 3 || frames[0] != (recordedFrame{1, "a"}) || frames[2] != (recordedFrame{4, "d"}) {
+		t.Fatalf("unexpected frames %+v", frames)
+	}
+	if frames[1].msgId != uint32(protocol.PkgType_PkgTypeEnvelopeBatch) {
+		t.Fatalf("expect batch frame, got %v", frames[1].msgId)
+	}
+	batch := &protocol.PkgEnvelopeBatch{}
+	if err := proto.Unmarshal([]byte(frames[1].data), batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Items) != 2 || batch.Items[0].PkgType != 2 || string(batch.Items[0].Data) != "b" || batch.Items[1].PkgType != 3 || string(batch.Items[1].Data) != "c" {
+		t.Fatalf("unexpected batch %v", batch)
+	}
+
+	// 超过 maxBytes 立即发出，等满 delay 的批次由定时器发出
+	b = &envelopeBatcher{link: link, maxBytes: 64, delay: 20 * time.Millisecond}
+	link.frames = nil
+	b.add(1, dataBuffer("a"))
+	for i := 0; i < 5; i++ {
+		b.add(2, dataBuffer("0123456789abcdef"))
+	}
+	if n := len(link.snapshot()); n != 3 {
+		t.Fatalf("full batches should flush immediately, got %v frames", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := len(link.snapshot()); n != 4 {
+		t.Fatalf("pending batch should flush after delay, got %v frames", n)
+	}
+}
+
+// failLink 发送总是因队列满失败，与真实连接一样失败时回收缓冲
+type failLink struct{}
+
+func (failLink) SendBuffer(msgId uint32, buf *netConnect.Buffer) error {
+	netConnect.PutBuffer(buf)
+	return netConnect.ErrSendQueueFull
+}
+
+// 批次发出失败、随连接丢弃时，其中的包记为死信
+func TestEnvelopeBatcherDeadLetter(t *testing.T) {
+	queue := make(chan *DeadLetter, 8)
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1}, {SystemId: 2}},
+		DeadLetter:    &DeadLetterConfig{Queue: queue},
+	}).(*system)
+	b := &envelopeBatcher{cn: s.clusterNet, systemId: 2, link: failLink{}, maxBytes: 1024, delay: time.Hour}
+	if err := b.add(1, dataBuffer("a")); err == nil {
+		t.Fatal("direct send should fail")
+	}
+	b.add(2, dataBuffer("b"))
+	b.add(3, dataBuffer("c"))
+	b.flush()
+	if dl := waitDeadLetter(t, queue); dl.Reason != DeadLetterSendQueueFull || dl.SystemId != 2 || dl.Count != 2 {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+
+	pkg, _ := proto.Marshal(&protocol.PkgEnvelopeSend{ToActorRef: &protocol.ActorRef{ActorId: "a"}, Message: &protocol.Message{Type: 1}})
+	b.add(uint32(protocol.PkgType_PkgTypeEnvelopeSend), dataBuffer(string(pkg)))
+	b.stop()
+	dl := waitDeadLetter(t, queue)
+	if dl.Reason != DeadLetterPeerUnavailable || dl.PkgType != protocol.PkgType_PkgTypeEnvelopeSend || string(dl.Data) != string(pkg) || dl.MsgType != 1 || dl.ToActorRefs[0].GetActorId() != "a" {
+		t.Fatalf("discarded batch item should be replayable: %+v", dl)
+	}
+	if stats := s.DeadLetterStats(); stats[DeadLetterSendQueueFull] != 2 || stats[DeadLetterPeerUnavailable] != 1 {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+}
+
+func TestEnvelopeBatchDelivery(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	const count = 500
+	received := make(chan string, count)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+		c.Batching = &BatchConfig{Delay: time.Millisecond}
+	}, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if msg, ok := ctx.GetMessage().(*protocol.ActorRef); ok {
+					received <- msg.ActorId
+				}
+			}
+		})
+	})
+	if !systems[0].(*system).clusterNet.hasCapability(2, CapabilityEnvelopeBatch) {
+		t.Fatal("link should negotiate envelope batch")
+	}
+	ref := systems[0].CreateActorRefEx(2, actorType, "a")
+	want := map[string]bool{}
+	for i := 0; i < count; i++ {
+		id := fmt.Sprint(i)
+		want[id] = true
+		if err := systems[0].Send(ref, &protocol.ActorRef{ActorId: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for len(want) > 0 {
+		select {
+		case id := <-received:
+			delete(want, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing %v messages", len(want))
+		}
+	}
+}
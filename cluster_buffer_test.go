@@ -0,0 +1,133 @@
+package dvactor
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"testing"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// PackBuffer 原地打包与 Pack 的结果逐字节一致
+func TestPackBuffer(t *testing.T) {
+	compressor := netConnect.NewFlateCompressor(flate.BestSpeed)
+	big := bytes.Repeat([]byte("room state "), 200)
+	encoders := []*netConnect.FrameEncoder{
+		nil,
+		{Version: netConnect.FrameVersion1, Compressor: compressor, Threshold: 64},
+		{Version: netConnect.FrameVersion2, CRC: true},
+		{Version: netConnect.FrameVersion2, Compressor: compressor, Threshold: 64, CRC: true},
+	}
+	for i, encoder := range encoders {
+		for _, data := range [][]byte{[]byte("hello"), big} {
+			want, err := encoder.Pack(9, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := netConnect.GetBuffer()
+			buf.B = append(buf.B, data...)
+			if err = encoder.PackBuffer(9, buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("encoder %v len %v: PackBuffer mismatch", i, len(data))
+			}
+			netConnect.PutBuffer(buf)
+		}
+	}
+}
+
+// 零拷贝借用的读缓冲被复用后，残留半包必须已经转存
+func TestPacketSplitterBorrowedData(t *testing.T) {
+	pkt1, _ := netConnect.PackMessage(1, []byte("first"))
+	pkt2, _ := netConnect.PackMessage(2, []byte("second"))
+	stream := append(append([]byte{}, pkt1...), pkt2...)
+	cut := len(pkt1) + 3
+
+	var sp netConnect.PacketSplitter
+	readBuf := make([]byte, len(stream))
+	n := copy(readBuf, stream[:cut])
+	sp.Append(readBuf[:n])
+	frame, ok, err := sp.Next()
+	if err != nil || !ok || string(frame.Payload) != "first" {
+		t.Fatalf("frame1 mismatch: %q ok=%v err=%v", frame.Payload, ok, err)
+	}
+	if _, ok, _ = sp.Next(); ok {
+		t.Fatal("frame2 is partial")
+	}
+	// 模拟 receiver 复用读缓冲
+	n = copy(readBuf, stream[cut:])
+	sp.Append(readBuf[:n])
+	frame, ok, err = sp.Next()
+	if err != nil || !ok || frame.MsgId != 2 || string(frame.Payload) != "second" {
+		t.Fatalf("frame2 mismatch: %q ok=%v err=%v", frame.Payload, ok, err)
+	}
+}
+
+// legacyMarshalAndPack 是池化之前的发送路径：消息体、信封、帧各分配并拷贝一次
+func legacyMarshalAndPack(msgType uint32, msg proto.Message, pkg *protocol.PkgEnvelopeSend) []byte {
+	_data, _ := proto.Marshal(msg)
+	data := make([]byte, 4, 4+len(_data))
+	binary.BigEndian.PutUint32(data[:4], msgType)
+	data = append(data, _data...)
+	pkg.Message = &protocol.Message{Type: msgType, Data: data}
+	pkgData, _ := proto.Marshal(pkg)
+	pkt, _ := netConnect.PackMessage(uint32(protocol.PkgType_PkgTypeEnvelopeSend), pkgData)
+	return pkt
+}
+
+func newBenchSendSystem() (*system, *protocol.ActorRef) {
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}},
+	}).(*system)
+	s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+	return s, &protocol.ActorRef{SystemId: 2, ActorType: 11, ActorId: "player-10086"}
+}
+
+func BenchmarkSendPathLegacy(b *testing.B) {
+	_, msg := newBenchSendSystem()
+	from := &protocol.ActorRef{SystemId: 1, ActorType: 11, ActorId: "room-1"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		legacyMarshalAndPack(1, msg, &protocol.PkgEnvelopeSend{FromActorRef: from, ToActorRef: msg})
+	}
+}
+
+// BenchmarkSendPathPooled 与 clusterNet.Send + PackBuffer 的路径一致
+func BenchmarkSendPathPooled(b *testing.B) {
+	s, msg := newBenchSendSystem()
+	from := &protocol.ActorRef{SystemId: 1, ActorType: 11, ActorId: "room-1"}
+	encoder := &netConnect.FrameEncoder{Version: netConnect.FrameVersion2}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		message, _ := s.MarshalMessage(msg)
+		pkg := &protocol.PkgEnvelopeSend{FromActorRef: from, ToActorRef: msg, Message: message}
+		buf := netConnect.GetBuffer()
+		buf.B, _ = proto.MarshalOptions{}.MarshalAppend(buf.B, pkg)
+		encoder.PackBuffer(uint32(protocol.PkgType_PkgTypeEnvelopeSend), buf)
+		netConnect.PutBuffer(buf)
+	}
+}
+
+// BenchmarkPacketSplitter 每次读到整帧时切分不分配
+func BenchmarkPacketSplitter(b *testing.B) {
+	pkt, _ := netConnect.PackMessage(1, bytes.Repeat([]byte("x"), 200))
+	readBuf := bytes.Repeat(pkt, 8)
+	var sp netConnect.PacketSplitter
+	b.ReportAllocs()
+	b.SetBytes(int64(len(readBuf)))
+	for i := 0; i < b.N; i++ {
+		sp.Append(readBuf)
+		for {
+			_, ok, _ := sp.Next()
+			if !ok {
+				break
+			}
+		}
+	}
+}
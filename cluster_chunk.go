@@ -0,0 +1,177 @@
+package dvactor
+
+import (
+	"fmt"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DefaultChunkSize ChunkConfig.Size 为 0 时的单片大小（字节）。
+	DefaultChunkSize = 64 << 10
+	// DefaultMaxChunkedMessageSize ChunkConfig.MaxMessageSize 为 0 时重组后的最大长度。
+	DefaultMaxChunkedMessageSize = 64 << 20
+	// DefaultMaxPendingChunked ChunkConfig.MaxPending 为 0 时每条连接同时重组的消息数。
+	DefaultMaxPendingChunked = 8
+)
+
+// ChunkConfig 大包分片配置。开启后注册时声明 CapabilityChunking，
+// 只有对端也开启时才对该链路分片发送，否则照旧整包发送。
+type ChunkConfig struct {
+	// Size: 序列化后超过该字节数的包拆成 PkgChunk 逐片发送；0 使用 DefaultChunkSize。应小于对端的 MaxFrameSize
+	Size int
+	// MaxMessageSize: 接收侧重组后的最大长度，超过视为协议错误（server 侧断开连接）；0 使用 DefaultMaxChunkedMessageSize
+	MaxMessageSize int
+	// MaxPending: 每条连接同时重组中的消息数上限，超出时丢弃最早的未完成消息；0 使用 DefaultMaxPendingChunked
+	MaxPending int
+}
+
+func (cn *clusterNet) initChunking() {
+	cn.maxChunkedSize = DefaultMaxChunkedMessageSize
+	cn.maxPendingChunked = DefaultMaxPendingChunked
+	config := cn.clusterConfig.Chunking
+	if config == nil {
+		return
+	}
+	cn.chunkSize = config.Size
+	if cn.chunkSize <= 0 {
+		cn.chunkSize = DefaultChunkSize
+	}
+	if config.MaxMessageSize > 0 {
+		cn.maxChunkedSize = config.MaxMessageSize
+	}
+	if config.MaxPending > 0 {
+		cn.maxPendingChunked = config.MaxPending
+	}
+}
+
+// shouldChunk 判断 data 是否需要分片发送，调用方须持有 info.lock。
+func (cn *clusterNet) shouldChunk(info *systemInfo, data []byte) bool {
+	return cn.chunkSize > 0 && len(data) > cn.chunkSize && info.capabilities&CapabilityChunking != 0
+}
+
+// sendChunks 把 buf 拆成 PkgChunk 逐片发送。每片单独入队，其他信封可以插在片之间写出，
+// 大包不会独占链路；各片沿用 buf 的优先级。buf 的所有权随之转移。
+func (cn *clusterNet) sendChunks(link linkSender, msgId uint32, buf *netConnect.Buffer) error {
+	defer netConnect.PutBuffer(buf)
+	data := buf.Data()
+	count := (len(data) + cn.chunkSize - 1) / cn.chunkSize
+	messageId := cn.chunkSeq.Add(1)
+	for i := 0; i < count; i++ {
+		chunk := &protocol.PkgChunk{
+			MessageId: messageId,
+			Index:     uint32(i),
+			Count:     uint32(count),
+			PkgType:   msgId,
+			Size:      uint64(len(data)),
+			Data:      data[i*cn.chunkSize : min((i+1)*cn.chunkSize, len(data))],
+		}
+		cb := netConnect.GetBuffer()
+		cb.Priority = buf.Priority
+		var err error
+		cb.B, err = proto.MarshalOptions{}.MarshalAppend(cb.B, chunk)
+		if err != nil {
+			netConnect.PutBuffer(cb)
+			return err
+		}
+		// 中途失败时已发出的片留在对端，由 MaxPending 淘汰
+		if err := link.SendBuffer(uint32(protocol.PkgType_PkgTypeChunk), cb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partialMessage 重组中的消息
+type partialMessage struct {
+	pkgType uint32
+	count   uint32
+	next    uint32
+	size    uint64
+	data    []byte
+}
+
+// chunkAssembler 重组一条连接上收到的 PkgChunk。同一消息的片在同一连接上按序到达，
+// 只在该连接的接收 goroutine 中使用，无需加锁。
+type chunkAssembler struct {
+	cn        *clusterNet
+	pending   map[uint64]*partialMessage
+	onMessage func(msgId uint32, data []byte) error
+}
+
+func newChunkAssembler(cn *clusterNet, systemId vactor.SystemId) *chunkAssembler {
+	return &chunkAssembler{
+		cn:      cn,
+		pending: make(map[uint64]*partialMessage),
+		onMessage: func(msgId uint32, data []byte) error {
+			return cn.OnMessage(systemId, msgId, data)
+		},
+	}
+}
+
+// onChunk 处理一片，消息收齐后交给 clusterNet.OnMessage。长度或片数不合法返回错误（server 侧断开连接）；
+// 发送队列丢片造成的缺片只丢弃该消息。
+func (a *chunkAssembler) onChunk(data []byte) error {
+	chunk := &protocol.PkgChunk{}
+	if err := proto.Unmarshal(data, chunk); err != nil {
+		return err
+	}
+	p, ok := a.pending[chunk.MessageId]
+	if !ok {
+		if chunk.Index != 0 {
+			a.cn.localSystem.LogError("chunked message %v missing head, drop chunk %v/%v", chunk.MessageId, chunk.Index, chunk.Count)
+			return nil
+		}
+		if chunk.Count == 0 || protocol.PkgType(chunk.PkgType) == protocol.PkgType_PkgTypeChunk {
+			return fmt.Errorf("invalid chunked message %v: count %v pkg %v", chunk.MessageId, chunk.Count, chunk.PkgType)
+		}
+		if chunk.Size > uint64(a.cn.maxChunkedSize) {
+			return fmt.Errorf("chunked message %v size %v exceeds %v", chunk.MessageId, chunk.Size, a.cn.maxChunkedSize)
+		}
+		if len(a.pending) >= a.cn.maxPendingChunked {
+			a.evictOldest()
+		}
+		p = &partialMessage{
+			pkgType: chunk.PkgType,
+			count:   chunk.Count,
+			size:    chunk.Size,
+		}
+		a.pending[chunk.MessageId] = p
+	}
+	if chunk.Index != p.next || chunk.Count != p.count {
+		delete(a.pending, chunk.MessageId)
+		a.cn.localSystem.LogError("chunked message %v expect chunk %v/%v, got %v/%v, drop", chunk.MessageId, p.next, p.count, chunk.Index, chunk.Count)
+		return nil
+	}
+	if uint64(len(p.data)+len(chunk.Data)) > p.size {
+		delete(a.pending, chunk.MessageId)
+		return fmt.Errorf("chunked message %v exceeds declared size %v", chunk.MessageId, p.size)
+	}
+	p.data = append(p.data, chunk.Data...)
+	p.next++
+	if p.next < p.count {
+		return nil
+	}
+	delete(a.pending, chunk.MessageId)
+	if uint64(len(p.data)) != p.size {
+		return fmt.Errorf("chunked message %v size %v, declared %v", chunk.MessageId, len(p.data), p.size)
+	}
+	return a.onMessage(p.pkgType, p.data)
+}
+
+// evictOldest 丢弃最早开始的未完成消息（MessageId 在发送侧单调递增）。
+func (a *chunkAssembler) evictOldest() {
+	var oldest uint64
+	first := true
+	for id := range a.pending {
+		if first || id < oldest {
+			oldest = id
+			first = false
+		}
+	}
+	delete(a.pending, oldest)
+	a.cn.localSystem.LogError("too many chunked messages pending, drop %v", oldest)
+}
@@ -0,0 +1,110 @@
+package dvactor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// 超过 MaxFrameSize 的消息分片后照常送达，小消息不受影响
+func TestChunkedMessageDelivery(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	received := make(chan string, 8)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+		c.MaxFrameSize = 4096
+		c.Chunking = &ChunkConfig{Size: 1024}
+	}, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if msg, ok := ctx.GetMessage().(*protocol.ActorRef); ok {
+					received <- msg.ActorId
+				}
+			}
+		})
+	})
+	if !systems[0].(*system).clusterNet.hasCapability(2, CapabilityChunking) {
+		t.Fatal("link should negotiate chunking")
+	}
+
+	big := strings.Repeat("snapshot", 20000)
+	systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "a"), &protocol.ActorRef{ActorId: big})
+	systems[1].Send(systems[1].CreateActorRefEx(1, actorType, "a"), &protocol.ActorRef{ActorId: big})
+	systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "b"), &protocol.ActorRef{ActorId: "small"})
+	got := map[string]int{}
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-received:
+			got[msg]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery timeout, got %v messages", i)
+		}
+	}
+	if got[big] != 2 || got["small"] != 1 {
+		t.Fatalf("unexpected delivery: big %v small %v", got[big], got["small"])
+	}
+}
+
+func marshalChunk(t *testing.T, chunk *protocol.PkgChunk) []byte {
+	data, err := proto.Marshal(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestChunkAssembler(t *testing.T) {
+	cn := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1}},
+	}).(*system).clusterNet
+	cn.initChunking()
+	cn.maxPendingChunked = 2
+	cn.maxChunkedSize = 64
+	var delivered [][]byte
+	a := newChunkAssembler(cn, 2)
+	a.onMessage = func(msgId uint32, data []byte) error {
+		delivered = append(delivered, data)
+		return nil
+	}
+	chunk := func(id uint64, index, count uint32, data string) []byte {
+		return marshalChunk(t, &protocol.PkgChunk{MessageId: id, Index: index, Count: count, PkgType: 1, Size: 6, Data: []byte(data)})
+	}
+
+	// 两条消息的片交错到达，各自重组
+	for _, data := range [][]byte{chunk(1, 0, 2, "abc"), chunk(2, 0, 2, "xyz"), chunk(2, 1, 2, "uvw"), chunk(1, 1, 2, "def")} {
+		if err := a.onChunk(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(delivered) != 2 || !bytes.Equal(delivered[0], []byte("xyzuvw")) || !bytes.Equal(delivered[1], []byte("abcdef")) {
+		t.Fatalf("unexpected delivery %q", delivered)
+	}
+
+	// 缺片的消息被丢弃
+	delivered = nil
+	a.onChunk(chunk(3, 0, 3, "ab"))
+	a.onChunk(chunk(3, 2, 3, "ef"))
+	if len(delivered) != 0 || len(a.pending) != 0 {
+		t.Fatalf("message with missing chunk should be dropped, pending %v", len(a.pending))
+	}
+
+	// 超过 MaxPending 时淘汰最早的消息
+	a.onChunk(chunk(4, 0, 2, "abc"))
+	a.onChunk(chunk(5, 0, 2, "abc"))
+	a.onChunk(chunk(6, 0, 2, "abc"))
+	if _, ok := a.pending[4]; ok || len(a.pending) != 2 {
+		t.Fatalf("oldest message should be evicted, pending %v", len(a.pending))
+	}
+
+	// 声明长度超过 MaxMessageSize 直接报错
+	err := a.onChunk(marshalChunk(t, &protocol.PkgChunk{MessageId: 7, Count: 2, PkgType: 1, Size: 65, Data: []byte("a")}))
+	if err == nil {
+		t.Fatal("oversized chunked message should fail")
+	}
+}
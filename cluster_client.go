@@ -5,7 +5,6 @@ import (
 	"time"
 
 	netClient "github.com/kofplayer/dvactor/engine/net/client"
-	socketNetConnect "github.com/kofplayer/dvactor/engine/net/connect/socket"
 	"github.com/kofplayer/dvactor/protocol"
 	"github.com/kofplayer/vactor"
 	"google.golang.org/protobuf/proto"
@@ -26,6 +25,16 @@ type clusterClient struct {
 	cn                   *clusterNet
 	disconnectChan       chan bool
 	registerResponseChan chan bool
+	// 当前连接的注册状态：认证随机数，以及是否已完成注册（之前收到的信封一律丢弃）
+	clientNonce  []byte
+	serverNonce  []byte
+	version      uint32
+	capabilities Capability
+	registered   atomic.Bool
+	// 连接序号：0 为主连接，>0 为 ConnectionsPerPeer 打开的附加连接
+	stripe int
+	// 当前连接的分片重组状态，每次连接重建
+	chunks *chunkAssembler
 }
 
 func (c *clusterClient) Start() {
@@ -36,24 +45,47 @@ func (c *clusterClient) Start() {
 			case <-c.disconnectChan:
 			default:
 			}
-			conn := socketNetConnect.NewConnector()
-			conn.SetAddress(info.config.Host, info.config.Port)
+			if c.stripe > 0 && !c.cn.hasCapability(c.systemId, CapabilityMultiConn) {
+				// 附加连接等主连接就绪且对端支持多连接后再连
+				time.Sleep(time.Second)
+				continue
+			}
 			cli := netClient.NewNetClient()
-			cli.SetConnector(conn)
+			connector := c.cn.newConnector(info.config)
+			c.cn.applySendLimit(connector, info.config)
+			cli.SetConnector(connector)
+			cli.SetCompressor(c.cn.compressor)
+			cli.SetMaxFrameSize(c.cn.clusterConfig.MaxFrameSize)
+			cli.SetOnFrameRejected(c.cn.onFrameRejected)
 			cli.SetOnConnect(c.OnConnect)
 			cli.SetOnDisconnect(c.OnDisconnect)
 			cli.SetOnMessage(c.OnMessage)
 			c.cli = cli
+			c.chunks = newChunkAssembler(c.cn, c.systemId)
 			if err := c.cli.Connect(); err != nil {
 				c.cn.localSystem.LogError("system %v connect err:%v, wait for retry", info.config.SystemId, err)
 				time.Sleep(time.Second * 5)
 				continue
 			}
+			c.registered.Store(false)
+			c.clientNonce = nil
+			c.serverNonce = nil
+			if c.cn.authEnabled() {
+				c.clientNonce = newAuthNonce()
+			}
 			req := &protocol.PkgRegisterSystemReq{
-				SystemId: uint32(c.cn.clusterConfig.LocalSystemId),
+				SystemId:           uint32(c.cn.clusterConfig.LocalSystemId),
+				ClientNonce:        c.clientNonce,
+				ProtocolVersion:    ProtocolVersion,
+				MinProtocolVersion: MinProtocolVersion,
+				Capabilities:       uint64(c.cn.localCapabilities()),
+				Stripe:             uint32(c.stripe),
+				Stripes:            uint32(c.cn.connectionsPerPeer()),
 			}
-			data, _ := proto.Marshal(req)
-			if err := c.cli.SendMessage(uint32(protocol.PkgType_PkgTypeRegisterSystemReq), data); err != nil {
+			if c.stripe == 0 {
+				req.MessageTypes = c.cn.localSystem.messageTypeEntries()
+			}
+			if err := sendControl(c.cli, protocol.PkgType_PkgTypeRegisterSystemReq, req); err != nil {
 				c.cli.Disconnect()
 				time.Sleep(time.Second * 5)
 				continue
@@ -70,27 +102,56 @@ func (c *clusterClient) Start() {
 				}
 			}
 
+			c.cli.SetFrameEncoder(c.cn.linkFrameEncoder(c.capabilities))
+			if c.stripe > 0 {
+				c.runStripe(info)
+				time.Sleep(time.Second * 5)
+				continue
+			}
 			info.lock.Lock()
 			info.cli = c.cli
+			info.version = c.version
+			info.capabilities = c.capabilities
 			info.lock.Unlock()
 
 			// ready
 			atomic.AddInt32(&c.cn.connectedSystemCount, 1)
-			c.cn.localSystem.LogInfo("system %v connected", info.config.SystemId)
+			c.cn.localSystem.LogInfo("system %v connected, protocol version %v, capabilities %#x", info.config.SystemId, c.version, c.capabilities)
 			<-c.disconnectChan
 
 			c.cn.localSystem.LogInfo("system %v disconnected", info.config.SystemId)
 			info.lock.Lock()
 			info.cli = nil
+			info.dropBatcher(c.cli)
+			info.version = 0
+			info.capabilities = 0
 			c.cli = nil
 			info.lock.Unlock()
 
 			atomic.AddInt32(&c.cn.connectedSystemCount, -1)
+			c.cn.localSystem.streams.peerLost(info.config.SystemId)
+			c.cn.localSystem.requests.peerLost(info.config.SystemId)
 			time.Sleep(time.Second * 5)
 		}
 	}()
 }
 
+// runStripe 登记已注册的附加连接并阻塞到断线；附加连接不计入 connectedSystemCount。
+func (c *clusterClient) runStripe(info *systemInfo) {
+	info.lock.Lock()
+	info.stripeClis[c.stripe] = c.cli
+	info.lock.Unlock()
+	c.cn.localSystem.LogInfo("system %v stripe %v connected", info.config.SystemId, c.stripe)
+	<-c.disconnectChan
+
+	c.cn.localSystem.LogInfo("system %v stripe %v disconnected", info.config.SystemId, c.stripe)
+	info.lock.Lock()
+	info.stripeClis[c.stripe] = nil
+	info.dropBatcher(c.cli)
+	c.cli = nil
+	info.lock.Unlock()
+}
+
 func (c *clusterClient) OnConnect() {
 }
 
@@ -100,15 +161,58 @@ func (c *clusterClient) OnDisconnect() {
 
 func (c *clusterClient) OnMessage(msgId uint32, data []byte) error {
 	switch protocol.PkgType(msgId) {
+	case protocol.PkgType_PkgTypeRegisterChallenge:
+		challenge := &protocol.PkgRegisterChallenge{}
+		if proto.Unmarshal(data, challenge) != nil || !c.cn.authEnabled() || len(challenge.ServerNonce) != authNonceSize {
+			c.cn.localSystem.LogError("system %v register challenge can not be answered", c.systemId)
+			c.registerResponseChan <- false
+			return nil
+		}
+		c.serverNonce = challenge.ServerNonce
+		auth := &protocol.PkgRegisterAuth{
+			Mac: c.cn.signAuth(authRoleClient, c.cn.clusterConfig.LocalSystemId, c.systemId, c.clientNonce, c.serverNonce, c.cn.localAuthHello()),
+		}
+		return sendControl(c.cli, protocol.PkgType_PkgTypeRegisterAuth, auth)
 	case protocol.PkgType_PkgTypeRegisterSystemRsp:
 		rsp := &protocol.PkgRegisterSystemRsp{}
-		if proto.Unmarshal(data, rsp) == nil && rsp.ErrorCode == protocol.ErrorCode_ErrorCodeSuccess {
-			c.registerResponseChan <- true
-		} else {
-			c.registerResponseChan <- false
+		succ := proto.Unmarshal(data, rsp) == nil && rsp.ErrorCode == protocol.ErrorCode_ErrorCodeSuccess
+		// 开启认证时 server 也必须证明持有密钥
+		if succ && c.cn.authEnabled() && !c.cn.verifyAuth(rsp.Mac, authRoleServer, c.systemId, c.cn.clusterConfig.LocalSystemId, c.serverNonce, c.clientNonce, authHello{version: rsp.ProtocolVersion, minVersion: rsp.MinProtocolVersion, capabilities: rsp.Capabilities}) {
+			c.cn.localSystem.LogError("system %v register response auth fail", c.systemId)
+			succ = false
+		}
+		if succ {
+			version, err := negotiateVersion(rsp.ProtocolVersion, rsp.MinProtocolVersion)
+			if err != nil {
+				c.cn.localSystem.LogError("system %v %v", c.systemId, err)
+				succ = false
+			}
+			c.version = version
+			c.capabilities = c.cn.localCapabilities() & Capability(rsp.Capabilities)
+			if c.stripe == 0 {
+				if err := c.cn.localSystem.checkMessageTypes(c.systemId, rsp.MessageTypes); err != nil {
+					c.cn.localSystem.LogError("system %v %v", c.systemId, err)
+					succ = false
+				}
+			}
+		} else if rsp.ErrorCode != protocol.ErrorCode_ErrorCodeSuccess {
+			c.cn.localSystem.LogError("system %v register fail: %v", c.systemId, vactor.ErrorCode(rsp.ErrorCode))
 		}
+		c.registered.Store(succ)
+		c.registerResponseChan <- succ
 		return nil
 	default:
-		return c.cn.OnMessage(msgId, data)
+		if !c.registered.Load() {
+			c.cn.localSystem.LogError("system %v not registered, drop pkg %v", c.systemId, msgId)
+			return nil
+		}
+		if protocol.PkgType(msgId) == protocol.PkgType_PkgTypeChunk {
+			if err := c.chunks.onChunk(data); err != nil {
+				c.cn.localSystem.LogError("system %v chunk error: %v", c.systemId, err)
+				return err
+			}
+			return nil
+		}
+		return c.cn.OnMessage(c.systemId, msgId, data)
 	}
 }
@@ -0,0 +1,34 @@
+package dvactor
+
+import (
+	"compress/flate"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+)
+
+// DefaultCompressThreshold CompressionConfig.Threshold 为 0 时的压缩阈值（字节）。
+const DefaultCompressThreshold = 1024
+
+// CompressionConfig 帧压缩配置。开启后注册时声明 CapabilityCompression，
+// 只有对端也开启时才对该链路压缩发送，未开启的旧节点不受影响。
+type CompressionConfig struct {
+	// Threshold: 帧 payload 不小于该字节数才压缩；0 使用 DefaultCompressThreshold
+	Threshold int
+	// Compressor: 压缩算法，所有开启压缩的节点须一致；nil 使用 flate（DefaultCompression 级别）
+	Compressor netConnect.Compressor
+}
+
+func (cn *clusterNet) initCompression() {
+	config := cn.clusterConfig.Compression
+	if config == nil {
+		return
+	}
+	cn.compressor = config.Compressor
+	if cn.compressor == nil {
+		cn.compressor = netConnect.NewFlateCompressor(flate.DefaultCompression)
+	}
+	cn.compressThreshold = config.Threshold
+	if cn.compressThreshold <= 0 {
+		cn.compressThreshold = DefaultCompressThreshold
+	}
+}
@@ -0,0 +1,118 @@
+package dvactor
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPackMessageCompressed(t *testing.T) {
+	compressor := netConnect.NewFlateCompressor(flate.BestSpeed)
+	encoder := &netConnect.FrameEncoder{Version: netConnect.FrameVersion1, Compressor: compressor, Threshold: 1024}
+	big := bytes.Repeat([]byte("room state "), 200)
+
+	// 低于阈值不压缩
+	pkt, err := encoder.Pack(3, []byte("small"))
+	if err != nil || pkt[4] != 3 {
+		t.Fatalf("small frame should not be compressed: %v %v", pkt[4], err)
+	}
+	pkt, err = encoder.Pack(3, big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt[4] == 3 || len(pkt) >= len(big) {
+		t.Fatalf("big frame should be compressed, id byte %#x len %v", pkt[4], len(pkt))
+	}
+
+	var sp netConnect.PacketSplitter
+	sp.Append(pkt)
+	frame, ok, err := sp.Next()
+	if err != nil || !ok || frame.Flags&netConnect.FrameFlagCompressed == 0 {
+		t.Fatalf("compressed frame expected: %+v ok=%v err=%v", frame.Flags, ok, err)
+	}
+	payload, err := netConnect.UnpackFrame(frame, compressor, netConnect.DefaultMaxFrameSize)
+	if err != nil || frame.MsgId != 3 || !bytes.Equal(payload, big) {
+		t.Fatalf("unpack mismatch: id=%v len=%v err=%v", frame.MsgId, len(payload), err)
+	}
+	// 未配置解压算法时压缩帧必须报错
+	if _, err = netConnect.UnpackFrame(frame, nil, netConnect.DefaultMaxFrameSize); err == nil {
+		t.Fatal("compressed frame without compressor should fail")
+	}
+}
+
+// 解压结果同样受最大帧长限制：很小的压缩帧膨胀超限时报 FrameTooLargeError
+func TestDecompressLimit(t *testing.T) {
+	compressor := netConnect.NewFlateCompressor(flate.BestCompression)
+	encoder := &netConnect.FrameEncoder{Version: netConnect.FrameVersion1, Compressor: compressor, Threshold: 64}
+	bomb := make([]byte, 1<<20)
+	pkt, err := encoder.Pack(3, bomb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sp netConnect.PacketSplitter
+	sp.SetMaxFrameSize(64 << 10)
+	sp.Append(pkt)
+	frame, ok, err := sp.Next()
+	if err != nil || !ok {
+		t.Fatalf("compressed frame %v bytes should pass the splitter: ok=%v err=%v", len(frame.Payload), ok, err)
+	}
+	_, err = netConnect.UnpackFrame(frame, compressor, sp.MaxFrameSize())
+	var tooLarge *netConnect.FrameTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Max != 64<<10 {
+		t.Fatalf("expect FrameTooLargeError, got %v", err)
+	}
+	// 恰好等于上限的仍可解压
+	payload, err := compressor.Decompress(frame.Payload, len(bomb))
+	if err != nil || len(payload) != len(bomb) {
+		t.Fatalf("decompress at limit: len=%v err=%v", len(payload), err)
+	}
+}
+
+// 只有双方都开启压缩时链路才协商 CapabilityCompression；开启的链路能收发大帧
+func TestCompressionNegotiatedPerLink(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	received := make(chan string, 4)
+	systems := newInprocCluster(t, 3, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+		if c.LocalSystemId != 3 {
+			c.Compression = &CompressionConfig{Threshold: 64}
+		}
+	}, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if msg, ok := ctx.GetMessage().(*protocol.ActorRef); ok {
+					received <- msg.ActorId
+				}
+			}
+		})
+	})
+	cn1 := systems[0].(*system).clusterNet
+	if !cn1.hasCapability(2, CapabilityCompression) {
+		t.Fatal("link 1-2 should negotiate compression")
+	}
+	if cn1.hasCapability(3, CapabilityCompression) {
+		t.Fatal("link 1-3 should not negotiate compression")
+	}
+
+	big := strings.Repeat("state", 1000)
+	systems[1].Send(systems[1].CreateActorRefEx(1, actorType, "a"), &protocol.ActorRef{ActorId: big})
+	systems[0].Send(systems[0].CreateActorRefEx(3, actorType, "a"), &protocol.ActorRef{ActorId: big})
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			if msg != big {
+				t.Fatalf("payload mismatch, len %v", len(msg))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("delivery timeout")
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package dvactor
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	socketNetConnect "github.com/kofplayer/dvactor/engine/net/connect/socket"
+)
+
+// startLoopback 建立一条明文 TCP 回环连接，onFrame 在接收端逐帧回调，返回发送端。
+func startLoopback(tb testing.TB, policy netConnect.FlushPolicy, onFrame func(frame netConnect.Frame)) *socketNetConnect.ConnectorSocket {
+	port := freeTestPort(tb)
+	acceptor := socketNetConnect.NewAcceptor()
+	acceptor.SetAddress("127.0.0.1", port)
+	acceptor.SetOnAccept(func(conn netConnect.Conn) {
+		var splitter netConnect.PacketSplitter
+		conn.SetOnDisconnect(func() {})
+		conn.SetOnData(func(data []byte) error {
+			splitter.Append(data)
+			for {
+				frame, ok, err := splitter.Next()
+				if err != nil || !ok {
+					return err
+				}
+				onFrame(frame)
+			}
+		})
+	})
+	go acceptor.Start()
+	tb.Cleanup(func() { acceptor.Stop() })
+
+	conn := socketNetConnect.NewConnector()
+	conn.SetAddress("127.0.0.1", port)
+	conn.SetFlushPolicy(policy)
+	conn.SetOnConnect(func() {})
+	conn.SetOnDisconnect(func() {})
+	conn.SetOnData(func([]byte) error { return nil })
+	for i := 0; ; i++ {
+		err := conn.Connect()
+		if err == nil {
+			break
+		}
+		if i == 100 {
+			tb.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tb.Cleanup(func() { conn.Disconnect() })
+	return conn
+}
+
+// 各种合并策略下帧按序完整到达，池化缓冲与普通字节切片可以混发
+func TestFlushPolicyOrdering(t *testing.T) {
+	policies := []netConnect.FlushPolicy{
+		{},
+		{MaxBatchBytes: 1},
+		{MaxBatchBytes: 100},
+		{Delay: time.Millisecond},
+		{MaxBatchBytes: 300, Delay: time.Millisecond},
+	}
+	const count = 500
+	for _, policy := range policies {
+		received := make(chan uint32, count)
+		conn := startLoopback(t, policy, func(frame netConnect.Frame) {
+			if !bytes.Equal(frame.Payload, bytes.Repeat([]byte{byte(frame.MsgId)}, int(frame.MsgId))) {
+				t.Errorf("payload mismatch for msgId %v", frame.MsgId)
+			}
+			received <- frame.MsgId
+		})
+		for i := 0; i < count; i++ {
+			msgId := uint32(i % netConnect.MaxMsgId)
+			data := bytes.Repeat([]byte{byte(msgId)}, int(msgId))
+			if i%2 == 0 {
+				pkt, _ := netConnect.PackMessage(msgId, data)
+				conn.SendData(pkt)
+				continue
+			}
+			buf := netConnect.GetBuffer()
+			buf.B = append(buf.B, data...)
+			(*netConnect.FrameEncoder)(nil).PackBuffer(msgId, buf)
+			conn.SendBuffer(buf)
+		}
+		for i := 0; i < count; i++ {
+			select {
+			case msgId := <-received:
+				if msgId != uint32(i%netConnect.MaxMsgId) {
+					t.Fatalf("policy %+v: frame %v out of order, got msgId %v", policy, i, msgId)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("policy %+v: frame %v timeout", policy, i)
+			}
+		}
+	}
+}
+
+func benchmarkLoopbackSend(b *testing.B, policy netConnect.FlushPolicy) {
+	var received atomic.Int64
+	done := make(chan struct{})
+	var total int64
+	conn := startLoopback(b, policy, func(netConnect.Frame) {
+		if received.Add(1) == atomic.LoadInt64(&total) {
+			close(done)
+		}
+	})
+	data := bytes.Repeat([]byte("x"), 64)
+	atomic.StoreInt64(&total, int64(b.N))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data) + netConnect.PacketHeaderSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := netConnect.GetBuffer()
+		buf.B = append(buf.B, data...)
+		(*netConnect.FrameEncoder)(nil).PackBuffer(1, buf)
+		conn.SendBuffer(buf)
+	}
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		b.Fatalf("received %v/%v frames", received.Load(), b.N)
+	}
+}
+
+// BenchmarkLoopbackSendPerFrame 逐帧写，等价于合并之前的行为
+func BenchmarkLoopbackSendPerFrame(b *testing.B) {
+	benchmarkLoopbackSend(b, netConnect.FlushPolicy{MaxBatchBytes: 1})
+}
+
+func BenchmarkLoopbackSendCoalesced(b *testing.B) {
+	benchmarkLoopbackSend(b, netConnect.FlushPolicy{})
+}
+
+func BenchmarkLoopbackSendDelayed(b *testing.B) {
+	benchmarkLoopbackSend(b, netConnect.FlushPolicy{MaxBatchBytes: 64 << 10, Delay: 100 * time.Microsecond})
+}
+
+// Delay 等待期间到达的高优先级帧排在已取出的普通帧之前写出
+func TestFlushDelayKeepsPriority(t *testing.T) {
+	received := make(chan uint32, 2)
+	conn := startLoopback(t, netConnect.FlushPolicy{Delay: 100 * time.Millisecond}, func(frame netConnect.Frame) {
+		received <- frame.MsgId
+	})
+	send := func(msgId uint32, priority netConnect.Priority) {
+		buf := netConnect.GetBuffer()
+		buf.B = append(buf.B, "x"...)
+		(*netConnect.FrameEncoder)(nil).PackBuffer(msgId, buf)
+		buf.Priority = priority
+		if err := conn.SendBuffer(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(1, netConnect.PriorityNormal)
+	time.Sleep(20 * time.Millisecond)
+	send(2, netConnect.PriorityHigh)
+	for _, want := range []uint32{2, 1} {
+		select {
+		case msgId := <-received:
+			if msgId != want {
+				t.Fatalf("expect msgId %v, got %v", want, msgId)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("frame timeout")
+		}
+	}
+}
+
+// 对端重置连接后只回调一次断开，之后的发送直接失败，不再堆积在队列里
+func TestConnWriteErrorCloses(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	connected := make(chan struct{})
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		<-connected
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+	}()
+	var disconnects atomic.Int32
+	conn := socketNetConnect.NewConnector()
+	conn.SetAddress("127.0.0.1", uint16(listener.Addr().(*net.TCPAddr).Port))
+	conn.SetOnConnect(func() {})
+	conn.SetOnDisconnect(func() { disconnects.Add(1) })
+	conn.SetOnData(func([]byte) error { return nil })
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	close(connected)
+	pkt, _ := netConnect.PackMessage(1, bytes.Repeat([]byte("x"), 1024))
+	deadline := time.Now().Add(5 * time.Second)
+	for conn.SendData(pkt) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("send should fail after the peer reset the connection")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := disconnects.Load(); n != 1 {
+		t.Fatalf("expect one disconnect callback, got %v", n)
+	}
+	if stats := conn.SendQueueStats(); stats.Frames != 0 {
+		t.Fatalf("queued frames should be released, got %+v", stats)
+	}
+}
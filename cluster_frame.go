@@ -0,0 +1,49 @@
+package dvactor
+
+import (
+	"net"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+)
+
+// linkFrameEncoder 按注册协商结果生成链路的发送帧编码。
+// 注册包本身总是在协商前以 v1 发出，旧节点因此能完成握手并继续使用 v1；
+// 接收侧逐帧识别格式，切换过程中两种帧可以混合到达。
+func (cn *clusterNet) linkFrameEncoder(capabilities Capability) *netConnect.FrameEncoder {
+	encoder := &netConnect.FrameEncoder{Version: netConnect.FrameVersion1}
+	if capabilities&CapabilityFrameV2 != 0 {
+		encoder.Version = netConnect.FrameVersion2
+		encoder.CRC = cn.clusterConfig.FrameCRC
+	}
+	if capabilities&CapabilityCompression != 0 {
+		encoder.Compressor = cn.compressor
+		encoder.Threshold = cn.compressThreshold
+	}
+	return encoder
+}
+
+// frameRejectKey 统计用的对端地址：TCP 去掉端口（对端每次重连端口都不同），unix/inproc 原样使用。
+func frameRejectKey(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// onFrameRejected 记录超长帧，连接随后由 engine 层断开。
+func (cn *clusterNet) onFrameRejected(remoteAddr string, err *netConnect.FrameTooLargeError) {
+	cn.frameRejectLock.Lock()
+	cn.frameRejects[frameRejectKey(remoteAddr)]++
+	cn.frameRejectLock.Unlock()
+	cn.localSystem.LogError("reject frame from %v: %v", remoteAddr, err)
+}
+
+func (cn *clusterNet) FrameRejects() map[string]uint64 {
+	cn.frameRejectLock.Lock()
+	defer cn.frameRejectLock.Unlock()
+	rejects := make(map[string]uint64, len(cn.frameRejects))
+	for addr, count := range cn.frameRejects {
+		rejects[addr] = count
+	}
+	return rejects
+}
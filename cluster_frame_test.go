@@ -0,0 +1,188 @@
+package dvactor
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	memNetConnect "github.com/kofplayer/dvactor/engine/net/connect/mem"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// v1/v2 帧混合在同一条流上，splitter 逐帧识别；v2 支持 2 字节 msgId、压缩与 CRC
+func TestFrameV2MixedStream(t *testing.T) {
+	compressor := netConnect.NewFlateCompressor(flate.BestSpeed)
+	v2 := &netConnect.FrameEncoder{Version: netConnect.FrameVersion2, Compressor: compressor, Threshold: 64, CRC: true}
+	big := bytes.Repeat([]byte("room state "), 100)
+
+	if _, err := (&netConnect.FrameEncoder{Version: netConnect.FrameVersion1}).Pack(300, nil); err == nil {
+		t.Fatal("v1 should reject msgId 300")
+	}
+	pkt1, _ := netConnect.PackMessage(1, []byte("hello"))
+	pkt2, err := v2.Pack(300, []byte("v2"))
+	if err != nil || pkt2[0] != netConnect.FrameV2Magic {
+		t.Fatalf("v2 pack error: %v", err)
+	}
+	pkt3, _ := v2.Pack(5, big)
+	stream := append(append(append([]byte{}, pkt1...), pkt2...), pkt3...)
+
+	var sp netConnect.PacketSplitter
+	var frames []netConnect.Frame
+	// 逐字节喂入，覆盖所有半包位置
+	for _, b := range stream {
+		sp.Append([]byte{b})
+		for {
+			frame, ok, err := sp.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+			// Payload 只在下一次 Append 前有效
+			frame.Payload = append([]byte(nil), frame.Payload...)
+			frames = append(frames, frame)
+		}
+	}
+	if len(frames) != 3 {
+		t.Fatalf("expect 3 frames, got %v", len(frames))
+	}
+	if frames[0].MsgId != 1 || string(frames[0].Payload) != "hello" {
+		t.Fatalf("v1 frame mismatch: %+v", frames[0])
+	}
+	if frames[1].MsgId != 300 || string(frames[1].Payload) != "v2" || frames[1].Flags != netConnect.FrameFlagCRC {
+		t.Fatalf("v2 frame mismatch: %+v", frames[1])
+	}
+	payload, err := netConnect.UnpackFrame(frames[2], compressor, netConnect.DefaultMaxFrameSize)
+	if err != nil || frames[2].MsgId != 5 || !bytes.Equal(payload, big) {
+		t.Fatalf("v2 compressed frame mismatch: id=%v err=%v", frames[2].MsgId, err)
+	}
+}
+
+func TestFrameV2Corrupted(t *testing.T) {
+	v2 := &netConnect.FrameEncoder{Version: netConnect.FrameVersion2, CRC: true}
+	pkt, _ := v2.Pack(7, []byte("payload"))
+	pkt[len(pkt)-1] ^= 0xFF
+	var sp netConnect.PacketSplitter
+	sp.Append(pkt)
+	if _, ok, err := sp.Next(); ok || !errors.Is(err, netConnect.ErrFrameCRC) {
+		t.Fatalf("crc mismatch expected, ok=%v err=%v", ok, err)
+	}
+
+	pkt, _ = v2.Pack(7, []byte("payload"))
+	pkt[1] |= 0x40
+	sp = netConnect.PacketSplitter{}
+	sp.Append(pkt)
+	if _, ok, err := sp.Next(); ok || !errors.Is(err, netConnect.ErrFrameFlags) {
+		t.Fatalf("unknown flags expected, ok=%v err=%v", ok, err)
+	}
+}
+
+// 双方都支持 v2 时链路切换到 v2（带 CRC），注册握手本身仍走 v1
+func TestFrameV2Negotiated(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	received := make(chan string, 2)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+		c.FrameCRC = true
+	}, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if msg, ok := ctx.GetMessage().(*protocol.ActorRef); ok {
+					received <- msg.ActorId
+				}
+			}
+		})
+	})
+	cn1 := systems[0].(*system).clusterNet
+	if !cn1.hasCapability(2, CapabilityFrameV2) {
+		t.Fatal("link 1-2 should negotiate frame v2")
+	}
+	encoder := cn1.linkFrameEncoder(CapabilityFrameV2)
+	if encoder.Version != netConnect.FrameVersion2 || !encoder.CRC {
+		t.Fatalf("link encoder mismatch: %+v", encoder)
+	}
+	if cn1.linkFrameEncoder(0).Version != netConnect.FrameVersion1 {
+		t.Fatal("legacy peer should stay on frame v1")
+	}
+
+	systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "a"), &protocol.ActorRef{ActorId: "to2"})
+	systems[1].Send(systems[1].CreateActorRefEx(1, actorType, "a"), &protocol.ActorRef{ActorId: "to1"})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("delivery timeout")
+		}
+	}
+}
+
+// 帧头一到就按最大帧长拒绝，不等 data 累积
+func TestFrameTooLarge(t *testing.T) {
+	v1 := make([]byte, netConnect.PacketHeaderSize)
+	binary.BigEndian.PutUint32(v1, 0xF0000000)
+	v2, _ := (&netConnect.FrameEncoder{Version: netConnect.FrameVersion2}).Pack(1, make([]byte, 100))
+	for _, header := range [][]byte{v1, v2[:netConnect.FrameV2HeaderSize]} {
+		var sp netConnect.PacketSplitter
+		sp.SetMaxFrameSize(64)
+		sp.Append(header)
+		var tooLarge *netConnect.FrameTooLargeError
+		if _, ok, err := sp.Next(); ok || !errors.As(err, &tooLarge) || tooLarge.Max != 64 {
+			t.Fatalf("frame too large expected, ok=%v err=%v", ok, err)
+		}
+	}
+	// 默认上限
+	var sp netConnect.PacketSplitter
+	sp.Append(v1)
+	if _, _, err := sp.Next(); err == nil {
+		t.Fatal("default max frame size should reject 3.75GB frame")
+	}
+}
+
+func TestFrameTooLargeClosesSession(t *testing.T) {
+	address := t.Name()
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{
+			{SystemId: 1, Address: "inproc://" + address},
+			{SystemId: 2, Address: "inproc://" + t.Name() + "/2"},
+		},
+		MaxFrameSize: 1024,
+	}).(*system)
+	cn := s.clusterNet
+	cn.server = NewServer(cn)
+	cn.server.Start()
+	defer cn.server.svr.Stop()
+	waitInprocListen(t, address)
+
+	disconnected := make(chan struct{})
+	conn := memNetConnect.NewConnector()
+	conn.SetAddress(address)
+	conn.SetOnConnect(func() {})
+	conn.SetOnDisconnect(func() { close(disconnected) })
+	conn.SetOnData(func([]byte) error { return nil })
+	if err := conn.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, netConnect.PacketHeaderSize)
+	binary.BigEndian.PutUint32(header, 4096)
+	conn.SendData(header)
+	select {
+	case <-disconnected:
+	case <-time.After(3 * time.Second):
+		t.Fatal("server should close the session")
+	}
+	var total uint64
+	for _, count := range s.FrameRejects() {
+		total += count
+	}
+	if total != 1 {
+		t.Fatalf("expect 1 rejected frame, got %v", s.FrameRejects())
+	}
+}
@@ -0,0 +1,80 @@
+package dvactor
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// newInprocCluster 在当前测试进程内启动 count 个通过 inproc 传输互连的 ClusterSystem。
+// actorTypes 声明在每个节点上；configure（可为 nil）调整各节点的 ClusterConfig；
+// setup 在 Start 前调用，用于注册 actor/消息类型。
+func newInprocCluster(t *testing.T, count int, actorTypes []vactor.ActorType, configure func(c *ClusterConfig), setup func(s ClusterSystem)) []ClusterSystem {
+	configs := make([]*SystemConfig, count)
+	for i := range configs {
+		configs[i] = &SystemConfig{
+			SystemId:   vactor.SystemId(i + 1),
+			Address:    fmt.Sprintf("inproc://%v/%v", t.Name(), i+1),
+			ActorTypes: actorTypes,
+		}
+	}
+	systems := make([]ClusterSystem, count)
+	for i := range systems {
+		clusterConfig := &ClusterConfig{
+			LocalSystemId:  vactor.SystemId(i + 1),
+			SystemConfigs:  configs,
+			ConnectTimeout: 10 * time.Second,
+		}
+		if configure != nil {
+			configure(clusterConfig)
+		}
+		systems[i] = NewSystem(clusterConfig)
+		if setup != nil {
+			setup(systems[i])
+		}
+	}
+	// Start 会阻塞到全员互连，必须并发启动
+	var wg sync.WaitGroup
+	for _, s := range systems {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Start()
+		}()
+	}
+	wg.Wait()
+	return systems
+}
+
+func TestInprocClusterSend(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	received := make(chan vactor.SystemId, 2)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, nil, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if msg, ok := ctx.GetMessage().(*protocol.ActorRef); ok && msg.ActorId == "ping" {
+					received <- ctx.GetActorRef().GetSystemId()
+				}
+			}
+		})
+	})
+
+	// 两个方向各发一条：1 → 2 走 server session，2 → 1 走 client
+	systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "a"), &protocol.ActorRef{ActorId: "ping"})
+	systems[1].Send(systems[1].CreateActorRefEx(1, actorType, "a"), &protocol.ActorRef{ActorId: "ping"})
+	got := map[vactor.SystemId]bool{}
+	for len(got) < 2 {
+		select {
+		case systemId := <-received:
+			got[systemId] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("inproc cluster delivery timeout, got %v", got)
+		}
+	}
+}
@@ -1,12 +1,14 @@
 package dvactor
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	netClient "github.com/kofplayer/dvactor/engine/net/client"
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
 	netSession "github.com/kofplayer/dvactor/engine/net/session"
 	"github.com/kofplayer/dvactor/protocol"
 	"github.com/kofplayer/vactor"
@@ -33,6 +35,7 @@ func NewClusterNet(localSystem *system, clusterConfig *ClusterConfig) *clusterNe
 		clusterConfig:    clusterConfig,
 		systemInfos:      systemInfos,
 		systemCount:      len(systemInfos),
+		frameRejects:     make(map[string]uint64),
 	}
 }
 
@@ -70,6 +73,19 @@ type clusterNet struct {
 	connectedSystemCount int32
 	server               *clusterServer
 	clients              map[vactor.SystemId]*clusterClient
+	tls                  *clusterTLS
+	compressor           netConnect.Compressor
+	compressThreshold    int
+	frameRejectLock      sync.Mutex
+	frameRejects         map[string]uint64
+	// 分片：发送阈值（0 不分片）、接收侧重组上限、发送侧消息序号
+	chunkSize         int
+	maxChunkedSize    int
+	maxPendingChunked int
+	chunkSeq          atomic.Uint64
+	// 合批：单批上限与等待时间，batchMaxBytes 为 0 不合批
+	batchMaxBytes int
+	batchDelay    time.Duration
 }
 
 type systemInfo struct {
@@ -78,11 +94,35 @@ type systemInfo struct {
 	lock    sync.RWMutex
 	session netSession.NetSession
 	cli     netClient.NetClient
+	// 当前链路注册时协商出的协议版本与能力位，断线清零
+	version      uint32
+	capabilities Capability
+	// 附加连接（ConnectionsPerPeer > 1），下标为连接序号，0 号即 cli/session 本身、始终为 nil
+	stripeClis     []netClient.NetClient
+	stripeSessions []netSession.NetSession
+	// 各连接的合批器，连接断开时移除
+	batchLock sync.Mutex
+	batchers  map[linkSender]*envelopeBatcher
 }
 
 func (cn *clusterNet) start() error {
 	cn.localSystem.LogDebug("start cluster")
 	atomic.AddInt32(&cn.connectedSystemCount, 1)
+	for _, config := range cn.clusterConfig.SystemConfigs {
+		if _, err := parseSystemAddress(config); err != nil {
+			return err
+		}
+	}
+	if cn.clusterConfig.TLS != nil {
+		ct, err := newClusterTLS(cn.clusterConfig.TLS)
+		if err != nil {
+			return err
+		}
+		cn.tls = ct
+	}
+	cn.initCompression()
+	cn.initChunking()
+	cn.initBatching()
 	if cn.localSystemIndex < cn.systemCount-1 {
 		cn.localSystem.LogInfo("start server")
 		cn.server = NewServer(cn)
@@ -101,6 +141,7 @@ func (cn *clusterNet) start() error {
 			cn.clients[config.SystemId] = client
 			cn.localSystem.LogInfo("start client to %v", config.SystemId)
 			client.Start()
+			cn.startStripeClients(config.SystemId)
 		}
 	}
 
@@ -110,7 +151,7 @@ func (cn *clusterNet) start() error {
 	}
 	for {
 		connectedSystemCount := atomic.LoadInt32(&cn.connectedSystemCount)
-		if connectedSystemCount >= int32(cn.systemCount) {
+		if connectedSystemCount >= int32(cn.systemCount) && cn.stripesReady() {
 			break
 		}
 		if !deadline.IsZero() && time.Now().After(deadline) {
@@ -124,38 +165,89 @@ func (cn *clusterNet) start() error {
 	return nil
 }
 
-func (cn *clusterNet) doSend(systemId vactor.SystemId, msgId uint32, data []byte) vactor.VAError {
+// doSend 发送已序列化到 buf 的包，buf 的所有权随之转移（任何返回路径都会回收）。
+// slot 决定走哪条连接，见 systemInfo.link。
+// 连接与合批器在 info.lock 读锁内选定，发送在锁外进行：OverflowBlock 阻塞时不会拖住断线处理。
+func (cn *clusterNet) doSend(systemId vactor.SystemId, msgId uint32, buf *netConnect.Buffer, slot vactor.GroupSlot) vactor.VAError {
 	info := cn.systemInfos[systemId]
 	info.lock.RLock()
-	defer info.lock.RUnlock()
+	if capability, ok := pkgTypeCapabilities[protocol.PkgType(msgId)]; ok && info.capabilities&capability != capability {
+		info.lock.RUnlock()
+		netConnect.PutBuffer(buf)
+		cn.localSystem.LogError("system %v does not support pkg %v", systemId, protocol.PkgType(msgId))
+		return vactor.NewVAError(ErrorCodeCapabilityNotSupported)
+	}
+	link := info.link(slot)
+	if link == nil {
+		info.lock.RUnlock()
+		netConnect.PutBuffer(buf)
+		cn.localSystem.LogError("system %v disconnect (slot %v)", systemId, slot)
+		return vactor.NewVAError(ErrorCodeMessageSendFail)
+	}
+	buf.Priority = pkgTypePriorities[protocol.PkgType(msgId)]
+	chunk := cn.shouldChunk(info, buf.Data())
+	b := cn.batcher(info, link, buf.Priority)
+	info.lock.RUnlock()
+	send := func() error {
+		if chunk {
+			return cn.sendChunks(link, msgId, buf)
+		}
+		return link.SendBuffer(msgId, buf)
+	}
 	var err error
-	if info.passive {
-		if info.cli != nil {
-			err = info.cli.SendMessage(msgId, data)
-		}
+	if b == nil {
+		err = send()
+	} else if !chunk && b.batchable(buf.Data()) {
+		err = b.add(msgId, buf)
 	} else {
-		if info.session != nil {
-			err = info.session.SendMessage(msgId, data)
-		}
+		err = b.sendDirect(send)
 	}
-	if err != nil {
+	if err == nil {
+		return nil
+	}
+	code := linkErrorCode(err)
+	switch code {
+	case ErrorCodeSendQueueFull:
+		cn.localSystem.LogError("system %v send queue full", systemId)
+	case ErrorCodeMessageSendFail:
 		cn.localSystem.LogError("system %v send message error: %v", systemId, err)
-		return vactor.NewVAError(ErrorCodeMessageSendFail)
 	}
-	if (info.passive && info.cli == nil) || (!info.passive && info.session == nil) {
-		cn.localSystem.LogError("system %v disconnect", systemId)
-		return vactor.NewVAError(ErrorCodeMessageSendFail)
+	return vactor.NewVAError(code)
+}
+
+// linkErrorCode 把连接发送错误映射为错误码。
+func linkErrorCode(err error) vactor.ErrorCode {
+	switch {
+	case errors.Is(err, netConnect.ErrSendQueueFull):
+		return ErrorCodeSendQueueFull
+	case errors.Is(err, netConnect.ErrSendQueueDropped):
+		return ErrorCodeSendQueueDropped
 	}
-	return nil
+	return ErrorCodeMessageSendFail
 }
 
 func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) vactor.VAError {
+	envelopes, slots := cn.splitByStripe(systemId, envelope)
+	if envelopes == nil {
+		return cn.sendEnvelope(systemId, envelope, envelopeGroupSlot(envelope))
+	}
+	var firstErr vactor.VAError
+	for i, e := range envelopes {
+		if err := cn.sendEnvelope(systemId, e, slots[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// sendEnvelope 序列化 envelope 并经 slot 对应的连接发往 systemId。
+func (cn *clusterNet) sendEnvelope(systemId vactor.SystemId, envelope vactor.Envelope, slot vactor.GroupSlot) vactor.VAError {
 	var msgId uint32
 	var pkg proto.Message
 
 	switch e := envelope.(type) {
 	case *vactor.EnvelopeSend:
-		msg, err := cn.localSystem.MarshalMessage(e.Message)
+		msg, err := cn.marshalFor(systemId, e.Message)
 		if err != nil {
 			return err
 		}
@@ -168,9 +260,9 @@ func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) v
 	case *vactor.EnvelopeBatchSend:
 		messages := make([]*protocol.Message, 0, len(e.Messages))
 		for _, message := range e.Messages {
-			msg, err := cn.localSystem.MarshalMessage(message)
+			msg, err := cn.marshalFor(systemId, message)
 			if err != nil {
-				cn.localSystem.LogError("MarshalMessage error: %v\n", err)
+				cn.outboundBatchItem(systemId, e, message, err)
 				continue
 			}
 			messages = append(messages, msg)
@@ -190,7 +282,7 @@ func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) v
 			Messages:     messages,
 		}
 	case *vactor.EnvelopeRequestAsync:
-		msg, err := cn.localSystem.MarshalMessage(e.Message)
+		msg, err := cn.marshalFor(systemId, e.Message)
 		if err != nil {
 			return err
 		}
@@ -203,19 +295,20 @@ func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) v
 			CallbackAddress: e.CallbackAddress,
 		}
 	case *vactor.EnvelopeResponseAsync:
-		msg, err := cn.localSystem.MarshalMessage(e.Message)
-		if err != nil {
-			return err
+		// 错误响应可以不带消息
+		var msg *protocol.Message
+		if e.Message != nil {
+			var err vactor.VAError
+			msg, err = cn.marshalFor(systemId, e.Message)
+			if err != nil {
+				return err
+			}
 		}
 		msgId = uint32(protocol.PkgType_PkgTypeEnvelopeResponseAsync)
 		rsp := &protocol.Response{
 			Message: msg,
 		}
-		if e.Error == nil {
-			rsp.ErrorCode = protocol.ErrorCode_ErrorCodeSuccess
-		} else {
-			rsp.ErrorCode = protocol.ErrorCode(e.Error.Code())
-		}
+		cn.responseErrorToProto(systemId, rsp, e.Error)
 		pkg = &protocol.PkgEnvelopeResponseAsync{
 			FromActorRef:    ActorRefToProto(e.FromActorRef),
 			ToActorRef:      ActorRefToProto(e.ToActorRef),
@@ -224,7 +317,7 @@ func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) v
 			CallbackAddress: e.CallbackAddress,
 		}
 	case *vactor.EnvelopeRequest:
-		msg, err := cn.localSystem.MarshalMessage(e.Message)
+		msg, err := cn.marshalFor(systemId, e.Message)
 		if err != nil {
 			return err
 		}
@@ -236,19 +329,20 @@ func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) v
 			RequestId:    uint32(e.RequestId),
 		}
 	case *vactor.EnvelopeResponse:
-		msg, err := cn.localSystem.MarshalMessage(e.Message)
-		if err != nil {
-			return err
+		// 错误响应可以不带消息
+		var msg *protocol.Message
+		if e.Message != nil {
+			var err vactor.VAError
+			msg, err = cn.marshalFor(systemId, e.Message)
+			if err != nil {
+				return err
+			}
 		}
 		msgId = uint32(protocol.PkgType_PkgTypeEnvelopeResponse)
 		rsp := &protocol.Response{
 			Message: msg,
 		}
-		if e.Error == nil {
-			rsp.ErrorCode = protocol.ErrorCode_ErrorCodeSuccess
-		} else {
-			rsp.ErrorCode = protocol.ErrorCode(e.Error.Code())
-		}
+		cn.responseErrorToProto(systemId, rsp, e.Error)
 		pkg = &protocol.PkgEnvelopeResponse{
 			FromActorRef: ActorRefToProto(e.FromActorRef),
 			ToActorRef:   ActorRefToProto(e.ToActorRef),
@@ -264,7 +358,7 @@ func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) v
 			IsWatch:      e.IsWatch,
 		}
 	case *vactor.EnvelopeNotify:
-		msg, err := cn.localSystem.MarshalMessage(e.Message.Message)
+		msg, err := cn.marshalFor(systemId, e.Message.Message)
 		if err != nil {
 			return err
 		}
@@ -282,7 +376,7 @@ func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) v
 			Message:      msg,
 		}
 	case *vactor.EnvelopeFireNotify:
-		msg, err := cn.localSystem.MarshalMessage(e.Message)
+		msg, err := cn.marshalFor(systemId, e.Message)
 		if err != nil {
 			return err
 		}
@@ -298,24 +392,59 @@ func (cn *clusterNet) Send(systemId vactor.SystemId, envelope vactor.Envelope) v
 		cn.localSystem.LogError("unknown envelope type")
 		return vactor.NewVAError(ErrorCodeUnknownEnvelope)
 	}
-	data, err := proto.Marshal(pkg)
+	// 包已构造好才登记请求，序列化失败的请求不会留在跟踪表里
+	if !cn.localSystem.requests.onSend(systemId, envelope) {
+		// 调用方已取消该请求，响应无人读取
+		return nil
+	}
+	err := cn.sendPkg(systemId, msgId, pkg, slot)
+	if err != nil {
+		cn.localSystem.requests.forget(envelope)
+		cn.outboundDeadLetter(systemId, msgId, pkg, err)
+		if err.Code() == ErrorCodeSendQueueDropped {
+			// OverflowDropNewest 对调用方视为成功，丢失只体现在死信里
+			return nil
+		}
+	}
+	return err
+}
+
+// sendPkg 序列化 pkg 并经 slot 对应的连接发往 systemId。
+func (cn *clusterNet) sendPkg(systemId vactor.SystemId, msgId uint32, pkg proto.Message, slot vactor.GroupSlot) vactor.VAError {
+	// 直接序列化进带帧头预留区的池化缓冲，打包时不再拷贝
+	buf := netConnect.GetBuffer()
+	var err error
+	buf.B, err = proto.MarshalOptions{}.MarshalAppend(buf.B, pkg)
 	if err != nil {
+		netConnect.PutBuffer(buf)
 		return vactor.NewVAError(ErrorCodeMessageSerializeFail)
 	}
-	return cn.doSend(systemId, msgId, data)
+	return cn.doSend(systemId, msgId, buf, slot)
 }
 
-func (cn *clusterNet) OnMessage(msgId uint32, data []byte) error {
+func (cn *clusterNet) OnMessage(systemId vactor.SystemId, msgId uint32, data []byte) error {
+	err := cn.dispatch(systemId, msgId, data)
+	if _, ok := err.(droppedError); ok {
+		// 单条消息已进死信（请求已回错误响应），连接保持
+		return nil
+	}
+	return err
+}
+
+// dispatch 解析并投递一个入站包；包本身解析失败返回原错误，其中的业务消息无法投递返回 droppedError。
+func (cn *clusterNet) dispatch(systemId vactor.SystemId, msgId uint32, data []byte) error {
 	switch protocol.PkgType(msgId) {
 	case protocol.PkgType_PkgTypeEnvelopeSend:
 		pkg := &protocol.PkgEnvelopeSend{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
-		msg, err := cn.localSystem.UnmarshalMessage(pkg.Message)
+		msg, err := cn.unmarshalFrom(systemId, pkg.Message)
 		if err != nil {
-			return err
+			cn.inboundDeadLetter(systemId, msgId, data, pkg, err)
+			return droppedError{err}
 		}
 		cn.localSystem.LocalRouter(&vactor.EnvelopeSend{
 			FromActorRef: ActorRefFromProto(pkg.FromActorRef),
@@ -326,13 +455,14 @@ func (cn *clusterNet) OnMessage(msgId uint32, data []byte) error {
 		pkg := &protocol.PkgEnvelopeBatchSend{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
 		msgs := make([]interface{}, 0, len(pkg.Messages))
 		for _, protoMsg := range pkg.Messages {
-			msg, err := cn.localSystem.UnmarshalMessage(protoMsg)
+			msg, err := cn.unmarshalFrom(systemId, protoMsg)
 			if err != nil {
-				cn.localSystem.LogError("UnmarshalMessage error: %v", err)
+				cn.inboundBatchItem(systemId, pkg, protoMsg, err)
 				continue
 			}
 			msgs = append(msgs, msg)
@@ -351,72 +481,85 @@ func (cn *clusterNet) OnMessage(msgId uint32, data []byte) error {
 		pkg := &protocol.PkgEnvelopeRequestAsync{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
-			return err
-		}
-		msg, err := cn.localSystem.UnmarshalMessage(pkg.Message)
-		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
 		e := &vactor.EnvelopeRequestAsync{
 			FromActorRef:    ActorRefFromProto(pkg.FromActorRef),
 			ToActorRef:      ActorRefFromProto(pkg.ToActorRef),
-			Message:         msg,
 			CallbackId:      vactor.CallbackId(pkg.CallbackId),
 			CallbackAddress: pkg.CallbackAddress,
 		}
-		cn.localSystem.LocalRouter(e)
+		e.Message, err = cn.unmarshalFrom(systemId, pkg.Message)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, pkg, err)
+			cn.rejectRequest(e, vactor.NewVAError(decodeErrorCode(err)))
+			return droppedError{err}
+		}
+		cn.deliverRequest(e)
 	case protocol.PkgType_PkgTypeEnvelopeResponseAsync:
 		pkg := &protocol.PkgEnvelopeResponseAsync{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
 		var msg interface{}
+		rspErr := cn.responseErrorFromProto(systemId, pkg.Response)
 		if pkg.Response.Message != nil {
-			msg, err = cn.localSystem.UnmarshalMessage(pkg.Response.Message)
+			msg, err = cn.unmarshalFrom(systemId, pkg.Response.Message)
 			if err != nil {
-				return err
+				// 响应照常交给调用方，只是带上解码错误，不让它等到超时
+				cn.inboundDeadLetter(systemId, msgId, data, pkg, err)
+				rspErr = vactor.NewVAError(decodeErrorCode(err))
 			}
 		}
 		e := &vactor.EnvelopeResponseAsync{
 			FromActorRef: ActorRefFromProto(pkg.FromActorRef),
 			ToActorRef:   ActorRefFromProto(pkg.ToActorRef),
 			Response: &vactor.Response{
-				Error:   errorCodeToVAError(pkg.Response.ErrorCode),
+				Error:   rspErr,
 				Message: msg,
 			},
 			CallbackId:      vactor.CallbackId(pkg.CallbackId),
 			CallbackAddress: pkg.CallbackAddress,
 		}
+		cn.localSystem.requests.forget(e)
 		cn.localSystem.LocalRouter(e)
 	case protocol.PkgType_PkgTypeEnvelopeRequest:
 		pkg := &protocol.PkgEnvelopeRequest{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
-			return err
-		}
-		msg, err := cn.localSystem.UnmarshalMessage(pkg.Message)
-		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
 		e := &vactor.EnvelopeRequest{
 			FromActorRef: ActorRefFromProto(pkg.FromActorRef),
 			ToActorRef:   ActorRefFromProto(pkg.ToActorRef),
-			Message:      msg,
 			RequestId:    vactor.CallbackId(pkg.RequestId),
 		}
-		cn.localSystem.LocalRouter(e)
+		e.Message, err = cn.unmarshalFrom(systemId, pkg.Message)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, pkg, err)
+			cn.rejectRequest(e, vactor.NewVAError(decodeErrorCode(err)))
+			return droppedError{err}
+		}
+		cn.deliverRequest(e)
 	case protocol.PkgType_PkgTypeEnvelopeResponse:
 		pkg := &protocol.PkgEnvelopeResponse{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
 		var msg interface{}
+		rspErr := cn.responseErrorFromProto(systemId, pkg.Response)
 		if pkg.Response.Message != nil {
-			msg, err = cn.localSystem.UnmarshalMessage(pkg.Response.Message)
+			msg, err = cn.unmarshalFrom(systemId, pkg.Response.Message)
 			if err != nil {
-				return err
+				// 响应照常交给调用方，只是带上解码错误，不让它等到超时
+				cn.inboundDeadLetter(systemId, msgId, data, pkg, err)
+				rspErr = vactor.NewVAError(decodeErrorCode(err))
 			}
 		}
 		e := &vactor.EnvelopeResponse{
@@ -424,15 +567,17 @@ func (cn *clusterNet) OnMessage(msgId uint32, data []byte) error {
 			ToActorRef:   ActorRefFromProto(pkg.ToActorRef),
 			RequestId:    vactor.CallbackId(pkg.RequestId),
 			Response: &vactor.Response{
-				Error:   errorCodeToVAError(pkg.Response.ErrorCode),
+				Error:   rspErr,
 				Message: msg,
 			},
 		}
+		cn.localSystem.requests.forget(e)
 		cn.localSystem.LocalRouter(e)
 	case protocol.PkgType_PkgTypeEnvelopeWatch:
 		pkg := &protocol.PkgEnvelopeWatch{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
 		e := &vactor.EnvelopeWatch{
@@ -446,11 +591,13 @@ func (cn *clusterNet) OnMessage(msgId uint32, data []byte) error {
 		pkg := &protocol.PkgEnvelopeNotify{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
-		msg, err := cn.localSystem.UnmarshalMessage(pkg.Message)
+		msg, err := cn.unmarshalFrom(systemId, pkg.Message)
 		if err != nil {
-			return err
+			cn.inboundDeadLetter(systemId, msgId, data, pkg, err)
+			return droppedError{err}
 		}
 		toActorRefs := make([]vactor.ActorRef, len(pkg.ToActorRefs))
 		for i, key := range pkg.ToActorRefs {
@@ -471,11 +618,13 @@ func (cn *clusterNet) OnMessage(msgId uint32, data []byte) error {
 		pkg := &protocol.PkgEnvelopeFireNotify{}
 		err := proto.Unmarshal(data, pkg)
 		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
 			return err
 		}
-		msg, err := cn.localSystem.UnmarshalMessage(pkg.Message)
+		msg, err := cn.unmarshalFrom(systemId, pkg.Message)
 		if err != nil {
-			return err
+			cn.inboundDeadLetter(systemId, msgId, data, pkg, err)
+			return droppedError{err}
 		}
 		e := &vactor.EnvelopeFireNotify{
 			FromActorRef: ActorRefFromProto(pkg.FromActorRef),
@@ -485,6 +634,77 @@ func (cn *clusterNet) OnMessage(msgId uint32, data []byte) error {
 			Message:      msg,
 		}
 		cn.localSystem.LocalRouter(e)
+	case protocol.PkgType_PkgTypeEnvelopeBatch:
+		pkg := &protocol.PkgEnvelopeBatch{}
+		err := proto.Unmarshal(data, pkg)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
+			return err
+		}
+		for _, item := range pkg.Items {
+			if protocol.PkgType(item.PkgType) == protocol.PkgType_PkgTypeEnvelopeBatch {
+				return fmt.Errorf("nested envelope batch")
+			}
+			if err := cn.OnMessage(systemId, item.PkgType, item.Data); err != nil {
+				return err
+			}
+		}
+	case protocol.PkgType_PkgTypeStreamOpen:
+		pkg := &protocol.PkgStreamOpen{}
+		err := proto.Unmarshal(data, pkg)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
+			return err
+		}
+		cn.localSystem.streams.onOpen(StreamId(pkg.StreamId), ActorRefFromProto(pkg.FromActorRef), ActorRefFromProto(pkg.ToActorRef), pkg.Window)
+	case protocol.PkgType_PkgTypeStreamData:
+		pkg := &protocol.PkgStreamData{}
+		err := proto.Unmarshal(data, pkg)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
+			return err
+		}
+		msg, err := cn.unmarshalFrom(systemId, pkg.Message)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, pkg, err)
+			return droppedError{err}
+		}
+		cn.localSystem.streams.onData(StreamId(pkg.StreamId), pkg.Seq, msg)
+	case protocol.PkgType_PkgTypeStreamCredit:
+		pkg := &protocol.PkgStreamCredit{}
+		err := proto.Unmarshal(data, pkg)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
+			return err
+		}
+		cn.localSystem.streams.onCredit(StreamId(pkg.StreamId), pkg.Credit)
+	case protocol.PkgType_PkgTypeStreamClose:
+		pkg := &protocol.PkgStreamClose{}
+		err := proto.Unmarshal(data, pkg)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
+			return err
+		}
+		cn.localSystem.streams.onClose(StreamId(pkg.StreamId), pkg.FromReader, errorCodeToVAError(pkg.ErrorCode))
+	case protocol.PkgType_PkgTypeMessageTypeAnnounce:
+		pkg := &protocol.PkgMessageTypeAnnounce{}
+		err := proto.Unmarshal(data, pkg)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
+			return err
+		}
+		cn.localSystem.onMessageTypeAnnounce(systemId, pkg)
+	case protocol.PkgType_PkgTypeCancelRequest:
+		pkg := &protocol.PkgCancelRequest{}
+		err := proto.Unmarshal(data, pkg)
+		if err != nil {
+			cn.inboundDeadLetter(systemId, msgId, data, nil, err)
+			return err
+		}
+		cn.localSystem.requests.onCancel(cancelRequestKey(pkg))
+	default:
+		// 发送侧按能力位协商，正常不会收到不认识的 PkgType
+		cn.localSystem.LogError("unknown pkg type %v", msgId)
 	}
 	return nil
 }
@@ -0,0 +1,93 @@
+package dvactor
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/kofplayer/vactor"
+)
+
+// droppedError 入站包中的业务消息无法投递，已记入死信；只丢这一条，不断开连接。
+type droppedError struct {
+	err error
+}
+
+func (e droppedError) Error() string { return e.err.Error() }
+
+func (e droppedError) Unwrap() error { return e.err }
+
+// decodeErrorCode 把入站消息的解码错误映射为回给调用方的错误码。
+func decodeErrorCode(err error) vactor.ErrorCode {
+	switch {
+	case errors.Is(err, ErrUnknownMessageType):
+		return ErrorCodeMessageNotRegister
+	case errors.Is(err, ErrMessageTypeQuarantined):
+		return ErrorCodeMessageTypeConflict
+	}
+	return ErrorCodeMessageDecodeFail
+}
+
+// hostsActorType 本节点是否承载 actorType；ActorTypeStart 以下的内部类型（代理等）每个节点都有。
+func (cn *clusterNet) hostsActorType(actorType vactor.ActorType) bool {
+	if actorType < ActorTypeStart {
+		return true
+	}
+	return slices.Contains(cn.systemInfos[cn.clusterConfig.LocalSystemId].config.ActorTypes, actorType)
+}
+
+// deliverRequest 把入站请求登记（供取消）并投入本地调度；目标类型不在本节点或投递失败时直接回错误响应。
+func (cn *clusterNet) deliverRequest(e vactor.Envelope) {
+	if !cn.hostsActorType(e.GetToActorRef().GetActorType()) {
+		cn.localSystem.LogError("actor type %v is not hosted, reject request", e.GetToActorRef().GetActorType())
+		cn.rejectRequest(e, vactor.NewVAError(ErrorCodeActorTypeNotHosted))
+		return
+	}
+	// 登记记录代替原消息投递，handler 通过 EnvelopeContext 找回它；内部类型的 actor 不经 wrapActor，不登记
+	switch req := e.(type) {
+	case *vactor.EnvelopeRequest:
+		if req.ToActorRef.GetActorType() < ActorTypeStart {
+			break
+		}
+		if r := cn.localSystem.requests.onRequest(e, req.Message); r != nil {
+			req.Message = r
+		}
+	case *vactor.EnvelopeRequestAsync:
+		if req.ToActorRef.GetActorType() < ActorTypeStart {
+			break
+		}
+		if r := cn.localSystem.requests.onRequest(e, req.Message); r != nil {
+			req.Message = r
+		}
+	}
+	if err := cn.localSystem.LocalRouter(e); err != nil {
+		cn.rejectRequest(e, err)
+	}
+}
+
+// rejectRequest 代替目标 actor 回错误响应，调用方立即收到 err 而不是等到超时。连接保持不变。
+func (cn *clusterNet) rejectRequest(e vactor.Envelope, err vactor.VAError) {
+	var rsp vactor.Envelope
+	switch req := e.(type) {
+	case *vactor.EnvelopeRequest:
+		rsp = &vactor.EnvelopeResponse{
+			FromActorRef: req.ToActorRef,
+			ToActorRef:   req.FromActorRef,
+			RequestId:    req.RequestId,
+			Response:     &vactor.Response{Error: err},
+		}
+	case *vactor.EnvelopeRequestAsync:
+		rsp = &vactor.EnvelopeResponseAsync{
+			FromActorRef:    req.ToActorRef,
+			ToActorRef:      req.FromActorRef,
+			CallbackId:      req.CallbackId,
+			CallbackAddress: req.CallbackAddress,
+			Response:        &vactor.Response{Error: err},
+		}
+	default:
+		return
+	}
+	if rsp.GetToActorRef() == nil {
+		return
+	}
+	cn.localSystem.router.Router(rsp)
+}
@@ -0,0 +1,124 @@
+package dvactor
+
+import (
+	"testing"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// 无法处理的入站请求回错误响应而不是断开连接；节点 1 未启动，回给它的响应落入出站死信，从中取出检查
+func TestRejectRequest(t *testing.T) {
+	hosted := ActorTypeStart + 1
+	remote := ActorTypeStart + 2
+	queue := make(chan *DeadLetter, 8)
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 2,
+		SystemConfigs: []*SystemConfig{
+			{SystemId: 1, ActorTypes: []vactor.ActorType{remote}},
+			{SystemId: 2, ActorTypes: []vactor.ActorType{hosted}},
+		},
+		DeadLetter: &DeadLetterConfig{Queue: queue},
+	}).(*system)
+	s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+	msg, _ := s.MarshalMessage(&protocol.ActorRef{ActorId: "x"})
+	unknown := &protocol.Message{Type: 2, Data: msg.Data}
+	from := &protocol.ActorRef{SystemId: 1, ActorType: uint32(remote), ActorId: "caller"}
+	waitResponse := func() *protocol.Response {
+		for {
+			dl := waitDeadLetter(t, queue)
+			if dl.Inbound {
+				continue
+			}
+			switch dl.PkgType {
+			case protocol.PkgType_PkgTypeEnvelopeResponse:
+				pkg := &protocol.PkgEnvelopeResponse{}
+				proto.Unmarshal(dl.Data, pkg)
+				if pkg.RequestId != 7 || pkg.ToActorRef.GetActorId() != "caller" {
+					t.Fatalf("unexpected response %v", pkg)
+				}
+				return pkg.Response
+			case protocol.PkgType_PkgTypeEnvelopeResponseAsync:
+				pkg := &protocol.PkgEnvelopeResponseAsync{}
+				proto.Unmarshal(dl.Data, pkg)
+				if pkg.CallbackId != 8 || pkg.CallbackAddress != 9 {
+					t.Fatalf("unexpected response %v", pkg)
+				}
+				return pkg.Response
+			}
+			t.Fatalf("unexpected dead letter %+v", dl)
+		}
+	}
+	cases := []struct {
+		actorType vactor.ActorType
+		message   *protocol.Message
+		code      vactor.ErrorCode
+	}{
+		{remote, msg, ErrorCodeActorTypeNotHosted},
+		{hosted, unknown, ErrorCodeMessageNotRegister},
+		{hosted, &protocol.Message{Type: 1, Data: append(msg.Data[:4:4], 0xff)}, ErrorCodeMessageDecodeFail},
+	}
+	for _, c := range cases {
+		to := &protocol.ActorRef{SystemId: 2, ActorType: uint32(c.actorType), ActorId: "a"}
+		data, _ := proto.Marshal(&protocol.PkgEnvelopeRequest{FromActorRef: from, ToActorRef: to, Message: c.message, RequestId: 7})
+		if err := s.clusterNet.OnMessage(2, uint32(protocol.PkgType_PkgTypeEnvelopeRequest), data); err != nil {
+			t.Fatalf("connection should be kept: %v", err)
+		}
+		if rsp := waitResponse(); vactor.ErrorCode(rsp.ErrorCode) != c.code {
+			t.Fatalf("expect %v, got %v", c.code, rsp.ErrorCode)
+		}
+		data, _ = proto.Marshal(&protocol.PkgEnvelopeRequestAsync{FromActorRef: from, ToActorRef: to, Message: c.message, CallbackId: 8, CallbackAddress: 9})
+		if err := s.clusterNet.OnMessage(2, uint32(protocol.PkgType_PkgTypeEnvelopeRequestAsync), data); err != nil {
+			t.Fatalf("connection should be kept: %v", err)
+		}
+		if rsp := waitResponse(); vactor.ErrorCode(rsp.ErrorCode) != c.code {
+			t.Fatalf("expect %v, got %v", c.code, rsp.ErrorCode)
+		}
+	}
+	// 包本身解析失败仍断开
+	if err := s.clusterNet.OnMessage(2, uint32(protocol.PkgType_PkgTypeEnvelopeRequest), []byte{0xff}); err == nil {
+		t.Fatal("broken pkg should fail")
+	}
+}
+
+// 响应错误的说明文字、完整错误码与详情跨节点还原
+func TestDetailedErrorResponse(t *testing.T) {
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}},
+	}).(*system)
+	s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+	roundTrip := func(err vactor.VAError) vactor.VAError {
+		rsp := &protocol.Response{}
+		s.clusterNet.responseErrorToProto(2, rsp, err)
+		data, _ := proto.Marshal(rsp)
+		out := &protocol.Response{}
+		if e := proto.Unmarshal(data, out); e != nil {
+			t.Fatal(e)
+		}
+		return s.clusterNet.responseErrorFromProto(2, out)
+	}
+	if err := roundTrip(nil); err != nil {
+		t.Fatalf("success should be nil, got %v", err)
+	}
+	code := ErrorCodeCustomStart + 1<<20
+	err := roundTrip(NewDetailedError(code, "banned", &protocol.ActorRef{ActorId: "u1"}))
+	detailed, ok := err.(*DetailedError)
+	if !ok || detailed.Code() != code || detailed.Message != "banned" || detailed.Detail.(*protocol.ActorRef).ActorId != "u1" {
+		t.Fatalf("unexpected %#v", err)
+	}
+	// 详情类型未注册时只丢详情
+	err = roundTrip(NewDetailedError(code, "no detail", &codecPing{}))
+	if detailed, ok := err.(*DetailedError); !ok || detailed.Message != "no detail" || detailed.Detail != nil {
+		t.Fatalf("unexpected %#v", err)
+	}
+	err = roundTrip(vactor.NewVAError(ErrorCodeActorTypeNotHosted))
+	if detailed, ok := err.(*DetailedError); !ok || detailed.Code() != ErrorCodeActorTypeNotHosted || detailed.Message != "" {
+		t.Fatalf("unexpected %#v", err)
+	}
+	// 旧节点只带 ErrorCode
+	if err := s.clusterNet.responseErrorFromProto(2, &protocol.Response{ErrorCode: protocol.ErrorCode(ErrorCodeMessageSendFail)}); err == nil || err.Code() != ErrorCodeMessageSendFail {
+		t.Fatalf("unexpected %v", err)
+	}
+}
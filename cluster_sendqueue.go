@@ -0,0 +1,89 @@
+package dvactor
+
+import (
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// pkgTypePriorities 走高优先级通道的 PkgType：控制帧与响应插到普通数据之前写出，也不受 SendLimit 限制。
+// 未列出的走普通通道，同一连接上保持发送顺序；跨通道不保证顺序，高优先级帧会越过同一连接上更早发出的普通信封。
+//   - 注册握手帧经 sendControl 发送，重连时不会排在旧连接残留的数据之后。
+//   - watch/unwatch 与数据先后无关。
+//   - 流的信用不能排在积压的数据之后，否则写端会停等；Open/Data/Close 之间要保持顺序，只能走普通通道。
+//   - 响应（含异步响应）不能被大批数据拖到请求超时；代价是响应可能先于同一 actor 之前发出的 Send 到达，
+//     需要两者有序的调用方应让对端在收到响应后再依赖那些 Send。
+//
+// 集群层目前没有心跳包（链路存活由连接断开判断），新增心跳等控制包时应登记到这里。
+var pkgTypePriorities = map[protocol.PkgType]netConnect.Priority{
+	protocol.PkgType_PkgTypeRegisterSystemReq: netConnect.PriorityHigh,
+	protocol.PkgType_PkgTypeRegisterChallenge: netConnect.PriorityHigh,
+	protocol.PkgType_PkgTypeRegisterAuth:      netConnect.PriorityHigh,
+	protocol.PkgType_PkgTypeRegisterSystemRsp: netConnect.PriorityHigh,
+	protocol.PkgType_PkgTypeEnvelopeWatch:     netConnect.PriorityHigh,
+	protocol.PkgType_PkgTypeStreamCredit:      netConnect.PriorityHigh,
+	// 响应
+	protocol.PkgType_PkgTypeEnvelopeResponse:      netConnect.PriorityHigh,
+	protocol.PkgType_PkgTypeEnvelopeResponseAsync: netConnect.PriorityHigh,
+}
+
+// sendControl 在注册完成前直接经 link 发送握手包，按 pkgTypePriorities 选通道；不经过 doSend 的能力与合批判断。
+func sendControl(link linkSender, pkgType protocol.PkgType, pkg proto.Message) error {
+	buf := netConnect.GetBuffer()
+	var err error
+	buf.B, err = proto.MarshalOptions{}.MarshalAppend(buf.B, pkg)
+	if err != nil {
+		netConnect.PutBuffer(buf)
+		return err
+	}
+	buf.Priority = pkgTypePriorities[pkgType]
+	return link.SendBuffer(uint32(pkgType), buf)
+}
+
+// sendLimit 发往 config 节点的发送队列上限：SystemConfig 覆盖 ClusterConfig。
+// 队首丢弃的帧记入死信，配置里的 OnDrop 仍会被调用。
+func (cn *clusterNet) sendLimit(config *SystemConfig) netConnect.SendLimit {
+	limit := cn.clusterConfig.SendLimit
+	if config.SendLimit != nil {
+		limit = *config.SendLimit
+	}
+	onDrop := limit.OnDrop
+	limit.OnDrop = func(frames int) {
+		cn.droppedFrames(config.SystemId, frames)
+		if onDrop != nil {
+			onDrop(frames)
+		}
+	}
+	return limit
+}
+
+// applySendLimit 对支持发送队列的连接设置上限；server 侧在注册后才知道对端，因此由 register 调用。
+func (cn *clusterNet) applySendLimit(conn netConnect.Conn, config *SystemConfig) {
+	if qc, ok := conn.(netConnect.QueuedConn); ok {
+		qc.SetSendLimit(cn.sendLimit(config))
+	}
+}
+
+// SendQueueStats 按节点汇总该节点所有连接的发送队列。
+func (cn *clusterNet) SendQueueStats() map[vactor.SystemId]netConnect.SendQueueStats {
+	stats := make(map[vactor.SystemId]netConnect.SendQueueStats)
+	for systemId, info := range cn.systemInfos {
+		info.lock.RLock()
+		conns := info.conns()
+		info.lock.RUnlock()
+		for _, conn := range conns {
+			qc, ok := conn.(netConnect.QueuedConn)
+			if !ok {
+				continue
+			}
+			st := qc.SendQueueStats()
+			total := stats[systemId]
+			total.Frames += st.Frames
+			total.Bytes += st.Bytes
+			total.Dropped += st.Dropped
+			stats[systemId] = total
+		}
+	}
+	return stats
+}
@@ -0,0 +1,204 @@
+package dvactor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+)
+
+func fillSendQueue(t *testing.T, sq *netConnect.SendQueue, frames ...string) {
+	for _, f := range frames {
+		if err := sq.Enqueue([]byte(f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSendQueueOverflowPolicies(t *testing.T) {
+	// 不设上限时行为与原先的无界队列一致
+	sq := netConnect.NewSendQueue()
+	fillSendQueue(t, sq, "aaaa", "bbbb", "cccc")
+	if stats := sq.Stats(); stats.Frames != 3 || stats.Bytes != 12 {
+		t.Fatalf("unbounded stats mismatch: %+v", stats)
+	}
+
+	// 失败：超出高水位直接报错，队列不变
+	sq = netConnect.NewSendQueue()
+	sq.SetSendLimit(netConnect.SendLimit{HighWatermark: 8, Policy: netConnect.OverflowFail})
+	fillSendQueue(t, sq, "aaaa", "bbbb")
+	if err := sq.Enqueue([]byte("cccc")); !errors.Is(err, netConnect.ErrSendQueueFull) {
+		t.Fatalf("expect ErrSendQueueFull, got %v", err)
+	}
+
+	// 丢最新：返回 ErrSendQueueDropped，计入 Dropped
+	sq = netConnect.NewSendQueue()
+	sq.SetSendLimit(netConnect.SendLimit{HighWatermark: 8, Policy: netConnect.OverflowDropNewest})
+	fillSendQueue(t, sq, "aaaa", "bbbb")
+	if err := sq.Enqueue([]byte("cccc")); !errors.Is(err, netConnect.ErrSendQueueDropped) {
+		t.Fatalf("expect ErrSendQueueDropped, got %v", err)
+	}
+	items, _ := sq.TryDequeueBatch()
+	if len(items) != 2 || string(items[1].([]byte)) != "bbbb" || sq.Stats().Dropped != 1 {
+		t.Fatalf("drop newest mismatch: %v %+v", items, sq.Stats())
+	}
+
+	// 丢最旧：队首让位给新帧，被丢的帧经 OnDrop 通知
+	sq = netConnect.NewSendQueue()
+	var onDrop int
+	sq.SetSendLimit(netConnect.SendLimit{HighWatermark: 8, Policy: netConnect.OverflowDropOldest, OnDrop: func(frames int) { onDrop += frames }})
+	fillSendQueue(t, sq, "aaaa", "bbbb", "cccc")
+	items, _ = sq.TryDequeueBatch()
+	if len(items) != 2 || string(items[0].([]byte)) != "bbbb" || string(items[1].([]byte)) != "cccc" || sq.Stats().Dropped != 1 || onDrop != 1 {
+		t.Fatalf("drop oldest mismatch: %v %+v", items, sq.Stats())
+	}
+	if stats := sq.Stats(); stats.Frames != 0 || stats.Bytes != 0 {
+		t.Fatalf("depth should be 0 after dequeue: %+v", stats)
+	}
+
+	// 队列为空时超过上限的单帧也放行，避免永远发不出去
+	sq = netConnect.NewSendQueue()
+	sq.SetSendLimit(netConnect.SendLimit{HighWatermark: 2, Policy: netConnect.OverflowFail})
+	fillSendQueue(t, sq, "large frame")
+}
+
+func TestSendQueueBlock(t *testing.T) {
+	sq := netConnect.NewSendQueue()
+	sq.SetSendLimit(netConnect.SendLimit{HighWatermark: 8, BlockTimeout: 50 * time.Millisecond})
+	fillSendQueue(t, sq, "aaaa", "bbbb")
+
+	// 无人消费：超时失败
+	start := time.Now()
+	if err := sq.Enqueue([]byte("cccc")); !errors.Is(err, netConnect.ErrSendQueueFull) {
+		t.Fatalf("expect ErrSendQueueFull, got %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("should block until timeout")
+	}
+
+	// 消费腾出空间后放行
+	sq.SetSendLimit(netConnect.SendLimit{HighWatermark: 8, BlockTimeout: 5 * time.Second})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sq.Dequeue()
+	}()
+	if err := sq.Enqueue([]byte("cccc")); err != nil {
+		t.Fatal(err)
+	}
+	if stats := sq.Stats(); stats.Frames != 2 {
+		t.Fatalf("stats mismatch: %+v", stats)
+	}
+
+	// 关闭时唤醒阻塞的调用方
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sq.Close()
+	}()
+	if err := sq.Enqueue([]byte("dddd")); err == nil {
+		t.Fatal("enqueue on closed queue should fail")
+	}
+}
+
+// 集群链路按 SystemConfig 覆盖的上限创建发送队列，深度可按节点读取
+func TestSendQueueStatsPerLink(t *testing.T) {
+	limit := &netConnect.SendLimit{HighWatermark: 1 << 20, Policy: netConnect.OverflowFail}
+	systems := newInprocCluster(t, 3, nil, func(c *ClusterConfig) {
+		c.SendLimit = netConnect.SendLimit{HighWatermark: 4 << 20}
+		c.SystemConfigs[2].SendLimit = limit
+	}, nil)
+	cn := systems[0].(*system).clusterNet
+	if got := cn.sendLimit(cn.systemInfos[3].config); got.HighWatermark != limit.HighWatermark || got.Policy != limit.Policy {
+		t.Fatalf("system 3 limit should be overridden: %+v", got)
+	}
+	if got := cn.sendLimit(cn.systemInfos[2].config); got.HighWatermark != 4<<20 {
+		t.Fatalf("system 2 limit should use cluster default: %+v", got)
+	}
+	stats := systems[0].SendQueueStats()
+	if _, ok := stats[2]; !ok {
+		t.Fatalf("stats should include system 2: %v", stats)
+	}
+	if _, ok := stats[3]; !ok {
+		t.Fatalf("stats should include system 3: %v", stats)
+	}
+}
+
+// 发送队列丢弃的帧计入死信：丢最新的带原信封，丢最旧的合成一条计数记录
+func TestSendQueueDropDeadLetter(t *testing.T) {
+	queue := make(chan *DeadLetter, 8)
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1}, {SystemId: 2}},
+		SendLimit:     netConnect.SendLimit{HighWatermark: 8, Policy: netConnect.OverflowDropOldest},
+		DeadLetter:    &DeadLetterConfig{Queue: queue},
+	}).(*system)
+	cn := s.clusterNet
+	// 一次丢多帧只合成一条计数记录
+	cn.sendLimit(cn.systemInfos[2].config).OnDrop(2)
+	if dl := waitDeadLetter(t, queue); dl.Reason != DeadLetterSendQueueDropped || dl.SystemId != 2 || dl.Data != nil || dl.Count != 2 {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+	if len(queue) != 0 {
+		t.Fatalf("drop should produce a single record, got %v more", len(queue))
+	}
+	pkg := &protocol.PkgEnvelopeSend{ToActorRef: &protocol.ActorRef{ActorId: "a"}}
+	cn.outboundDeadLetter(2, uint32(protocol.PkgType_PkgTypeEnvelopeSend), pkg, vactor.NewVAError(ErrorCodeSendQueueDropped))
+	if dl := waitDeadLetter(t, queue); dl.Reason != DeadLetterSendQueueDropped || dl.Data == nil || dl.Count != 1 || dl.ToActorRefs[0].GetActorId() != "a" {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+	if n := s.DeadLetterStats()[DeadLetterSendQueueDropped]; n != 3 {
+		t.Fatalf("expect 3 dropped, got %v", n)
+	}
+}
+
+func priorityBuffer(data string, priority netConnect.Priority) *netConnect.Buffer {
+	buf := netConnect.GetBuffer()
+	buf.B = append(buf.B, data...)
+	buf.Priority = priority
+	(*netConnect.FrameEncoder)(nil).PackBuffer(1, buf)
+	return buf
+}
+
+// 高优先级帧插到积压的普通帧之前，且不受高水位限制
+func TestSendQueuePriorityLanes(t *testing.T) {
+	sq := netConnect.NewSendQueue()
+	sq.SetSendLimit(netConnect.SendLimit{HighWatermark: 16, Policy: netConnect.OverflowFail})
+	fillSendQueue(t, sq, "bulk-1", "bulk-2")
+	if err := sq.Enqueue([]byte("bulk-3 over limit")); !errors.Is(err, netConnect.ErrSendQueueFull) {
+		t.Fatalf("normal lane should be limited, got %v", err)
+	}
+	for _, data := range []string{"response-1", "response-2"} {
+		if err := sq.Enqueue(priorityBuffer(data, netConnect.PriorityHigh)); err != nil {
+			t.Fatalf("high lane should bypass limit: %v", err)
+		}
+	}
+	if stats := sq.Stats(); stats.Frames != 4 {
+		t.Fatalf("depth should count both lanes: %+v", stats)
+	}
+
+	first, _ := sq.Dequeue()
+	if buf, ok := first.(*netConnect.Buffer); !ok || string(buf.Data()) != "response-1" {
+		t.Fatalf("high priority frame should come first, got %v", first)
+	}
+	items, _ := sq.TryDequeueBatch()
+	if len(items) != 3 {
+		t.Fatalf("expect 3 frames, got %v", len(items))
+	}
+	if buf, ok := items[0].(*netConnect.Buffer); !ok || string(buf.Data()) != "response-2" {
+		t.Fatalf("high lane should drain before normal lane, got %v", items[0])
+	}
+	if string(items[1].([]byte)) != "bulk-1" || string(items[2].([]byte)) != "bulk-2" {
+		t.Fatalf("normal lane order mismatch: %v", items[1:])
+	}
+	// 控制帧与响应走高优先级，数据走普通通道
+	if pkgTypePriorities[protocol.PkgType_PkgTypeEnvelopeWatch] != netConnect.PriorityHigh ||
+		pkgTypePriorities[protocol.PkgType_PkgTypeRegisterSystemRsp] != netConnect.PriorityHigh ||
+		pkgTypePriorities[protocol.PkgType_PkgTypeEnvelopeResponse] != netConnect.PriorityHigh ||
+		pkgTypePriorities[protocol.PkgType_PkgTypeEnvelopeResponseAsync] != netConnect.PriorityHigh ||
+		pkgTypePriorities[protocol.PkgType_PkgTypeEnvelopeRequest] != netConnect.PriorityNormal ||
+		pkgTypePriorities[protocol.PkgType_PkgTypeEnvelopeBatchSend] != netConnect.PriorityNormal {
+		t.Fatal("pkg type priorities mismatch")
+	}
+}
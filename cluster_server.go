@@ -2,9 +2,9 @@ package dvactor
 
 import (
 	"fmt"
+	"sync"
 	"sync/atomic"
 
-	socketNetConnect "github.com/kofplayer/dvactor/engine/net/connect/socket"
 	netServer "github.com/kofplayer/dvactor/engine/net/server"
 	netSession "github.com/kofplayer/dvactor/engine/net/session"
 	"github.com/kofplayer/dvactor/protocol"
@@ -15,12 +15,18 @@ import (
 type clusterServer struct {
 	svr netServer.NetServer
 	cn  *clusterNet
+	// 各 session 的分片重组状态，断线时清理
+	chunkLock sync.Mutex
+	chunks    map[netSession.NetSession]*chunkAssembler
 }
 
 func (svr *clusterServer) OnConnect(s netSession.NetSession) {
 }
 
 func (svr *clusterServer) OnDisconnect(s netSession.NetSession) {
+	svr.chunkLock.Lock()
+	delete(svr.chunks, s)
+	svr.chunkLock.Unlock()
 	bind := s.GetBindObject()
 	if bind == nil {
 		return
@@ -31,18 +37,31 @@ func (svr *clusterServer) OnDisconnect(s netSession.NetSession) {
 	}
 	info.lock.Lock()
 	defer info.lock.Unlock()
+	info.dropBatcher(s)
+	if info.unregisterStripe(s) {
+		s.SetBindObject(nil)
+		svr.cn.localSystem.LogInfo("system %v stripe disconnected", info.config.SystemId)
+		return
+	}
 	if info.session != s {
 		return
 	}
 	s.SetBindObject(nil)
 	info.session = nil
+	info.version = 0
+	info.capabilities = 0
 	atomic.AddInt32(&svr.cn.connectedSystemCount, -1)
 	svr.cn.localSystem.LogInfo("system %v disconnected", info.config.SystemId)
+	svr.cn.localSystem.streams.peerLost(info.config.SystemId)
+	svr.cn.localSystem.requests.peerLost(info.config.SystemId)
 }
 
 func (svr *clusterServer) OnMessage(s netSession.NetSession, msgId uint32, data []byte) error {
 	switch protocol.PkgType(msgId) {
 	case protocol.PkgType_PkgTypeRegisterSystemReq:
+		if s.GetBindObject() != nil {
+			return fmt.Errorf("session %v duplicate register", s.GetID())
+		}
 		req := &protocol.PkgRegisterSystemReq{}
 		err := proto.Unmarshal(data, req)
 		if err != nil {
@@ -55,27 +74,124 @@ func (svr *clusterServer) OnMessage(s netSession.NetSession, msgId uint32, data
 		if info.passive {
 			return fmt.Errorf("systemId %v is passive", req.SystemId)
 		}
-		info.lock.Lock()
-		defer info.lock.Unlock()
-		if info.session != nil {
-			return fmt.Errorf("systemId %v alreay register", req.SystemId)
+		if err := svr.cn.tls.verifyPeer(s, info.config.SystemId); err != nil {
+			return err
 		}
-		info.session = s
-		s.SetBindObject(info)
-		atomic.AddInt32(&svr.cn.connectedSystemCount, 1)
-		rsp := &protocol.PkgRegisterSystemRsp{
-			ErrorCode: protocol.ErrorCode_ErrorCodeSuccess,
+		version, err := negotiateVersion(req.ProtocolVersion, req.MinProtocolVersion)
+		if err != nil {
+			svr.sendRegisterRsp(s, protocol.ErrorCode(ErrorCodeProtocolIncompatible), nil, nil)
+			return fmt.Errorf("systemId %v %v", req.SystemId, err)
+		}
+		capabilities := svr.cn.localCapabilities() & Capability(req.Capabilities)
+		if !svr.cn.authEnabled() {
+			return svr.register(s, info, req.Stripe, req.Stripes, version, capabilities, req.MessageTypes, nil)
+		}
+		if len(req.ClientNonce) != authNonceSize {
+			return fmt.Errorf("systemId %v register without auth", req.SystemId)
+		}
+		state := &registerAuthState{
+			info:         info,
+			clientNonce:  req.ClientNonce,
+			serverNonce:  newAuthNonce(),
+			clientHello:  authHello{version: req.ProtocolVersion, minVersion: req.MinProtocolVersion, capabilities: req.Capabilities},
+			stripe:       req.Stripe,
+			stripes:      req.Stripes,
+			version:      version,
+			capabilities: capabilities,
+			messageTypes: req.MessageTypes,
 		}
-		data, err := proto.Marshal(rsp)
+		s.SetBindObject(state)
+		return sendControl(s, protocol.PkgType_PkgTypeRegisterChallenge, &protocol.PkgRegisterChallenge{
+			ServerNonce: state.serverNonce,
+		})
+	case protocol.PkgType_PkgTypeRegisterAuth:
+		state, ok := s.GetBindObject().(*registerAuthState)
+		if !ok {
+			return fmt.Errorf("session %v auth without challenge", s.GetID())
+		}
+		auth := &protocol.PkgRegisterAuth{}
+		err := proto.Unmarshal(data, auth)
 		if err != nil {
 			return err
 		}
-		svr.cn.localSystem.LogInfo("system %v connected", req.SystemId)
-		s.SendMessage(uint32(protocol.PkgType_PkgTypeRegisterSystemRsp), data)
-		return nil
+		systemId := state.info.config.SystemId
+		localSystemId := svr.cn.clusterConfig.LocalSystemId
+		if !svr.cn.verifyAuth(auth.Mac, authRoleClient, systemId, localSystemId, state.clientNonce, state.serverNonce, state.clientHello) {
+			svr.sendRegisterRsp(s, protocol.ErrorCode(ErrorCodeRegisterAuthFail), nil, nil)
+			return fmt.Errorf("systemId %v auth fail", systemId)
+		}
+		return svr.register(s, state.info, state.stripe, state.stripes, state.version, state.capabilities, state.messageTypes, svr.cn.signAuth(authRoleServer, localSystemId, systemId, state.serverNonce, state.clientNonce, svr.cn.localAuthHello()))
 	default:
-		return svr.cn.OnMessage(msgId, data)
+		// 注册（及认证）完成前不处理任何信封
+		info, ok := s.GetBindObject().(*systemInfo)
+		if !ok {
+			return fmt.Errorf("session %v not registered, reject pkg %v", s.GetID(), msgId)
+		}
+		if protocol.PkgType(msgId) == protocol.PkgType_PkgTypeChunk {
+			return svr.chunkAssembler(s, info.config.SystemId).onChunk(data)
+		}
+		return svr.cn.OnMessage(info.config.SystemId, msgId, data)
+	}
+}
+
+// chunkAssembler 返回 s 的分片重组状态，首次收到分片时创建。
+func (svr *clusterServer) chunkAssembler(s netSession.NetSession, systemId vactor.SystemId) *chunkAssembler {
+	svr.chunkLock.Lock()
+	defer svr.chunkLock.Unlock()
+	a, ok := svr.chunks[s]
+	if !ok {
+		a = newChunkAssembler(svr.cn, systemId)
+		svr.chunks[s] = a
 	}
+	return a
+}
+
+// register 把 session 绑定到 systemInfo 并回复成功；mac 为开启认证时 server 的应答证明。
+// stripe > 0 的是附加连接，只登记到 stripeSessions，不影响链路状态与 connectedSystemCount。
+// 主连接先检查对端的消息类型表 messageTypes，RegistryCheckRefuse 下有冲突即拒绝。
+func (svr *clusterServer) register(s netSession.NetSession, info *systemInfo, stripe, stripes uint32, version uint32, capabilities Capability, messageTypes []*protocol.MessageTypeEntry, mac []byte) error {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+	if stripe > 0 {
+		if err := info.registerStripe(s, stripe, stripes, capabilities); err != nil {
+			return err
+		}
+		s.SetFrameEncoder(svr.cn.linkFrameEncoder(capabilities))
+		svr.cn.applySendLimit(s.GetConn(), info.config)
+		s.SetBindObject(info)
+		svr.cn.localSystem.LogInfo("system %v stripe %v/%v connected", info.config.SystemId, stripe, stripes)
+		return svr.sendRegisterRsp(s, protocol.ErrorCode_ErrorCodeSuccess, mac, nil)
+	}
+	if info.session != nil {
+		return fmt.Errorf("systemId %v alreay register", info.config.SystemId)
+	}
+	if err := svr.cn.localSystem.checkMessageTypes(info.config.SystemId, messageTypes); err != nil {
+		svr.sendRegisterRsp(s, protocol.ErrorCode(ErrorCodeMessageTypeConflict), nil, nil)
+		return err
+	}
+	info.session = s
+	info.version = version
+	info.capabilities = capabilities
+	if capabilities&CapabilityMultiConn != 0 {
+		info.growStripes(stripes)
+	}
+	s.SetFrameEncoder(svr.cn.linkFrameEncoder(capabilities))
+	svr.cn.applySendLimit(s.GetConn(), info.config)
+	s.SetBindObject(info)
+	atomic.AddInt32(&svr.cn.connectedSystemCount, 1)
+	svr.cn.localSystem.LogInfo("system %v connected, protocol version %v, capabilities %#x", info.config.SystemId, version, capabilities)
+	return svr.sendRegisterRsp(s, protocol.ErrorCode_ErrorCodeSuccess, mac, svr.cn.localSystem.messageTypeEntries())
+}
+
+func (svr *clusterServer) sendRegisterRsp(s netSession.NetSession, errorCode protocol.ErrorCode, mac []byte, messageTypes []*protocol.MessageTypeEntry) error {
+	return sendControl(s, protocol.PkgType_PkgTypeRegisterSystemRsp, &protocol.PkgRegisterSystemRsp{
+		ErrorCode:          errorCode,
+		Mac:                mac,
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+		Capabilities:       uint64(svr.cn.localCapabilities()),
+		MessageTypes:       messageTypes,
+	})
 }
 
 func (svr *clusterServer) Start() error {
@@ -90,13 +206,14 @@ func (svr *clusterServer) Start() error {
 
 func NewServer(cn *clusterNet) *clusterServer {
 	svr := &clusterServer{
-		cn: cn,
+		cn:     cn,
+		chunks: make(map[netSession.NetSession]*chunkAssembler),
 	}
-	port := cn.systemInfos[cn.clusterConfig.LocalSystemId].config.Port
 	svr.svr = netServer.NewNetServer()
-	acceptor := socketNetConnect.NewAcceptor()
-	acceptor.SetAddress("", port)
-	svr.svr.SetAcceptor(acceptor)
+	svr.svr.SetAcceptor(cn.newAcceptor(cn.systemInfos[cn.clusterConfig.LocalSystemId].config))
+	svr.svr.SetCompressor(cn.compressor)
+	svr.svr.SetMaxFrameSize(cn.clusterConfig.MaxFrameSize)
+	svr.svr.SetOnFrameRejected(cn.onFrameRejected)
 	svr.svr.SetOnConnect(svr.OnConnect)
 	svr.svr.SetOnDisconnect(func(s netSession.NetSession) {
 		svr.OnDisconnect(s)
@@ -0,0 +1,266 @@
+package dvactor
+
+import (
+	"fmt"
+
+	netClient "github.com/kofplayer/dvactor/engine/net/client"
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	netSession "github.com/kofplayer/dvactor/engine/net/session"
+	"github.com/kofplayer/vactor"
+)
+
+// maxConnectionsPerPeer 限制对端声明的连接数，防止注册包让 server 分配过大的表。
+const maxConnectionsPerPeer = 64
+
+// linkSender 是 NetClient 与 NetSession 共有的发送接口。
+type linkSender interface {
+	SendBuffer(msgId uint32, buf *netConnect.Buffer) error
+}
+
+// connectionsPerPeer 本节点作为 client 时每个对端的连接数。
+func (cn *clusterNet) connectionsPerPeer() int {
+	n := cn.clusterConfig.ConnectionsPerPeer
+	if n < 1 {
+		return 1
+	}
+	return min(n, maxConnectionsPerPeer)
+}
+
+// envelopeGroupSlot 返回选择连接用的 GroupSlot：单目标信封取 ToActorRef 的 GroupSlot，
+// 多目标信封只有全部目标在同一 GroupSlot 时才取该值，否则返回 0（多连接时由 splitByStripe 先按连接拆开）。
+func envelopeGroupSlot(envelope vactor.Envelope) vactor.GroupSlot {
+	var refs []vactor.ActorRef
+	switch e := envelope.(type) {
+	case *vactor.EnvelopeSend:
+		refs = []vactor.ActorRef{e.ToActorRef}
+	case *vactor.EnvelopeRequestAsync:
+		refs = []vactor.ActorRef{e.ToActorRef}
+	case *vactor.EnvelopeResponseAsync:
+		refs = []vactor.ActorRef{e.ToActorRef}
+	case *vactor.EnvelopeRequest:
+		refs = []vactor.ActorRef{e.ToActorRef}
+	case *vactor.EnvelopeResponse:
+		refs = []vactor.ActorRef{e.ToActorRef}
+	case *vactor.EnvelopeWatch:
+		refs = []vactor.ActorRef{e.ToActorRef}
+	case *vactor.EnvelopeFireNotify:
+		refs = []vactor.ActorRef{e.ToActorRef}
+	case *vactor.EnvelopeBatchSend:
+		refs = e.ToActorRefs
+	case *vactor.EnvelopeNotify:
+		refs = e.ToActorRefs
+	}
+	var slot vactor.GroupSlot
+	for i, ref := range refs {
+		if ref == nil {
+			return 0
+		}
+		if i == 0 {
+			slot = ref.GetGroupSlot()
+		} else if ref.GetGroupSlot() != slot {
+			return 0
+		}
+	}
+	return slot
+}
+
+// stripeCount 当前链路的连接数（含主连接）；未协商 CapabilityMultiConn 时为 1。调用方须持有 lock。
+func (info *systemInfo) stripeCount() int {
+	if info.capabilities&CapabilityMultiConn == 0 {
+		return 1
+	}
+	if info.passive {
+		return max(len(info.stripeClis), 1)
+	}
+	return max(len(info.stripeSessions), 1)
+}
+
+// stripeIndex slot 固定使用的连接序号，0 为主连接。调用方须持有 lock。
+func (info *systemInfo) stripeIndex(slot vactor.GroupSlot) int {
+	n := info.stripeCount()
+	if n <= 1 {
+		return 0
+	}
+	return int(uint32(slot) % uint32(n))
+}
+
+// link 返回发送 slot 上信封所用的连接：按连接数取模固定到一条连接，该连接未就绪时返回 nil，
+// 不改走其他连接，否则同一 slot 的信封可能越过仍在另一条连接上排队的前序信封。
+// 主连接断开时返回 nil（此时链路能力已清零，附加连接也不再使用）。调用方须持有 lock。
+func (info *systemInfo) link(slot vactor.GroupSlot) linkSender {
+	if info.passive {
+		if info.cli == nil {
+			return nil
+		}
+		if i := info.stripeIndex(slot); i > 0 {
+			if cli := info.stripeClis[i]; cli != nil {
+				return cli
+			}
+			return nil
+		}
+		return info.cli
+	}
+	if info.session == nil {
+		return nil
+	}
+	if i := info.stripeIndex(slot); i > 0 {
+		if s := info.stripeSessions[i]; s != nil {
+			return s
+		}
+		return nil
+	}
+	return info.session
+}
+
+// stripesReady 附加连接是否全部就绪；未协商多连接时总是 true。调用方须持有 lock。
+func (info *systemInfo) stripesReady() bool {
+	for i := 1; i < info.stripeCount(); i++ {
+		if info.passive && info.stripeClis[i] == nil || !info.passive && info.stripeSessions[i] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// stripesReady 所有已连接节点的附加连接是否全部就绪，Start 据此等待，避免启动后的发送落在未就绪的连接上。
+func (cn *clusterNet) stripesReady() bool {
+	for _, info := range cn.systemInfos {
+		info.lock.RLock()
+		ready := info.stripesReady()
+		info.lock.RUnlock()
+		if !ready {
+			return false
+		}
+	}
+	return true
+}
+
+// splitByStripe 多连接时把 EnvelopeBatchSend/EnvelopeNotify 的目标按所在连接拆成多份，slots 为每份所在连接上的一个 slot；
+// 不需要拆时返回 nil。这样多目标信封与发往同一 slot 的单目标信封走同一条连接，不会互相越过。
+func (cn *clusterNet) splitByStripe(systemId vactor.SystemId, envelope vactor.Envelope) ([]vactor.Envelope, []vactor.GroupSlot) {
+	var refs []vactor.ActorRef
+	switch e := envelope.(type) {
+	case *vactor.EnvelopeBatchSend:
+		refs = e.ToActorRefs
+	case *vactor.EnvelopeNotify:
+		refs = e.ToActorRefs
+	default:
+		return nil, nil
+	}
+	info := cn.systemInfos[systemId]
+	info.lock.RLock()
+	n := info.stripeCount()
+	info.lock.RUnlock()
+	if n <= 1 || len(refs) == 0 {
+		return nil, nil
+	}
+	groups := make(map[int]int)
+	var parts [][]vactor.ActorRef
+	var slots []vactor.GroupSlot
+	for _, ref := range refs {
+		var slot vactor.GroupSlot
+		if ref != nil {
+			slot = ref.GetGroupSlot()
+		}
+		i := int(uint32(slot) % uint32(n))
+		g, ok := groups[i]
+		if !ok {
+			g = len(parts)
+			groups[i] = g
+			parts = append(parts, nil)
+			slots = append(slots, slot)
+		}
+		parts[g] = append(parts[g], ref)
+	}
+	envelopes := make([]vactor.Envelope, len(parts))
+	for g, part := range parts {
+		switch e := envelope.(type) {
+		case *vactor.EnvelopeBatchSend:
+			c := *e
+			c.ToActorRefs = part
+			envelopes[g] = &c
+		case *vactor.EnvelopeNotify:
+			c := *e
+			c.ToActorRefs = part
+			envelopes[g] = &c
+		}
+	}
+	return envelopes, slots
+}
+
+// conns 返回与该节点当前所有连接（主连接在前）。调用方须持有 lock。
+func (info *systemInfo) conns() []netConnect.Conn {
+	var conns []netConnect.Conn
+	if info.cli != nil {
+		conns = append(conns, info.cli.GetConnector())
+	} else if info.session != nil {
+		conns = append(conns, info.session.GetConn())
+	}
+	for _, cli := range info.stripeClis {
+		if cli != nil {
+			conns = append(conns, cli.GetConnector())
+		}
+	}
+	for _, s := range info.stripeSessions {
+		if s != nil {
+			conns = append(conns, s.GetConn())
+		}
+	}
+	return conns
+}
+
+// startStripeClients 在 ConnectionsPerPeer > 1 时为 systemId 启动附加连接 1..N-1，
+// 各自等主连接协商出 CapabilityMultiConn 后才连接。
+func (cn *clusterNet) startStripeClients(systemId vactor.SystemId) {
+	n := cn.connectionsPerPeer()
+	if n <= 1 {
+		return
+	}
+	info := cn.systemInfos[systemId]
+	info.lock.Lock()
+	info.stripeClis = make([]netClient.NetClient, n)
+	info.lock.Unlock()
+	for stripe := 1; stripe < n; stripe++ {
+		client := NewClusterClient(cn, systemId)
+		client.stripe = stripe
+		client.Start()
+	}
+}
+
+// growStripes 在主连接注册时按对端声明的连接数分配 stripeSessions，slot 到连接的映射从此固定，
+// 不会在附加连接陆续接入时改变。调用方须持有 lock。
+func (info *systemInfo) growStripes(stripes uint32) {
+	if stripes > maxConnectionsPerPeer || uint32(len(info.stripeSessions)) >= stripes {
+		return
+	}
+	sessions := make([]netSession.NetSession, stripes)
+	copy(sessions, info.stripeSessions)
+	info.stripeSessions = sessions
+}
+
+// registerStripe 把附加连接绑定到 systemInfo 的第 stripe 个位置，调用方须持有 lock。
+func (info *systemInfo) registerStripe(s netSession.NetSession, stripe, stripes uint32, capabilities Capability) error {
+	if capabilities&CapabilityMultiConn == 0 {
+		return fmt.Errorf("systemId %v stripe %v without multi conn capability", info.config.SystemId, stripe)
+	}
+	if stripes > maxConnectionsPerPeer || stripe >= stripes {
+		return fmt.Errorf("systemId %v invalid stripe %v/%v", info.config.SystemId, stripe, stripes)
+	}
+	info.growStripes(stripes)
+	if info.stripeSessions[stripe] != nil {
+		return fmt.Errorf("systemId %v stripe %v alreay register", info.config.SystemId, stripe)
+	}
+	info.stripeSessions[stripe] = s
+	return nil
+}
+
+// unregisterStripe 解除 s 所在的附加连接，s 不是附加连接时返回 false。调用方须持有 lock。
+func (info *systemInfo) unregisterStripe(s netSession.NetSession) bool {
+	for i, session := range info.stripeSessions {
+		if session == s {
+			info.stripeSessions[i] = nil
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package dvactor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// waitStripes 等到 info 的附加连接全部就绪
+func waitStripes(t *testing.T, info *systemInfo, n int) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		info.lock.RLock()
+		connected := 0
+		for _, cli := range info.stripeClis {
+			if cli != nil {
+				connected++
+			}
+		}
+		for _, s := range info.stripeSessions {
+			if s != nil {
+				connected++
+			}
+		}
+		info.lock.RUnlock()
+		if connected == n-1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("system %v stripes not connected: %v/%v", info.config.SystemId, connected, n-1)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestConnectionsPerPeer(t *testing.T) {
+	const stripes = 3
+	actorType := ActorTypeStart + 1
+	received := make(chan string, 256)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+		c.ConnectionsPerPeer = stripes
+	}, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if msg, ok := ctx.GetMessage().(*protocol.ActorRef); ok {
+					received <- fmt.Sprintf("%v/%v/%v", ctx.GetActorRef().GetSystemId(), ctx.GetActorRef().GetActorId(), msg.GroupSlot)
+				}
+			}
+		})
+	})
+	// 2 主动连接 1：client 侧在 stripeClis，server 侧在 stripeSessions
+	cliInfo := systems[1].(*system).clusterNet.systemInfos[1]
+	sessionInfo := systems[0].(*system).clusterNet.systemInfos[2]
+	waitStripes(t, cliInfo, stripes)
+	waitStripes(t, sessionInfo, stripes)
+
+	// 每个 slot 固定选同一条连接，且 stripes 个连续 slot 用到全部连接
+	for _, info := range []*systemInfo{cliInfo, sessionInfo} {
+		info.lock.RLock()
+		links := map[linkSender]bool{}
+		for slot := vactor.GroupSlot(0); slot < stripes; slot++ {
+			if info.link(slot) != info.link(slot+stripes) {
+				t.Fatalf("slot %v and %v should share a link", slot, slot+stripes)
+			}
+			links[info.link(slot)] = true
+		}
+		info.lock.RUnlock()
+		if len(links) != stripes {
+			t.Fatalf("expect %v links, got %v", stripes, len(links))
+		}
+	}
+
+	// 附加连接未就绪时该 slot 不改走主连接
+	cliInfo.lock.Lock()
+	stripe1 := cliInfo.stripeClis[1]
+	cliInfo.stripeClis[1] = nil
+	if cliInfo.link(1) != nil || cliInfo.link(0) == nil {
+		t.Fatal("slot on a missing stripe should not fall back to the main link")
+	}
+	cliInfo.stripeClis[1] = stripe1
+	cliInfo.lock.Unlock()
+
+	// 目标跨连接的多目标信封按连接拆开，每份的 slot 落在对应连接上
+	cn := systems[1].(*system).clusterNet
+	refs := []vactor.ActorRef{
+		&vactor.ActorRefImpl{SystemId: 1, GroupSlot: 1},
+		&vactor.ActorRefImpl{SystemId: 1, GroupSlot: 2},
+		&vactor.ActorRefImpl{SystemId: 1, GroupSlot: 4},
+	}
+	parts, slots := cn.splitByStripe(1, &vactor.EnvelopeBatchSend{ToActorRefs: refs})
+	if len(parts) != 2 || slots[0] != 1 || slots[1] != 2 ||
+		len(parts[0].(*vactor.EnvelopeBatchSend).ToActorRefs) != 2 || len(parts[1].(*vactor.EnvelopeBatchSend).ToActorRefs) != 1 {
+		t.Fatalf("unexpected split %v %v", parts, slots)
+	}
+	if parts, _ := cn.splitByStripe(1, &vactor.EnvelopeSend{ToActorRef: refs[0]}); parts != nil {
+		t.Fatal("single target envelope should not be split")
+	}
+
+	const actors, count = 8, 10
+	want := map[string]bool{}
+	for i, s := range systems {
+		peer := vactor.SystemId(2 - i)
+		for a := 0; a < actors; a++ {
+			ref := s.CreateActorRefEx(peer, actorType, vactor.ActorId(fmt.Sprint("a", a)))
+			for seq := 0; seq < count; seq++ {
+				s.Send(ref, &protocol.ActorRef{GroupSlot: uint32(seq)})
+				want[fmt.Sprintf("%v/a%v/%v", peer, a, seq)] = true
+			}
+		}
+	}
+	for len(want) > 0 {
+		select {
+		case key := <-received:
+			delete(want, key)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing %v messages", len(want))
+		}
+	}
+
+	stats := systems[1].SendQueueStats()
+	if _, ok := stats[1]; !ok {
+		t.Fatalf("expect stats for system 1, got %v", stats)
+	}
+}
+
+func TestEnvelopeGroupSlot(t *testing.T) {
+	ref := func(slot vactor.GroupSlot) vactor.ActorRef {
+		return &vactor.ActorRefImpl{SystemId: 2, GroupSlot: slot}
+	}
+	cases := []struct {
+		envelope vactor.Envelope
+		slot     vactor.GroupSlot
+	}{
+		{&vactor.EnvelopeSend{ToActorRef: ref(5)}, 5},
+		{&vactor.EnvelopeResponse{ToActorRef: ref(7)}, 7},
+		{&vactor.EnvelopeSend{}, 0},
+		{&vactor.EnvelopeBatchSend{ToActorRefs: []vactor.ActorRef{ref(3), ref(3)}}, 3},
+		{&vactor.EnvelopeBatchSend{ToActorRefs: []vactor.ActorRef{ref(3), ref(4)}}, 0},
+		{&vactor.EnvelopeNotify{ToActorRefs: []vactor.ActorRef{ref(9)}}, 9},
+	}
+	for i, c := range cases {
+		if got := envelopeGroupSlot(c.envelope); got != c.slot {
+			t.Fatalf("case %v: expect slot %v, got %v", i, c.slot, got)
+		}
+	}
+}
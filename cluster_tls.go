@@ -0,0 +1,133 @@
+package dvactor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	memNetConnect "github.com/kofplayer/dvactor/engine/net/connect/mem"
+	netSession "github.com/kofplayer/dvactor/engine/net/session"
+	"github.com/kofplayer/vactor"
+)
+
+// TLSConfig 集群链路的 TLS 配置。ClusterConfig.TLS 为 nil 时走明文 TCP。
+//
+// 节点身份：每个节点的证书必须在 DNS SAN 中包含 PeerName(自己的 SystemId)。
+// client 连接对端时以该名字作为 ServerName 校验 server 证书；开启 ClientAuth 后，
+// server 在收到注册请求时同样校验 client 证书与其声明的 SystemId 一致。
+type TLSConfig struct {
+	// CertFile/KeyFile: 本节点证书与私钥（PEM）；Certificate 非 nil 时优先使用
+	CertFile    string
+	KeyFile     string
+	Certificate *tls.Certificate
+	// CAFile: 校验对端证书用的 CA（PEM）；CAPool 非 nil 时优先使用
+	CAFile string
+	CAPool *x509.CertPool
+	// ClientAuth: 开启双向 TLS，server 要求并校验 client 证书
+	ClientAuth bool
+	// PeerName: SystemId 到证书名的映射；nil 时使用 DefaultTLSPeerName
+	PeerName func(systemId vactor.SystemId) string
+	// HandshakeTimeout: TLS 握手超时，0 使用 socketNetConnect.TLSHandshakeTimeout
+	HandshakeTimeout time.Duration
+}
+
+// DefaultTLSPeerName 默认的节点证书名，如 SystemId 2 → "dvactor-system-2"。
+func DefaultTLSPeerName(systemId vactor.SystemId) string {
+	return fmt.Sprintf("dvactor-system-%v", systemId)
+}
+
+func (c *TLSConfig) peerName(systemId vactor.SystemId) string {
+	if c.PeerName != nil {
+		return c.PeerName(systemId)
+	}
+	return DefaultTLSPeerName(systemId)
+}
+
+// clusterTLS 是由 TLSConfig 加载好证书后的运行时配置。
+type clusterTLS struct {
+	config      *TLSConfig
+	certificate tls.Certificate
+	caPool      *x509.CertPool
+}
+
+func newClusterTLS(config *TLSConfig) (*clusterTLS, error) {
+	ct := &clusterTLS{
+		config: config,
+		caPool: config.CAPool,
+	}
+	if config.Certificate != nil {
+		ct.certificate = *config.Certificate
+	} else {
+		if config.CertFile == "" || config.KeyFile == "" {
+			return nil, errors.New("tls certificate not configured")
+		}
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls key pair error: %v", err)
+		}
+		ct.certificate = cert
+	}
+	if ct.caPool == nil {
+		if config.CAFile == "" {
+			return nil, errors.New("tls ca not configured")
+		}
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca error: %v", err)
+		}
+		ct.caPool = x509.NewCertPool()
+		if !ct.caPool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate in %v", config.CAFile)
+		}
+	}
+	return ct, nil
+}
+
+func (ct *clusterTLS) serverConfig() *tls.Config {
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{ct.certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if ct.config.ClientAuth {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = ct.caPool
+	}
+	return cfg
+}
+
+// clientConfig 连接 systemId 时使用，ServerName 固定为对端的证书名而不是 Host。
+func (ct *clusterTLS) clientConfig(systemId vactor.SystemId) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{ct.certificate},
+		RootCAs:      ct.caPool,
+		ServerName:   ct.config.peerName(systemId),
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// verifyPeer 校验注册请求所在连接的 client 证书属于 systemId；未开启 ClientAuth 时不校验。
+// inproc 连接只能来自本进程，不走 TLS，也不校验。
+func (ct *clusterTLS) verifyPeer(s netSession.NetSession, systemId vactor.SystemId) error {
+	if ct == nil || !ct.config.ClientAuth {
+		return nil
+	}
+	if _, ok := s.GetConn().(*memNetConnect.ConnMem); ok {
+		return nil
+	}
+	sc, ok := s.GetConn().(netConnect.SecureConn)
+	if !ok {
+		return fmt.Errorf("systemId %v register on insecure conn", systemId)
+	}
+	certs := sc.PeerCertificates()
+	if len(certs) == 0 {
+		return fmt.Errorf("systemId %v has no client certificate", systemId)
+	}
+	if err := certs[0].VerifyHostname(ct.config.peerName(systemId)); err != nil {
+		return fmt.Errorf("systemId %v certificate mismatch: %v", systemId, err)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package dvactor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	socketNetConnect "github.com/kofplayer/dvactor/engine/net/connect/socket"
+	netSession "github.com/kofplayer/dvactor/engine/net/session"
+	"github.com/kofplayer/vactor"
+)
+
+// 生成自签 CA，并为各 SystemId 签发带 DefaultTLSPeerName SAN 的节点证书
+func newTestTLSConfigs(t *testing.T, systemIds ...vactor.SystemId) map[vactor.SystemId]*TLSConfig {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dvactor-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTpl, caTpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDer)
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	configs := make(map[vactor.SystemId]*TLSConfig)
+	for i, systemId := range systemIds {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := DefaultTLSPeerName(systemId)
+		tpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tpl, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs[systemId] = &TLSConfig{
+			Certificate: &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+			CAPool:      pool,
+			ClientAuth:  true,
+		}
+	}
+	return configs
+}
+
+func freeTestPort(t testing.TB) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+// 启动 TLS acceptor，返回收到首包时对应的 session
+func startTestTLSAcceptor(t *testing.T, ct *clusterTLS) (uint16, chan netSession.NetSession) {
+	port := freeTestPort(t)
+	sessions := make(chan netSession.NetSession, 1)
+	acceptor := socketNetConnect.NewAcceptor()
+	acceptor.SetAddress("127.0.0.1", port)
+	acceptor.SetTLSConfig(ct.serverConfig())
+	acceptor.SetOnAccept(func(conn netConnect.Conn) {
+		s := netSession.NewSessionMgr().NewSession()
+		s.SetConn(conn)
+		conn.SetOnDisconnect(func() {})
+		conn.SetOnData(func(data []byte) error {
+			sessions <- s
+			return nil
+		})
+	})
+	go acceptor.Start()
+	t.Cleanup(func() { acceptor.Stop() })
+	time.Sleep(50 * time.Millisecond)
+	return port, sessions
+}
+
+func TestTLSMutualAuthVerifySystemId(t *testing.T) {
+	configs := newTestTLSConfigs(t, 1, 2)
+	serverTLS, err := newClusterTLS(configs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTLS, err := newClusterTLS(configs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, sessions := startTestTLSAcceptor(t, serverTLS)
+
+	conn := socketNetConnect.NewConnector()
+	conn.SetAddress("127.0.0.1", port)
+	conn.SetTLSConfig(clientTLS.clientConfig(1))
+	conn.SetOnConnect(func() {})
+	conn.SetOnDisconnect(func() {})
+	conn.SetOnData(func([]byte) error { return nil })
+	if err := conn.Connect(); err != nil {
+		t.Fatalf("tls connect failed: %v", err)
+	}
+	defer conn.Disconnect()
+	pkt, _ := netConnect.PackMessage(1, []byte("hi"))
+	conn.SendData(pkt)
+
+	select {
+	case s := <-sessions:
+		if err := serverTLS.verifyPeer(s, 2); err != nil {
+			t.Fatalf("client cert of system 2 should pass: %v", err)
+		}
+		// 冒充：持有 system 2 证书却声明自己是 system 3
+		if err := serverTLS.verifyPeer(s, 3); err == nil {
+			t.Fatal("system 2 cert must not register as system 3")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not receive data")
+	}
+}
+
+func TestTLSRejectWrongServerIdentity(t *testing.T) {
+	configs := newTestTLSConfigs(t, 1, 2)
+	serverTLS, _ := newClusterTLS(configs[1])
+	clientTLS, _ := newClusterTLS(configs[2])
+	port, _ := startTestTLSAcceptor(t, serverTLS)
+
+	// client 认为对端是 system 3，但 server 出示的是 system 1 的证书
+	conn := socketNetConnect.NewConnector()
+	conn.SetAddress("127.0.0.1", port)
+	conn.SetTLSConfig(clientTLS.clientConfig(3))
+	conn.SetOnConnect(func() {})
+	if err := conn.Connect(); err == nil {
+		conn.Disconnect()
+		t.Fatal("connect should fail on server identity mismatch")
+	}
+}
+
+func TestTLSVerifyPeerPlainConn(t *testing.T) {
+	configs := newTestTLSConfigs(t, 1)
+	ct, _ := newClusterTLS(configs[1])
+	s := netSession.NewSessionMgr().NewSession()
+	if err := ct.verifyPeer(s, 1); err == nil {
+		t.Fatal("register without tls conn should be rejected when ClientAuth enabled")
+	}
+	var disabled *clusterTLS
+	if err := disabled.verifyPeer(s, 1); err != nil {
+		t.Fatalf("tls disabled should skip verify: %v", err)
+	}
+}
+
+// 接入后不完成握手的对端按握手超时断开，不会一直占着连接
+func TestTLSServerHandshakeTimeout(t *testing.T) {
+	configs := newTestTLSConfigs(t, 1)
+	ct, _ := newClusterTLS(configs[1])
+	port := freeTestPort(t)
+	disconnected := make(chan struct{}, 1)
+	acceptor := socketNetConnect.NewAcceptor()
+	acceptor.SetAddress("127.0.0.1", port)
+	acceptor.SetTLSConfig(ct.serverConfig())
+	acceptor.SetTLSHandshakeTimeout(200 * time.Millisecond)
+	acceptor.SetOnAccept(func(conn netConnect.Conn) {
+		conn.SetOnDisconnect(func() { disconnected <- struct{}{} })
+		conn.SetOnData(func(data []byte) error { return nil })
+	})
+	go acceptor.Start()
+	t.Cleanup(func() { acceptor.Stop() })
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server should drop a peer that never finishes the handshake")
+	}
+}
+
+// 开启 ClientAuth 时 inproc 链路不校验 client 证书，集群照常互连
+func TestTLSClientAuthInproc(t *testing.T) {
+	configs := newTestTLSConfigs(t, 1, 2)
+	systems := newInprocCluster(t, 2, nil, func(c *ClusterConfig) {
+		c.TLS = configs[c.LocalSystemId]
+	}, nil)
+	for _, s := range systems {
+		if n := atomic.LoadInt32(&s.(*system).clusterNet.connectedSystemCount); n != 2 {
+			t.Fatalf("inproc links should register under ClientAuth, got %v", n)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package dvactor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	memNetConnect "github.com/kofplayer/dvactor/engine/net/connect/mem"
+	socketNetConnect "github.com/kofplayer/dvactor/engine/net/connect/socket"
+)
+
+const (
+	addressSchemeTCP  = "tcp"
+	addressSchemeUnix = "unix"
+	addressSchemeMem  = "inproc"
+)
+
+// systemAddress 是 SystemConfig 解析后的监听/连接地址。
+type systemAddress struct {
+	scheme string
+	host   string
+	port   uint16
+	path   string
+}
+
+// parseSystemAddress 解析 SystemConfig.Address；为空时回落到 Host/Port 的 TCP 地址。
+// 支持 "tcp://host:port"、"unix:///run/dvactor/2.sock" 与进程内的 "inproc://name"。
+func parseSystemAddress(config *SystemConfig) (*systemAddress, error) {
+	if config.Address == "" {
+		return &systemAddress{scheme: addressSchemeTCP, host: config.Host, port: config.Port}, nil
+	}
+	scheme, rest, ok := strings.Cut(config.Address, "://")
+	if !ok {
+		return nil, fmt.Errorf("system %v address %q missing scheme", config.SystemId, config.Address)
+	}
+	switch scheme {
+	case addressSchemeTCP:
+		host, portStr, err := net.SplitHostPort(rest)
+		if err != nil {
+			return nil, fmt.Errorf("system %v address %q: %v", config.SystemId, config.Address, err)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("system %v address %q: invalid port", config.SystemId, config.Address)
+		}
+		return &systemAddress{scheme: scheme, host: host, port: uint16(port)}, nil
+	case addressSchemeUnix:
+		if rest == "" {
+			return nil, fmt.Errorf("system %v address %q: empty path", config.SystemId, config.Address)
+		}
+		return &systemAddress{scheme: scheme, path: rest}, nil
+	case addressSchemeMem:
+		if rest == "" {
+			return nil, fmt.Errorf("system %v address %q: empty name", config.SystemId, config.Address)
+		}
+		return &systemAddress{scheme: scheme, path: rest}, nil
+	default:
+		return nil, fmt.Errorf("system %v address %q: unsupported scheme %v", config.SystemId, config.Address, scheme)
+	}
+}
+
+// newAcceptor 按本节点地址创建监听端。地址已在 clusterNet.start 中校验过。
+func (cn *clusterNet) newAcceptor(config *SystemConfig) netConnect.Acceptor {
+	addr, _ := parseSystemAddress(config)
+	switch addr.scheme {
+	case addressSchemeUnix:
+		acceptor := socketNetConnect.NewUnixAcceptor()
+		acceptor.SetAddress(addr.path)
+		if cn.tls != nil {
+			acceptor.SetTLSConfig(cn.tls.serverConfig())
+			acceptor.SetTLSHandshakeTimeout(cn.tls.config.HandshakeTimeout)
+		}
+		acceptor.SetFlushPolicy(cn.clusterConfig.Flush)
+		return acceptor
+	case addressSchemeMem:
+		// 进程内传输不经过网络，不做 TLS
+		acceptor := memNetConnect.NewAcceptor()
+		acceptor.SetAddress(addr.path)
+		return acceptor
+	default:
+		// 监听所有网卡，Host 只用于对端连接
+		acceptor := socketNetConnect.NewAcceptor()
+		acceptor.SetAddress("", addr.port)
+		if cn.tls != nil {
+			acceptor.SetTLSConfig(cn.tls.serverConfig())
+			acceptor.SetTLSHandshakeTimeout(cn.tls.config.HandshakeTimeout)
+		}
+		acceptor.SetFlushPolicy(cn.clusterConfig.Flush)
+		return acceptor
+	}
+}
+
+// newConnector 按对端地址创建连接端。
+func (cn *clusterNet) newConnector(config *SystemConfig) netConnect.Connector {
+	addr, _ := parseSystemAddress(config)
+	switch addr.scheme {
+	case addressSchemeUnix:
+		conn := socketNetConnect.NewUnixConnector()
+		conn.SetAddress(addr.path)
+		if cn.tls != nil {
+			conn.SetTLSConfig(cn.tls.clientConfig(config.SystemId))
+			conn.SetTLSHandshakeTimeout(cn.tls.config.HandshakeTimeout)
+		}
+		conn.SetFlushPolicy(cn.clusterConfig.Flush)
+		return conn
+	case addressSchemeMem:
+		conn := memNetConnect.NewConnector()
+		conn.SetAddress(addr.path)
+		return conn
+	default:
+		conn := socketNetConnect.NewConnector()
+		conn.SetAddress(addr.host, addr.port)
+		if cn.tls != nil {
+			conn.SetTLSConfig(cn.tls.clientConfig(config.SystemId))
+			conn.SetTLSHandshakeTimeout(cn.tls.config.HandshakeTimeout)
+		}
+		conn.SetFlushPolicy(cn.clusterConfig.Flush)
+		return conn
+	}
+}
@@ -0,0 +1,88 @@
+package dvactor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	netClient "github.com/kofplayer/dvactor/engine/net/client"
+	socketNetConnect "github.com/kofplayer/dvactor/engine/net/connect/socket"
+	netServer "github.com/kofplayer/dvactor/engine/net/server"
+	netSession "github.com/kofplayer/dvactor/engine/net/session"
+)
+
+func TestParseSystemAddress(t *testing.T) {
+	addr, err := parseSystemAddress(&SystemConfig{Host: "localhost", Port: 8001})
+	if err != nil || addr.scheme != addressSchemeTCP || addr.host != "localhost" || addr.port != 8001 {
+		t.Fatalf("host/port fallback mismatch: %+v %v", addr, err)
+	}
+	addr, err = parseSystemAddress(&SystemConfig{Address: "tcp://10.0.0.2:8002"})
+	if err != nil || addr.host != "10.0.0.2" || addr.port != 8002 {
+		t.Fatalf("tcp address mismatch: %+v %v", addr, err)
+	}
+	addr, err = parseSystemAddress(&SystemConfig{Address: "unix:///run/dvactor/2.sock"})
+	if err != nil || addr.scheme != addressSchemeUnix || addr.path != "/run/dvactor/2.sock" {
+		t.Fatalf("unix address mismatch: %+v %v", addr, err)
+	}
+	for _, bad := range []string{"/run/dvactor/2.sock", "udp://host:1", "tcp://host", "tcp://host:70000", "unix://"} {
+		if _, err := parseSystemAddress(&SystemConfig{Address: bad}); err == nil {
+			t.Fatalf("address %q should be rejected", bad)
+		}
+	}
+}
+
+// unix socket 端到端：NetServer/NetClient 经 clusterNet 工厂创建的 acceptor/connector 收发一帧
+func TestUnixSocketTransport(t *testing.T) {
+	config := &SystemConfig{SystemId: 1, Address: "unix://" + filepath.Join(t.TempDir(), "run", "1.sock")}
+	cn := &clusterNet{clusterConfig: &ClusterConfig{}}
+
+	received := make(chan string, 1)
+	svr := netServer.NewNetServer()
+	svr.SetAcceptor(cn.newAcceptor(config))
+	svr.SetOnConnect(func(netSession.NetSession) {})
+	svr.SetOnDisconnect(func(netSession.NetSession) {})
+	svr.SetOnMessage(func(s netSession.NetSession, msgId uint32, data []byte) error {
+		received <- string(data)
+		return nil
+	})
+	go svr.Start()
+	defer svr.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	cli := netClient.NewNetClient()
+	cli.SetConnector(cn.newConnector(config))
+	cli.SetOnMessage(func(uint32, []byte) error { return nil })
+	if err := cli.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Disconnect()
+	if err := cli.SendMessage(1, []byte("over unix")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		if msg != "over unix" {
+			t.Fatalf("payload mismatch: %q", msg)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("unix transport did not deliver")
+	}
+}
+
+// 地址指向普通文件时监听报错，不删除该文件
+func TestUnixAcceptorKeepsRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not.sock")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	acceptor := socketNetConnect.NewUnixAcceptor()
+	acceptor.SetAddress(path)
+	if err := acceptor.Start(); err == nil {
+		acceptor.Stop()
+		t.Fatal("listen on a regular file should fail")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+		t.Fatalf("regular file should be kept: %q %v", data, err)
+	}
+}
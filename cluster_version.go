@@ -0,0 +1,104 @@
+package dvactor
+
+import (
+	"fmt"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+)
+
+// 线协议版本。只有已有 PkgType 语义不兼容时才递增 ProtocolVersion；
+// 新增的可选 PkgType/帧特性走 Capability 位，不升版本。
+// 注册时双方交换 [MinProtocolVersion, ProtocolVersion] 区间，无交集即拒绝。
+// 目前所有扩展都走能力位，线格式与不带版本字段的旧节点一致，仍为版本 1。
+const (
+	ProtocolVersion    uint32 = 1
+	MinProtocolVersion uint32 = 1
+	// legacyProtocolVersion 是不带版本字段的旧节点（注册包里版本为 0）
+	legacyProtocolVersion uint32 = 1
+)
+
+// Capability 是注册时协商的能力位，双方都声明的位才会对该链路启用。
+type Capability uint64
+
+const (
+	// CapabilityCompression 可收发压缩帧（ClusterConfig.Compression 开启时声明）
+	CapabilityCompression Capability = 1 << iota
+	// CapabilityFrameV2 可解析 v2 帧（2 字节 msgId、flags、可选 CRC32C）
+	CapabilityFrameV2
+	// CapabilityMultiConn 接受同一对端的多条附加连接（ClusterConfig.ConnectionsPerPeer > 1 的 client 才会打开）
+	CapabilityMultiConn
+	// CapabilityChunking 可重组 PkgChunk 分片（ClusterConfig.Chunking 开启时声明）
+	CapabilityChunking
+	// CapabilityStream 支持 actor 间的流（PkgStreamOpen/Data/Credit/Close）
+	CapabilityStream
+	// CapabilityEnvelopeBatch 可解析 PkgEnvelopeBatch（ClusterConfig.Batching 开启时声明）
+	CapabilityEnvelopeBatch
+	// CapabilityRegistryAnnounce 可解析 PkgMessageTypeAnnounce（运行期消息类型通告）
+	CapabilityRegistryAnnounce
+	// CapabilityCancelRequest 可解析 PkgCancelRequest（跨节点请求取消）
+	CapabilityCancelRequest
+)
+
+// LocalCapabilities 本节点代码支持的全部能力位；实际声明的还要去掉配置未开启的部分，见 localCapabilities。
+var LocalCapabilities = CapabilityCompression | CapabilityFrameV2 | CapabilityMultiConn | CapabilityChunking | CapabilityStream | CapabilityEnvelopeBatch | CapabilityRegistryAnnounce | CapabilityCancelRequest
+
+// pkgTypeCapabilities 记录需要能力协商的 PkgType；发送前对端未协商该能力则拒绝发送，
+// 避免旧节点在 OnMessage 的 switch 中静默丢弃。基础 PkgType 不在表中。
+var pkgTypeCapabilities = map[protocol.PkgType]Capability{
+	protocol.PkgType_PkgTypeChunk:               CapabilityChunking,
+	protocol.PkgType_PkgTypeStreamOpen:          CapabilityStream,
+	protocol.PkgType_PkgTypeStreamData:          CapabilityStream,
+	protocol.PkgType_PkgTypeStreamCredit:        CapabilityStream,
+	protocol.PkgType_PkgTypeStreamClose:         CapabilityStream,
+	protocol.PkgType_PkgTypeEnvelopeBatch:       CapabilityEnvelopeBatch,
+	protocol.PkgType_PkgTypeMessageTypeAnnounce: CapabilityRegistryAnnounce,
+	protocol.PkgType_PkgTypeCancelRequest:       CapabilityCancelRequest,
+}
+
+// peerVersion 把注册包里的版本字段规整为版本区间。
+func peerVersion(version, minVersion uint32) (uint32, uint32) {
+	if version == 0 {
+		version = legacyProtocolVersion
+	}
+	if minVersion == 0 || minVersion > version {
+		minVersion = version
+	}
+	return version, minVersion
+}
+
+// negotiateVersion 返回双方都支持的最高版本，无交集时返回错误。
+func negotiateVersion(version, minVersion uint32) (uint32, error) {
+	version, minVersion = peerVersion(version, minVersion)
+	negotiated := min(version, ProtocolVersion)
+	if negotiated < max(minVersion, MinProtocolVersion) {
+		return 0, fmt.Errorf("protocol version incompatible: local [%v,%v], peer [%v,%v]", MinProtocolVersion, ProtocolVersion, minVersion, version)
+	}
+	return negotiated, nil
+}
+
+// localCapabilities 本节点在注册时声明的能力位。
+func (cn *clusterNet) localCapabilities() Capability {
+	capabilities := LocalCapabilities
+	if cn.clusterConfig.Compression == nil {
+		capabilities &^= CapabilityCompression
+	}
+	if cn.clusterConfig.Chunking == nil {
+		capabilities &^= CapabilityChunking
+	}
+	if cn.clusterConfig.Batching == nil {
+		capabilities &^= CapabilityEnvelopeBatch
+	}
+	return capabilities
+}
+
+// hasCapability 判断与 systemId 的当前链路是否协商了 capability。
+func (cn *clusterNet) hasCapability(systemId vactor.SystemId, capability Capability) bool {
+	info, ok := cn.systemInfos[systemId]
+	if !ok {
+		return false
+	}
+	info.lock.RLock()
+	defer info.lock.RUnlock()
+	return info.capabilities&capability == capability
+}
@@ -0,0 +1,75 @@
+package dvactor
+
+import (
+	"testing"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	// 旧节点不带版本字段
+	if v, err := negotiateVersion(0, 0); err != nil || v != legacyProtocolVersion {
+		t.Fatalf("legacy peer should negotiate %v, got %v %v", legacyProtocolVersion, v, err)
+	}
+	if v, err := negotiateVersion(ProtocolVersion+3, MinProtocolVersion); err != nil || v != ProtocolVersion {
+		t.Fatalf("newer compatible peer should negotiate local version, got %v %v", v, err)
+	}
+	// 对端已不再支持本节点的任何版本
+	if _, err := negotiateVersion(ProtocolVersion+3, ProtocolVersion+1); err == nil {
+		t.Fatal("peer min version above local version should be incompatible")
+	}
+	if MinProtocolVersion > 1 {
+		if _, err := negotiateVersion(MinProtocolVersion-1, 0); err == nil {
+			t.Fatal("peer below local min version should be incompatible")
+		}
+	}
+}
+
+func TestRegisterRejectIncompatibleVersion(t *testing.T) {
+	address := t.Name()
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{
+			{SystemId: 1, Address: "inproc://" + address},
+			{SystemId: 2, Address: "inproc://" + address + "/2"},
+		},
+	}).(*system)
+	cn := s.clusterNet
+	cn.server = NewServer(cn)
+	cn.server.Start()
+	defer cn.server.svr.Stop()
+	waitInprocListen(t, address)
+
+	rc := newTestRawClient(t, address)
+	rc.send(t, protocol.PkgType_PkgTypeRegisterSystemReq, &protocol.PkgRegisterSystemReq{
+		SystemId:           2,
+		ProtocolVersion:    ProtocolVersion + 2,
+		MinProtocolVersion: ProtocolVersion + 1,
+	})
+	rsp := &protocol.PkgRegisterSystemRsp{}
+	rc.recv(t, protocol.PkgType_PkgTypeRegisterSystemRsp, rsp)
+	if vactor.ErrorCode(rsp.ErrorCode) != ErrorCodeProtocolIncompatible {
+		t.Fatalf("expect protocol incompatible, got %v", rsp.ErrorCode)
+	}
+	if rsp.ProtocolVersion != ProtocolVersion {
+		t.Fatalf("rsp should carry local version, got %v", rsp.ProtocolVersion)
+	}
+	rc.waitDisconnect(t)
+}
+
+// 需要能力位的 PkgType 在对端未协商时发送失败，而不是发给旧节点被静默丢弃
+func TestSendGatedByCapability(t *testing.T) {
+	const testCapability Capability = 1 << 63
+	pkgTypeCapabilities[protocol.PkgType_PkgTypeNone] = testCapability
+	defer delete(pkgTypeCapabilities, protocol.PkgType_PkgTypeNone)
+
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1}, {SystemId: 2}},
+	}).(*system)
+	err := s.clusterNet.doSend(2, uint32(protocol.PkgType_PkgTypeNone), nil, 0)
+	if err == nil || err.Code() != ErrorCodeCapabilityNotSupported {
+		t.Fatalf("expect capability not supported, got %v", err)
+	}
+}
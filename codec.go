@@ -0,0 +1,93 @@
+package dvactor
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrCodecUnsupported 编解码器不支持该消息的 Go 类型，MarshalMessage 映射为 ErrorCodeMessageCannotSerialize。
+var ErrCodecUnsupported = errors.New("message type not supported by codec")
+
+// Codec 业务消息的编解码器。按消息类型注册（RegisterMessageTypeCodec）或通过 ClusterConfig.Codec 全局指定；
+// 同一 msgType 在所有节点上必须使用相同的 Codec，线上不携带编码信息。
+type Codec interface {
+	// Marshal 把 msg 序列化后追加到 b，返回追加后的切片
+	Marshal(b []byte, msg interface{}) ([]byte, error)
+	// Unmarshal 把 data 反序列化到 msg（creator 返回的指针）
+	Unmarshal(data []byte, msg interface{}) error
+}
+
+// CodecSizer 由能预先算出序列化长度的 Codec 额外实现，MarshalMessage 据此一次分配到位。
+type CodecSizer interface {
+	Size(msg interface{}) int
+}
+
+// ProtoCodec 默认编解码器，只支持 proto.Message。
+type ProtoCodec struct{}
+
+func (ProtoCodec) Marshal(b []byte, msg interface{}) ([]byte, error) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return b, ErrCodecUnsupported
+	}
+	return proto.MarshalOptions{}.MarshalAppend(b, m)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, msg interface{}) error {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return ErrCodecUnsupported
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func (ProtoCodec) Size(msg interface{}) int {
+	if m, ok := msg.(proto.Message); ok {
+		return proto.Size(m)
+	}
+	return 0
+}
+
+// JSONCodec 用 encoding/json 编码普通结构体，proto.Message 用 protojson，便于跨语言调试。
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(b []byte, msg interface{}) ([]byte, error) {
+	var data []byte
+	var err error
+	if m, ok := msg.(proto.Message); ok {
+		data, err = protojson.Marshal(m)
+	} else {
+		data, err = json.Marshal(msg)
+	}
+	if err != nil {
+		return b, err
+	}
+	return append(b, data...), nil
+}
+
+func (JSONCodec) Unmarshal(data []byte, msg interface{}) error {
+	if m, ok := msg.(proto.Message); ok {
+		return protojson.Unmarshal(data, m)
+	}
+	return json.Unmarshal(data, msg)
+}
+
+// GobCodec 用 encoding/gob 编码任意 Go 值，每条消息都带类型描述，体积与开销较大，仅建议用于原型阶段。
+type GobCodec struct{}
+
+func (GobCodec) Marshal(b []byte, msg interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(b)
+	if err := gob.NewEncoder(buf).Encode(msg); err != nil {
+		return b, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, msg interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(msg)
+}
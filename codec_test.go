@@ -0,0 +1,117 @@
+package dvactor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+type codecPing struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec{}, GobCodec{}} {
+		in := &codecPing{Name: "a", Count: 3, Tags: []string{"x", "y"}}
+		data, err := codec.Marshal([]byte{0xff}, in)
+		if err != nil {
+			t.Fatalf("%T: %v", codec, err)
+		}
+		if data[0] != 0xff {
+			t.Fatalf("%T: prefix overwritten", codec)
+		}
+		out := &codecPing{}
+		if err := codec.Unmarshal(data[1:], out); err != nil {
+			t.Fatalf("%T: %v", codec, err)
+		}
+		if out.Name != in.Name || out.Count != in.Count || len(out.Tags) != 2 || out.Tags[1] != "y" {
+			t.Fatalf("%T: got %+v", codec, out)
+		}
+	}
+	// JSONCodec 对 proto.Message 使用 protojson
+	data, err := JSONCodec{}.Marshal(nil, &protocol.ActorRef{ActorId: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := &protocol.ActorRef{}
+	if err := (JSONCodec{}).Unmarshal(data, ref); err != nil || ref.ActorId != "id" {
+		t.Fatalf("protojson round trip: %v %v", ref, err)
+	}
+	if _, err := (ProtoCodec{}).Marshal(nil, &codecPing{}); err != ErrCodecUnsupported {
+		t.Fatalf("expect unsupported, got %v", err)
+	}
+}
+
+func TestMarshalMessageCodec(t *testing.T) {
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}},
+	}).(*system)
+	// 普通结构体未注册 codec 时走默认 ProtoCodec，无法序列化
+	s.RegisterMessageTypeCodec(1, func() interface{} { return &codecPing{} }, nil)
+	if _, err := s.MarshalMessage(&codecPing{}); err == nil || err.Code() != ErrorCodeMessageCannotSerialize {
+		t.Fatalf("expect cannot serialize, got %v", err)
+	}
+	if _, err := s.MarshalMessage(struct{}{}); err == nil || err.Code() != ErrorCodeMessageCannotSerialize {
+		t.Fatalf("expect cannot serialize, got %v", err)
+	}
+	if _, err := s.MarshalMessage(&protocol.ActorRef{}); err == nil || err.Code() != ErrorCodeMessageNotRegister {
+		t.Fatalf("expect not register, got %v", err)
+	}
+	s.RegisterMessageTypeCodec(1, func() interface{} { return &codecPing{} }, GobCodec{})
+	msg, err := s.MarshalMessage(&codecPing{Name: "gob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, e := s.UnmarshalMessage(msg)
+	if e != nil || out.(*codecPing).Name != "gob" {
+		t.Fatalf("unexpected %v %v", out, e)
+	}
+}
+
+// 普通结构体经 per-type codec 与全局 ClusterConfig.Codec 跨节点送达
+func TestCodecDelivery(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	for _, global := range []bool{false, true} {
+		t.Run(fmt.Sprint("global=", global), func(t *testing.T) {
+			received := make(chan *codecPing, 4)
+			systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+				if global {
+					c.Codec = GobCodec{}
+				}
+			}, func(s ClusterSystem) {
+				if global {
+					s.RegisterMessageTypeCodec(1, func() interface{} { return &codecPing{} }, nil)
+				} else {
+					s.RegisterMessageTypeCodec(1, func() interface{} { return &codecPing{} }, JSONCodec{})
+				}
+				s.RegisterMessageType(2, func() proto.Message { return &protocol.ActorRef{} })
+				s.RegisterActorType(actorType, func() vactor.Actor {
+					return func(ctx vactor.EnvelopeContext) {
+						if msg, ok := ctx.GetMessage().(*codecPing); ok {
+							received <- msg
+						}
+					}
+				})
+			})
+			ref := systems[0].CreateActorRefEx(2, actorType, "a")
+			if err := systems[0].Send(ref, &codecPing{Name: "ping", Count: 7}); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case msg := <-received:
+				if msg.Name != "ping" || msg.Count != 7 {
+					t.Fatalf("global %v: got %+v", global, msg)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("global %v: message not delivered", global)
+			}
+		})
+	}
+}
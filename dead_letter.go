@@ -0,0 +1,353 @@
+package dvactor
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrUnknownMessageType 收到未注册的 msgType
+	ErrUnknownMessageType = errors.New("unknown msg type")
+	// ErrMessageTypeQuarantined 收到因类型表冲突被隔离的 msgType，见 RegistryCheckQuarantine
+	ErrMessageTypeQuarantined = errors.New("msg type quarantined")
+)
+
+// DeadLetterReason 信封无法投递的原因。
+type DeadLetterReason int
+
+const (
+	// DeadLetterDecodeFail 入站包或业务消息反序列化失败
+	DeadLetterDecodeFail DeadLetterReason = iota
+	// DeadLetterUnknownType 入站消息的 msgType 未注册
+	DeadLetterUnknownType
+	// DeadLetterTypeConflict 入站消息的 msgType 因类型表冲突被隔离
+	DeadLetterTypeConflict
+	// DeadLetterBatchItem EnvelopeBatchSend 中被跳过的单条消息（发送侧序列化或接收侧反序列化失败）
+	DeadLetterBatchItem
+	// DeadLetterPeerUnavailable 出站时对端未连接或写入失败
+	DeadLetterPeerUnavailable
+	// DeadLetterSendQueueFull 出站时对端发送队列已满（SendLimit）
+	DeadLetterSendQueueFull
+	// DeadLetterSendQueueDropped 发送队列按 OverflowDropNewest/OverflowDropOldest 丢弃的帧
+	DeadLetterSendQueueDropped
+	deadLetterReasonCount
+)
+
+func (r DeadLetterReason) String() string {
+	switch r {
+	case DeadLetterDecodeFail:
+		return "decode fail"
+	case DeadLetterUnknownType:
+		return "unknown type"
+	case DeadLetterTypeConflict:
+		return "type conflict"
+	case DeadLetterBatchItem:
+		return "batch item"
+	case DeadLetterPeerUnavailable:
+		return "peer unavailable"
+	case DeadLetterSendQueueFull:
+		return "send queue full"
+	case DeadLetterSendQueueDropped:
+		return "send queue dropped"
+	}
+	return "unknown"
+}
+
+// DeadLetter 一条无法投递的跨节点信封。Data 为该信封的 PkgType 线格式，可经 ReplayDeadLetter 重放。
+type DeadLetter struct {
+	Reason DeadLetterReason
+	Err    error
+	// Inbound 为 true 时是从 SystemId 收到后无法投递的包，否则是发往 SystemId 失败的包
+	Inbound  bool
+	SystemId vactor.SystemId
+	PkgType  protocol.PkgType
+	// 信封元数据，包本身无法解析时为空
+	FromActorRef vactor.ActorRef
+	ToActorRefs  []vactor.ActorRef
+	MsgType      uint32
+	// Data 为 PkgType 的序列化结果；发送侧序列化失败的消息为 nil，原消息见 Message
+	Data    []byte
+	Message interface{}
+	// Count 本条代表的丢失数，普通死信为 1。发送队列丢弃已打包的帧、合批随批次发送失败时
+	// 无法还原单个信封，一次丢失合成一条只计数的记录：Count 为帧数/包数，不带 PkgType 与 Data，不能重放
+	Count int
+}
+
+// DeadLetterConfig 死信去向，两者可同时设置。
+type DeadLetterConfig struct {
+	// ActorType/ActorId: 非 0 时把 *DeadLetter 作为消息发给本机的该 actor
+	ActorType vactor.ActorType
+	ActorId   vactor.ActorId
+	// Queue: 非 nil 时写入该 channel，满时丢弃并告警
+	Queue chan<- *DeadLetter
+}
+
+// deadLetterLogInterval 同一原因的死信日志最短间隔，其间的死信只计数，下次日志带上被省略的条数。
+const deadLetterLogInterval = time.Second
+
+// deadLetters 按原因统计的死信数，以及按原因限流的日志状态。
+type deadLetters struct {
+	counts     [deadLetterReasonCount]atomic.Uint64
+	lastLog    [deadLetterReasonCount]atomic.Int64
+	suppressed [deadLetterReasonCount]atomic.Uint64
+}
+
+// shouldLog 该原因距上次日志已超过 deadLetterLogInterval 时返回 true 与期间省略的条数，否则记入省略数。
+func (d *deadLetters) shouldLog(reason DeadLetterReason, count int) (bool, uint64) {
+	now := time.Now().UnixNano()
+	last := d.lastLog[reason].Load()
+	if now-last < int64(deadLetterLogInterval) || !d.lastLog[reason].CompareAndSwap(last, now) {
+		d.suppressed[reason].Add(uint64(count))
+		return false, 0
+	}
+	return true, d.suppressed[reason].Swap(0)
+}
+
+func (s *system) DeadLetterStats() map[DeadLetterReason]uint64 {
+	stats := make(map[DeadLetterReason]uint64)
+	for reason := range s.deadLetters.counts {
+		if n := s.deadLetters.counts[reason].Load(); n > 0 {
+			stats[DeadLetterReason(reason)] = n
+		}
+	}
+	return stats
+}
+
+// deadLetter 统计并投递死信。日志按原因限流，过载时以 DeadLetterStats 的计数为准。
+func (s *system) deadLetter(dl *DeadLetter) {
+	if dl.Count <= 0 {
+		dl.Count = 1
+	}
+	s.deadLetters.counts[dl.Reason].Add(uint64(dl.Count))
+	if ok, suppressed := s.deadLetters.shouldLog(dl.Reason, dl.Count); ok {
+		s.LogWarn("dead letter: %v x%v, pkg %v, system %v, msgType %v: %v (%v more since last log)",
+			dl.Reason, dl.Count, dl.PkgType, dl.SystemId, dl.MsgType, dl.Err, suppressed)
+	}
+	config := s.clusterNet.clusterConfig.DeadLetter
+	if config == nil {
+		return
+	}
+	if config.Queue != nil {
+		select {
+		case config.Queue <- dl:
+		default:
+			s.LogError("dead letter queue full, drop %v", dl.Reason)
+		}
+	}
+	if config.ActorType != 0 {
+		s.LocalRouter(&vactor.EnvelopeSend{
+			ToActorRef: s.CreateActorRefEx(s.clusterNet.clusterConfig.LocalSystemId, config.ActorType, config.ActorId),
+			Message:    dl,
+		})
+	}
+}
+
+// ReplayDeadLetter 重放死信：入站的按当前类型表重新解码投递（如补注册类型之后），出站的重新发往 SystemId。
+func (s *system) ReplayDeadLetter(dl *DeadLetter) vactor.VAError {
+	if dl.Data == nil {
+		return vactor.NewVAError(ErrorCodeMessageCannotSerialize)
+	}
+	if dl.Inbound {
+		if err := s.clusterNet.dispatch(dl.SystemId, uint32(dl.PkgType), dl.Data); err != nil {
+			return vactor.NewVAError(ErrorCodeMessageSerializeFail)
+		}
+		return nil
+	}
+	var slot vactor.GroupSlot
+	if len(dl.ToActorRefs) == 1 && dl.ToActorRefs[0] != nil {
+		slot = dl.ToActorRefs[0].GetGroupSlot()
+	}
+	buf := netConnect.GetBuffer()
+	buf.B = append(buf.B, dl.Data...)
+	return s.clusterNet.doSend(dl.SystemId, uint32(dl.PkgType), buf, slot)
+}
+
+// deadLetterReason 把入站解码错误归类。
+func deadLetterReason(err error) DeadLetterReason {
+	switch {
+	case errors.Is(err, ErrUnknownMessageType):
+		return DeadLetterUnknownType
+	case errors.Is(err, ErrMessageTypeQuarantined):
+		return DeadLetterTypeConflict
+	}
+	return DeadLetterDecodeFail
+}
+
+// envelopeMeta 从信封包中取出元数据，各 PkgEnvelope* 的生成代码都带这些 getter。
+func envelopeMeta(dl *DeadLetter, pkg proto.Message) {
+	if p, ok := pkg.(interface{ GetFromActorRef() *protocol.ActorRef }); ok {
+		dl.FromActorRef = ActorRefFromProto(p.GetFromActorRef())
+	}
+	if p, ok := pkg.(interface{ GetToActorRef() *protocol.ActorRef }); ok && p.GetToActorRef() != nil {
+		dl.ToActorRefs = []vactor.ActorRef{ActorRefFromProto(p.GetToActorRef())}
+	}
+	if p, ok := pkg.(interface{ GetToActorRefs() []*protocol.ActorRef }); ok {
+		for _, ref := range p.GetToActorRefs() {
+			dl.ToActorRefs = append(dl.ToActorRefs, ActorRefFromProto(ref))
+		}
+	}
+	if p, ok := pkg.(interface{ GetMessage() *protocol.Message }); ok {
+		dl.MsgType = p.GetMessage().GetType()
+	}
+	if p, ok := pkg.(interface{ GetResponse() *protocol.Response }); ok {
+		dl.MsgType = p.GetResponse().GetMessage().GetType()
+	}
+}
+
+// inboundDeadLetter 记录收到后无法投递的包；pkg 为已解析的包，包本身解析失败时为 nil。
+func (cn *clusterNet) inboundDeadLetter(systemId vactor.SystemId, msgId uint32, data []byte, pkg proto.Message, err error) {
+	dl := &DeadLetter{
+		Reason:   DeadLetterDecodeFail,
+		Err:      err,
+		Inbound:  true,
+		SystemId: systemId,
+		PkgType:  protocol.PkgType(msgId),
+		Data:     append([]byte(nil), data...),
+	}
+	if pkg != nil {
+		dl.Reason = deadLetterReason(err)
+		envelopeMeta(dl, pkg)
+	}
+	cn.localSystem.deadLetter(dl)
+}
+
+// outboundReason 出站错误码对应的死信原因；只有对端不可用或队列满/丢弃才算死信，调用方错误（如能力不支持）不算。
+func outboundReason(code vactor.ErrorCode) (DeadLetterReason, bool) {
+	switch code {
+	case ErrorCodeMessageSendFail:
+		return DeadLetterPeerUnavailable, true
+	case ErrorCodeSendQueueFull:
+		return DeadLetterSendQueueFull, true
+	case ErrorCodeSendQueueDropped:
+		return DeadLetterSendQueueDropped, true
+	}
+	return 0, false
+}
+
+// outboundDeadLetter 记录发往 systemId 失败的包。
+func (cn *clusterNet) outboundDeadLetter(systemId vactor.SystemId, msgId uint32, pkg proto.Message, err vactor.VAError) {
+	reason, ok := outboundReason(err.Code())
+	if !ok {
+		return
+	}
+	data, _ := proto.Marshal(pkg)
+	dl := &DeadLetter{
+		Reason:   reason,
+		Err:      err,
+		SystemId: systemId,
+		PkgType:  protocol.PkgType(msgId),
+		Data:     data,
+	}
+	envelopeMeta(dl, pkg)
+	cn.localSystem.deadLetter(dl)
+}
+
+// droppedFrames 记录发送队列一次从队首丢弃的 frames 帧（OverflowDropOldest）。帧已打包（可能是合批、分片或压缩帧），
+// 合成一条只计数的死信。
+func (cn *clusterNet) droppedFrames(systemId vactor.SystemId, frames int) {
+	cn.localSystem.deadLetter(&DeadLetter{
+		Reason:   DeadLetterSendQueueDropped,
+		Err:      netConnect.ErrSendQueueDropped,
+		SystemId: systemId,
+		Count:    frames,
+	})
+}
+
+// lostBatchItems 记录合批后随批次发送失败的 items 个包。批次缓冲已随失败回收，合成一条只计数的死信。
+func (cn *clusterNet) lostBatchItems(systemId vactor.SystemId, items int, err error) {
+	code := linkErrorCode(err)
+	reason, _ := outboundReason(code)
+	cn.localSystem.deadLetter(&DeadLetter{
+		Reason:   reason,
+		Err:      vactor.NewVAError(code),
+		SystemId: systemId,
+		Count:    items,
+	})
+}
+
+// discardedBatch 记录连接断开时合批器中尚未发出的批次，data 为 PkgEnvelopeBatch 的线格式；每个包单独成为可重放的死信。
+func (cn *clusterNet) discardedBatch(systemId vactor.SystemId, data []byte) {
+	batch := &protocol.PkgEnvelopeBatch{}
+	if err := proto.Unmarshal(data, batch); err != nil {
+		cn.localSystem.LogError("system %v discard envelope batch: %v", systemId, err)
+		return
+	}
+	for _, item := range batch.Items {
+		dl := &DeadLetter{
+			Reason:   DeadLetterPeerUnavailable,
+			Err:      vactor.NewVAError(ErrorCodeMessageSendFail),
+			SystemId: systemId,
+			PkgType:  protocol.PkgType(item.PkgType),
+			Data:     item.Data,
+		}
+		if pkg := newEnvelopePkg(dl.PkgType); pkg != nil && proto.Unmarshal(item.Data, pkg) == nil {
+			envelopeMeta(dl, pkg)
+		}
+		cn.localSystem.deadLetter(dl)
+	}
+}
+
+// newEnvelopePkg 按 PkgType 创建空的信封包，用于从线格式取元数据；非信封包返回 nil。
+func newEnvelopePkg(pkgType protocol.PkgType) proto.Message {
+	switch pkgType {
+	case protocol.PkgType_PkgTypeEnvelopeSend:
+		return &protocol.PkgEnvelopeSend{}
+	case protocol.PkgType_PkgTypeEnvelopeBatchSend:
+		return &protocol.PkgEnvelopeBatchSend{}
+	case protocol.PkgType_PkgTypeEnvelopeRequest:
+		return &protocol.PkgEnvelopeRequest{}
+	case protocol.PkgType_PkgTypeEnvelopeRequestAsync:
+		return &protocol.PkgEnvelopeRequestAsync{}
+	case protocol.PkgType_PkgTypeEnvelopeResponse:
+		return &protocol.PkgEnvelopeResponse{}
+	case protocol.PkgType_PkgTypeEnvelopeResponseAsync:
+		return &protocol.PkgEnvelopeResponseAsync{}
+	case protocol.PkgType_PkgTypeEnvelopeWatch:
+		return &protocol.PkgEnvelopeWatch{}
+	case protocol.PkgType_PkgTypeEnvelopeNotify:
+		return &protocol.PkgEnvelopeNotify{}
+	case protocol.PkgType_PkgTypeEnvelopeFireNotify:
+		return &protocol.PkgEnvelopeFireNotify{}
+	}
+	return nil
+}
+
+// inboundBatchItem 记录 PkgEnvelopeBatchSend 中解码失败被跳过的消息；Data 为只含这一条消息的同一信封，可单独重放。
+func (cn *clusterNet) inboundBatchItem(systemId vactor.SystemId, pkg *protocol.PkgEnvelopeBatchSend, protoMsg *protocol.Message, err error) {
+	item := &protocol.PkgEnvelopeBatchSend{
+		FromActorRef: pkg.FromActorRef,
+		ToActorRefs:  pkg.ToActorRefs,
+		Messages:     []*protocol.Message{protoMsg},
+	}
+	data, _ := proto.Marshal(item)
+	dl := &DeadLetter{
+		Reason:   DeadLetterBatchItem,
+		Err:      err,
+		Inbound:  true,
+		SystemId: systemId,
+		PkgType:  protocol.PkgType_PkgTypeEnvelopeBatchSend,
+		MsgType:  protoMsg.GetType(),
+		Data:     data,
+	}
+	envelopeMeta(dl, item)
+	cn.localSystem.deadLetter(dl)
+}
+
+// outboundBatchItem 记录 EnvelopeBatchSend 中序列化失败被跳过的消息，原消息放在 Message 中。
+func (cn *clusterNet) outboundBatchItem(systemId vactor.SystemId, e *vactor.EnvelopeBatchSend, message interface{}, err vactor.VAError) {
+	cn.localSystem.deadLetter(&DeadLetter{
+		Reason:       DeadLetterBatchItem,
+		Err:          err,
+		SystemId:     systemId,
+		PkgType:      protocol.PkgType_PkgTypeEnvelopeBatchSend,
+		FromActorRef: e.FromActorRef,
+		ToActorRefs:  e.ToActorRefs,
+		Message:      message,
+	})
+}
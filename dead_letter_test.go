@@ -0,0 +1,134 @@
+package dvactor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+func waitDeadLetter(t *testing.T, queue chan *DeadLetter) *DeadLetter {
+	select {
+	case dl := <-queue:
+		return dl
+	case <-time.After(5 * time.Second):
+		t.Fatal("dead letter timeout")
+	}
+	return nil
+}
+
+// 发往未连接的对端与批量发送中无法序列化的消息进入死信
+func TestOutboundDeadLetter(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	queue := make(chan *DeadLetter, 8)
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{
+			{SystemId: 1, ActorTypes: []vactor.ActorType{}},
+			{SystemId: 2, ActorTypes: []vactor.ActorType{actorType}},
+		},
+		DeadLetter: &DeadLetterConfig{Queue: queue},
+	}).(*system)
+	s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+	to := s.CreateActorRefEx(2, actorType, "a")
+
+	if err := s.clusterNet.Send(2, &vactor.EnvelopeSend{ToActorRef: to, Message: &protocol.ActorRef{ActorId: "x"}}); err == nil {
+		t.Fatal("send to disconnected peer should fail")
+	}
+	dl := waitDeadLetter(t, queue)
+	if dl.Reason != DeadLetterPeerUnavailable || dl.Inbound || dl.SystemId != 2 || dl.PkgType != protocol.PkgType_PkgTypeEnvelopeSend || dl.MsgType != 1 || len(dl.ToActorRefs) != 1 || dl.ToActorRefs[0].GetActorId() != "a" {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+	pkg := &protocol.PkgEnvelopeSend{}
+	if err := proto.Unmarshal(dl.Data, pkg); err != nil || pkg.Message.Type != 1 {
+		t.Fatalf("dead letter data should be the envelope: %v %v", pkg, err)
+	}
+
+	s.clusterNet.Send(2, &vactor.EnvelopeBatchSend{ToActorRefs: []vactor.ActorRef{to}, Messages: []interface{}{&codecPing{}, &protocol.ActorRef{}}})
+	if dl := waitDeadLetter(t, queue); dl.Reason != DeadLetterBatchItem || dl.Data != nil || dl.Message.(*codecPing) == nil {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+	if dl := waitDeadLetter(t, queue); dl.Reason != DeadLetterPeerUnavailable || dl.PkgType != protocol.PkgType_PkgTypeEnvelopeBatchSend {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+	stats := s.DeadLetterStats()
+	if stats[DeadLetterPeerUnavailable] != 2 || stats[DeadLetterBatchItem] != 1 {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+}
+
+// 接收方未注册的消息进入死信 actor，补注册后可以重放
+func TestInboundDeadLetterReplay(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	deadLetterType := ActorTypeStart + 2
+	deadLetters := make(chan *DeadLetter, 4)
+	received := make(chan string, 4)
+	index := 0
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+		c.DeadLetter = &DeadLetterConfig{ActorType: deadLetterType, ActorId: "dead"}
+	}, func(s ClusterSystem) {
+		index++
+		if index == 1 {
+			s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		}
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if msg, ok := ctx.GetMessage().(*protocol.ActorRef); ok {
+					received <- msg.ActorId
+				}
+			}
+		})
+		s.RegisterActorType(deadLetterType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if dl, ok := ctx.GetMessage().(*DeadLetter); ok {
+					deadLetters <- dl
+				}
+			}
+		})
+	})
+	if err := systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "a"), &protocol.ActorRef{ActorId: "replay"}); err != nil {
+		t.Fatal(err)
+	}
+	dl := waitDeadLetter(t, deadLetters)
+	if dl.Reason != DeadLetterUnknownType || !dl.Inbound || dl.MsgType != 1 || len(dl.ToActorRefs) != 1 || dl.ToActorRefs[0].GetActorId() != "a" {
+		t.Fatalf("unexpected dead letter %+v", dl)
+	}
+	if err := systems[1].ReplayDeadLetter(dl); err == nil {
+		t.Fatal("replay before register should fail")
+	}
+	<-deadLetters
+	systems[1].RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+	if err := systems[1].ReplayDeadLetter(dl); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-received:
+		if id != "replay" {
+			t.Fatalf("got %v", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replayed message not delivered")
+	}
+}
+
+// 死信日志按原因限流，间隔内的条数累计到下一次日志
+func TestDeadLetterLogLimit(t *testing.T) {
+	var d deadLetters
+	if ok, suppressed := d.shouldLog(DeadLetterSendQueueFull, 1); !ok || suppressed != 0 {
+		t.Fatalf("first letter should be logged, got %v %v", ok, suppressed)
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := d.shouldLog(DeadLetterSendQueueFull, 2); ok {
+			t.Fatal("letters within the interval should not be logged")
+		}
+	}
+	if ok, _ := d.shouldLog(DeadLetterPeerUnavailable, 1); !ok {
+		t.Fatal("other reasons are limited separately")
+	}
+	d.lastLog[DeadLetterSendQueueFull].Add(-int64(deadLetterLogInterval))
+	if ok, suppressed := d.shouldLog(DeadLetterSendQueueFull, 1); !ok || suppressed != 6 {
+		t.Fatalf("expect log with 6 suppressed, got %v %v", ok, suppressed)
+	}
+}
@@ -1,6 +1,9 @@
 package client
 
 import (
+	"errors"
+	"sync/atomic"
+
 	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
 )
 
@@ -11,12 +14,23 @@ func NewNetClient() NetClient {
 
 type NetClient interface {
 	SetConnector(connector netConnect.Connector)
+	GetConnector() netConnect.Connector
 	SetOnConnect(func())
 	SetOnDisconnect(func())
 	SetOnMessage(func(msgId uint32, data []byte) error)
 	Connect() error
 	Disconnect() error
 	SendMessage(msgId uint32, data []byte) error
+	// SendBuffer 发送 buf.Data()：帧头写进预留区，写出后回收 buf。调用后 buf 归 engine 所有，出错时也已回收
+	SendBuffer(msgId uint32, buf *netConnect.Buffer) error
+	// SetCompressor 设置帧压缩算法，设置后即可解压收到的压缩帧
+	SetCompressor(compressor netConnect.Compressor)
+	// SetFrameEncoder 设置发送侧帧编码（版本/压缩/CRC）；nil 为 v1 不压缩（默认）
+	SetFrameEncoder(encoder *netConnect.FrameEncoder)
+	// SetMaxFrameSize 接收帧的最大 data 长度，<= 0 使用 netConnect.DefaultMaxFrameSize；须在 Connect 前设置
+	SetMaxFrameSize(maxFrameSize int)
+	// SetOnFrameRejected 收到超长帧时回调（随后连接断开）
+	SetOnFrameRejected(func(remoteAddr string, err *netConnect.FrameTooLargeError))
 }
 
 type netClient struct {
@@ -25,12 +39,19 @@ type netClient struct {
 	onDisconnect func()
 	onMessage    func(t uint32, data []byte) error
 	splitter     netConnect.PacketSplitter
+	compressor   netConnect.Compressor
+	encoder      atomic.Pointer[netConnect.FrameEncoder]
+	onRejected   func(remoteAddr string, err *netConnect.FrameTooLargeError)
 }
 
 func (c *netClient) SetConnector(connector netConnect.Connector) {
 	c.connector = connector
 }
 
+func (c *netClient) GetConnector() netConnect.Connector {
+	return c.connector
+}
+
 func (c *netClient) SetOnConnect(f func()) {
 	c.onConnect = f
 }
@@ -57,11 +78,26 @@ func (c *netClient) Connect() error {
 	c.connector.SetOnData(func(data []byte) error {
 		c.splitter.Append(data)
 		for {
-			msgId, payload, ok := c.splitter.Next()
+			frame, ok, err := c.splitter.Next()
+			if err != nil {
+				var tooLarge *netConnect.FrameTooLargeError
+				if errors.As(err, &tooLarge) && c.onRejected != nil {
+					c.onRejected(c.connector.RemoteAddr(), tooLarge)
+				}
+				return err
+			}
 			if !ok {
 				return nil
 			}
-			c.onMessage(msgId, payload)
+			payload, err := netConnect.UnpackFrame(frame, c.compressor, c.splitter.MaxFrameSize())
+			if err != nil {
+				var tooLarge *netConnect.FrameTooLargeError
+				if errors.As(err, &tooLarge) && c.onRejected != nil {
+					c.onRejected(c.connector.RemoteAddr(), tooLarge)
+				}
+				return err
+			}
+			c.onMessage(frame.MsgId, payload)
 		}
 	})
 	return c.connector.Connect()
@@ -72,9 +108,33 @@ func (c *netClient) Disconnect() error {
 }
 
 func (c *netClient) SendMessage(msgId uint32, data []byte) error {
-	pkt, err := netConnect.PackMessage(msgId, data)
+	pkt, err := c.encoder.Load().Pack(msgId, data)
 	if err != nil {
 		return err
 	}
 	return c.connector.SendData(pkt)
 }
+
+func (c *netClient) SendBuffer(msgId uint32, buf *netConnect.Buffer) error {
+	if err := c.encoder.Load().PackBuffer(msgId, buf); err != nil {
+		netConnect.PutBuffer(buf)
+		return err
+	}
+	return netConnect.SendBuffer(c.connector, buf)
+}
+
+func (c *netClient) SetCompressor(compressor netConnect.Compressor) {
+	c.compressor = compressor
+}
+
+func (c *netClient) SetFrameEncoder(encoder *netConnect.FrameEncoder) {
+	c.encoder.Store(encoder)
+}
+
+func (c *netClient) SetMaxFrameSize(maxFrameSize int) {
+	c.splitter.SetMaxFrameSize(maxFrameSize)
+}
+
+func (c *netClient) SetOnFrameRejected(f func(remoteAddr string, err *netConnect.FrameTooLargeError)) {
+	c.onRejected = f
+}
@@ -0,0 +1,70 @@
+package netConnect
+
+import "sync"
+
+// MaxFrameHeaderSize 各版本帧头的最大长度（v2 + CRC）。发送缓冲区在 data 前预留这么多字节，
+// 打包时帧头直接写进预留区，data 不需要再拷贝一次。
+const MaxFrameHeaderSize = FrameV2HeaderSize + FrameV2CRCSize
+
+// maxPooledBufferSize 超过该容量的缓冲区用完直接丢弃，避免偶发的大消息长期占用内存。
+const maxPooledBufferSize = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return &Buffer{B: make([]byte, MaxFrameHeaderSize, 512)}
+	},
+}
+
+// Buffer 可回收的发送缓冲区。B[:MaxFrameHeaderSize] 为帧头预留区，调用方把 data 追加到其后：
+//
+//	buf := netConnect.GetBuffer()
+//	buf.B, err = proto.MarshalOptions{}.MarshalAppend(buf.B, msg)
+//
+// 交给 SendBuffer 后缓冲区归 engine 所有，写出后自动回收，调用方不得再使用。
+type Buffer struct {
+	B []byte
+	// Priority 发送通道，GetBuffer 时重置为 PriorityNormal
+	Priority Priority
+	off      int
+}
+
+// GetBuffer 从池中取一个缓冲区，B 只含帧头预留区。
+func GetBuffer() *Buffer {
+	buf := bufferPool.Get().(*Buffer)
+	buf.B = buf.B[:MaxFrameHeaderSize]
+	buf.off = MaxFrameHeaderSize
+	buf.Priority = PriorityNormal
+	return buf
+}
+
+// PutBuffer 归还缓冲区。
+func PutBuffer(buf *Buffer) {
+	if buf == nil || cap(buf.B) > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// Data 返回预留区之后的 data。
+func (b *Buffer) Data() []byte {
+	return b.B[MaxFrameHeaderSize:]
+}
+
+// Bytes 返回打包后的完整帧（帧头 + data），仅在 FrameEncoder.PackBuffer 之后有意义。
+func (b *Buffer) Bytes() []byte {
+	return b.B[b.off:]
+}
+
+// BufferConn 由支持缓冲区回收的 Conn 额外实现：帧写出后把 Buffer 归还池中。
+// 未实现的 Conn 退化为 SendData(buf.Bytes())，缓冲区交给 GC。
+type BufferConn interface {
+	SendBuffer(buf *Buffer) error
+}
+
+// SendBuffer 通过 conn 发送已打包的 buf，conn 不支持回收时退化为 SendData。
+func SendBuffer(conn Conn, buf *Buffer) error {
+	if bc, ok := conn.(BufferConn); ok {
+		return bc.SendBuffer(buf)
+	}
+	return conn.SendData(buf.Bytes())
+}
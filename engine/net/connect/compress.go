@@ -0,0 +1,71 @@
+package netConnect
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// Compressor 帧压缩算法。同一链路两端必须使用相同实现；实现需并发安全。
+// Decompress 解压结果超过 max 字节时须返回 *FrameTooLargeError，防止小帧膨胀成超大 data（解压炸弹）。
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte, max int) ([]byte, error)
+}
+
+// NewFlateCompressor 基于标准库 compress/flate 的 Compressor，writer/reader 池化复用。
+func NewFlateCompressor(level int) Compressor {
+	return &flateCompressor{level: level}
+}
+
+type flateCompressor struct {
+	level   int
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func (c *flateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(data) / 2)
+	w, _ := c.writers.Get().(*flate.Writer)
+	if w == nil {
+		var err error
+		w, err = flate.NewWriter(&buf, c.level)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		w.Reset(&buf)
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *flateCompressor) Decompress(data []byte, max int) ([]byte, error) {
+	src := bytes.NewReader(data)
+	r, _ := c.readers.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReader(src)
+	} else {
+		r.(flate.Resetter).Reset(src, nil)
+	}
+	defer c.readers.Put(r)
+	var buf bytes.Buffer
+	buf.Grow(min(len(data)*2, max))
+	// 多读 1 字节用来判断是否超限
+	n, err := io.Copy(&buf, io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(max) {
+		return nil, &FrameTooLargeError{Size: uint64(n), Max: max}
+	}
+	return buf.Bytes(), nil
+}
@@ -1,5 +1,7 @@
 package netConnect
 
+import "crypto/x509"
+
 type OnDisconnectFunc func()
 type OnDataFunc func([]byte) error
 
@@ -10,3 +12,9 @@ type Conn interface {
 	SetOnDisconnect(OnDisconnectFunc)
 	SetOnData(OnDataFunc)
 }
+
+// SecureConn 由加密传输（TLS）的 Conn 额外实现，上层据此读取对端证书做身份校验。
+type SecureConn interface {
+	// PeerCertificates 返回对端证书链（叶子证书在前）；非 TLS 或握手未完成时返回 nil。
+	PeerCertificates() []*x509.Certificate
+}
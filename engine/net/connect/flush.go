@@ -0,0 +1,23 @@
+package netConnect
+
+import "time"
+
+// FlushPolicy 发送侧写合并策略。sender 每次取出队列中已有的全部帧，合并成尽量少的写调用
+// （明文 TCP/unix 用 writev，TLS 拼成一块后写出）。零值：有多少合并多少、立即写出。
+type FlushPolicy struct {
+	// MaxBatchBytes: 单次写调用最多合并的字节数（至少一帧）；0 不限制。设为 1 等价于逐帧写
+	MaxBatchBytes int
+	// Delay: 取到的帧不足 MaxBatchBytes 时再等待 Delay 收集后续帧，以少量延迟换吞吐；
+	// 0 立即写出（延迟优先）
+	Delay time.Duration
+}
+
+// ShouldWait 本批 size 字节是否还需按 Delay 等待更多帧。
+func (p *FlushPolicy) ShouldWait(size int) bool {
+	return p.Delay > 0 && (p.MaxBatchBytes <= 0 || size < p.MaxBatchBytes)
+}
+
+// Split 判断已合并 size 字节后再加入 next 字节是否应先写出当前批。
+func (p *FlushPolicy) Split(size, next int) bool {
+	return p.MaxBatchBytes > 0 && size > 0 && size+next > p.MaxBatchBytes
+}
@@ -0,0 +1,45 @@
+package memNetConnect
+
+import (
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+)
+
+func NewAcceptor() *AcceptorMem {
+	v := &AcceptorMem{
+		stopChan: make(chan struct{}),
+	}
+	return v
+}
+
+type AcceptorMem struct {
+	onAcceptFunc netConnect.OnAcceptFunc
+	address      string
+	stopChan     chan struct{}
+}
+
+// Start 在注册表中登记地址后阻塞，直到 Stop（与 socket 实现的 Accept 循环对应）。
+func (this *AcceptorMem) Start() error {
+	if err := register(this.address, this); err != nil {
+		return err
+	}
+	<-this.stopChan
+	return nil
+}
+
+func (this *AcceptorMem) Stop() error {
+	unregister(this.address, this)
+	select {
+	case <-this.stopChan:
+	default:
+		close(this.stopChan)
+	}
+	return nil
+}
+
+func (this *AcceptorMem) SetOnAccept(onAcceptFunc netConnect.OnAcceptFunc) {
+	this.onAcceptFunc = onAcceptFunc
+}
+
+func (this *AcceptorMem) SetAddress(address string) {
+	this.address = address
+}
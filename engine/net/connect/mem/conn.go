@@ -0,0 +1,90 @@
+package memNetConnect
+
+import (
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+)
+
+func newConn(address string) *ConnMem {
+	v := new(ConnMem)
+	v.q = netConnect.NewSendQueue()
+	v.address = address
+	return v
+}
+
+// ConnMem 进程内连接的一端。sender goroutine 从自己的队列取数据并直接回调对端的 OnData，
+// 语义与 socket 实现一致：主动 Disconnect 的一端不回调 OnDisconnect，对端回调。
+type ConnMem struct {
+	q                *netConnect.SendQueue
+	peer             *ConnMem
+	address          string
+	onDisconnectFunc netConnect.OnDisconnectFunc
+	onDataFunc       netConnect.OnDataFunc
+}
+
+func (this *ConnMem) RemoteAddr() string {
+	return this.address
+}
+
+func (this *ConnMem) Disconnect() error {
+	return this.q.Close()
+}
+
+func (this *ConnMem) SendData(data []byte) error {
+	return this.q.Enqueue(data)
+}
+
+// SendBuffer 实现 netConnect.BufferConn，对端处理完后归还 buf。
+func (this *ConnMem) SendBuffer(buf *netConnect.Buffer) error {
+	return this.q.Enqueue(buf)
+}
+
+// SetSendLimit 实现 netConnect.QueuedConn。
+func (this *ConnMem) SetSendLimit(limit netConnect.SendLimit) {
+	this.q.SetSendLimit(limit)
+}
+
+func (this *ConnMem) SendQueueStats() netConnect.SendQueueStats {
+	return this.q.Stats()
+}
+
+func (this *ConnMem) SetOnDisconnect(onDisconnectFunc netConnect.OnDisconnectFunc) {
+	this.onDisconnectFunc = onDisconnectFunc
+}
+
+func (this *ConnMem) SetOnData(onDataFunc netConnect.OnDataFunc) {
+	this.onDataFunc = onDataFunc
+}
+
+// peerClosed 对端关闭，相当于 socket 读到 EOF。
+func (this *ConnMem) peerClosed() {
+	if !this.q.IsClose() {
+		this.Disconnect()
+		this.onDisconnectFunc()
+	}
+}
+
+func (this *ConnMem) senderRun() {
+	for {
+		data, ok := this.q.Dequeue()
+		if !ok {
+			this.peer.peerClosed()
+			return
+		}
+		var msg []byte
+		buf, pooled := data.(*netConnect.Buffer)
+		if pooled {
+			msg = buf.Bytes()
+		} else {
+			msg = data.([]byte)
+		}
+		if !this.peer.q.IsClose() {
+			// 对端处理出错与 socket receiver 一致：对端断开
+			if err := this.peer.onDataFunc(msg); err != nil {
+				this.peer.peerClosed()
+			}
+		}
+		if pooled {
+			netConnect.PutBuffer(buf)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package memNetConnect
+
+import (
+	"fmt"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+)
+
+func NewConnector() *ConnectorMem {
+	v := &ConnectorMem{
+		ConnMem: newConn(""),
+	}
+	return v
+}
+
+type ConnectorMem struct {
+	onConnectFunc netConnect.OnConnectFunc
+	*ConnMem
+	address string
+}
+
+func (this *ConnectorMem) Connect() error {
+	acceptor, ok := lookup(this.address)
+	if !ok {
+		return fmt.Errorf("mem address %v connection refused", this.address)
+	}
+	remote := newConn(this.address)
+	this.ConnMem.peer = remote
+	remote.peer = this.ConnMem
+	// 先让 acceptor 设置好回调再启动收发
+	acceptor.onAcceptFunc(remote)
+	go this.senderRun()
+	go remote.senderRun()
+	this.onConnectFunc()
+	return nil
+}
+
+func (this *ConnectorMem) SetOnConnect(onConnectFunc netConnect.OnConnectFunc) {
+	this.onConnectFunc = onConnectFunc
+}
+
+func (this *ConnectorMem) SetAddress(address string) {
+	this.address = address
+	this.ConnMem.address = address
+}
@@ -0,0 +1,39 @@
+package memNetConnect
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 进程内 acceptor 注册表，按地址索引。多个 cluster system 在同一进程（如 go test）中通过它互连，不占用端口。
+var registry = struct {
+	lock      sync.Mutex
+	acceptors map[string]*AcceptorMem
+}{
+	acceptors: make(map[string]*AcceptorMem),
+}
+
+func register(address string, acceptor *AcceptorMem) error {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if _, ok := registry.acceptors[address]; ok {
+		return fmt.Errorf("mem address %v already in use", address)
+	}
+	registry.acceptors[address] = acceptor
+	return nil
+}
+
+func unregister(address string, acceptor *AcceptorMem) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if registry.acceptors[address] == acceptor {
+		delete(registry.acceptors, address)
+	}
+}
+
+func lookup(address string) (*AcceptorMem, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	acceptor, ok := registry.acceptors[address]
+	return acceptor, ok
+}
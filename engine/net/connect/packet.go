@@ -2,54 +2,323 @@ package netConnect
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 )
 
-// 线协议帧格式: len(4,大端,仅data长度) + msgId(1) + data
+// 线协议帧格式，接收侧按首字节自动识别：
+//
+//	v1: len(4,大端,仅data长度) + msgId(1) + data
+//	    msgId 字节最高位是压缩标志（v1FlagCompressed），实际 msgId 只占低 7 位。
+//	v2: magic(1)=0xF2 + flags(1) + msgId(2,大端) + len(4,大端) + [crc32c(4)，flags 含 FrameFlagCRC 时] + data
+//
+// v1 的首字节是 len 的最高字节，只有 data 接近 4GB 时才可能等于 0xF2，因此两种格式可以在同一条流上混用。
 const (
 	PacketHeaderSize = 5
-	MaxMsgId         = 0xFF
+	MaxMsgId         = 0x7F
+
+	FrameV2Magic      = 0xF2
+	FrameV2HeaderSize = 8
+	FrameV2CRCSize    = 4
+	MaxMsgIdV2        = 0xFFFF
+	// DefaultMaxFrameSize PacketSplitter 默认允许的最大 data 长度（线上字节，压缩帧按压缩后计）
+	DefaultMaxFrameSize     = 16 << 20
+	v1FlagCompressed        = 0x80
+	FrameVersion1       int = 1
+	FrameVersion2       int = 2
+)
+
+// 帧标志位（v2 的 flags 字节；v1 只能表达 FrameFlagCompressed）
+const (
+	FrameFlagCompressed uint8 = 1 << iota
+	FrameFlagCRC
+	frameFlagsKnown = FrameFlagCompressed | FrameFlagCRC
+)
+
+var (
+	ErrFrameCRC   = errors.New("frame crc mismatch")
+	ErrFrameFlags = errors.New("frame has unknown flags")
+	crc32cTable   = crc32.MakeTable(crc32.Castagnoli)
 )
 
-// PackMessage 打包一帧数据。msgId 超过 1 字节范围时返回错误（防止静默截断）。
+// FrameTooLargeError 帧头声明的 data 长度（或压缩帧解压后的长度）超过 PacketSplitter 的上限。
+// 收到后流已不可信（可能是损坏或恶意的长度字段），调用方应断开连接。
+type FrameTooLargeError struct {
+	Size uint64
+	Max  int
+}
+
+func (e *FrameTooLargeError) Error() string {
+	return fmt.Sprintf("frame size %v exceeds max %v", e.Size, e.Max)
+}
+
+// Frame 是 PacketSplitter 切出的一帧，MsgId 已去掉标志位。
+type Frame struct {
+	MsgId   uint32
+	Flags   uint8
+	Payload []byte
+}
+
+// PackMessage 按 v1 格式打包一帧数据。msgId 超过 7 位范围时返回错误（防止静默截断或误置标志位）。
 func PackMessage(msgId uint32, data []byte) ([]byte, error) {
 	if msgId > MaxMsgId {
-		return nil, fmt.Errorf("msgId %v exceeds 1 byte range (max %v)", msgId, MaxMsgId)
+		return nil, fmt.Errorf("msgId %v exceeds max %v", msgId, MaxMsgId)
+	}
+	return defaultFrameEncoder.Pack(msgId, data)
+}
+
+// frameHeaderSize 返回帧头长度。
+func frameHeaderSize(version int, flags uint8) int {
+	if version != FrameVersion2 {
+		return PacketHeaderSize
+	}
+	if flags&FrameFlagCRC != 0 {
+		return FrameV2HeaderSize + FrameV2CRCSize
+	}
+	return FrameV2HeaderSize
+}
+
+// putFrameHeader 把帧头写入 dst，dst 长度须等于 frameHeaderSize。
+func putFrameHeader(dst []byte, version int, msgId uint32, flags uint8, data []byte) {
+	if version != FrameVersion2 {
+		binary.BigEndian.PutUint32(dst[:4], uint32(len(data)))
+		dst[4] = uint8(msgId)
+		if flags&FrameFlagCompressed != 0 {
+			dst[4] |= v1FlagCompressed
+		}
+		return
+	}
+	dst[0] = FrameV2Magic
+	dst[1] = flags
+	binary.BigEndian.PutUint16(dst[2:4], uint16(msgId))
+	binary.BigEndian.PutUint32(dst[4:8], uint32(len(data)))
+	if flags&FrameFlagCRC != 0 {
+		binary.BigEndian.PutUint32(dst[8:12], crc32.Checksum(data, crc32cTable))
+	}
+}
+
+// FrameEncoder 发送侧的帧编码配置，按链路设置。nil 或零值等价于 v1、不压缩。
+type FrameEncoder struct {
+	// Version: FrameVersion1 或 FrameVersion2，对端不认识 v2 时必须用 v1
+	Version int
+	// Compressor/Threshold: data 不小于 Threshold 字节时压缩；Compressor 为 nil 或 Threshold <= 0 不压缩
+	Compressor Compressor
+	Threshold  int
+	// CRC: 附加 payload 的 CRC32C，仅 v2 有效
+	CRC bool
+}
+
+var defaultFrameEncoder = &FrameEncoder{Version: FrameVersion1}
+
+// prepare 检查 msgId 并按需压缩，返回实际发送的 data 与帧标志。压缩后没有变小时原样发送。
+func (e *FrameEncoder) prepare(msgId uint32, data []byte) ([]byte, uint8, error) {
+	v2 := e.Version == FrameVersion2
+	if (!v2 && msgId > MaxMsgId) || msgId > MaxMsgIdV2 {
+		return nil, 0, fmt.Errorf("msgId %v exceeds frame v%v range", msgId, e.Version)
+	}
+	var flags uint8
+	if e.Compressor != nil && e.Threshold > 0 && len(data) >= e.Threshold {
+		compressed, err := e.Compressor.Compress(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(compressed) < len(data) {
+			data = compressed
+			flags |= FrameFlagCompressed
+		}
+	}
+	if v2 && e.CRC {
+		flags |= FrameFlagCRC
+	}
+	return data, flags, nil
+}
+
+// Pack 按配置打包一帧，返回新分配的帧。热路径请用 PackBuffer。
+func (e *FrameEncoder) Pack(msgId uint32, data []byte) ([]byte, error) {
+	if e == nil {
+		e = defaultFrameEncoder
+	}
+	data, flags, err := e.prepare(msgId, data)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := frameHeaderSize(e.Version, flags)
+	pkt := make([]byte, headerSize, headerSize+len(data))
+	putFrameHeader(pkt, e.Version, msgId, flags, data)
+	return append(pkt, data...), nil
+}
+
+// PackBuffer 把 buf.Data() 原地打包成一帧：帧头写进预留区，未压缩时 data 不拷贝。
+// 打包后用 buf.Bytes() 取完整帧。
+func (e *FrameEncoder) PackBuffer(msgId uint32, buf *Buffer) error {
+	if e == nil {
+		e = defaultFrameEncoder
+	}
+	data, flags, err := e.prepare(msgId, buf.Data())
+	if err != nil {
+		return err
+	}
+	if flags&FrameFlagCompressed != 0 {
+		buf.B = append(buf.B[:MaxFrameHeaderSize], data...)
+		data = buf.Data()
+	}
+	buf.off = MaxFrameHeaderSize - frameHeaderSize(e.Version, flags)
+	putFrameHeader(buf.B[buf.off:MaxFrameHeaderSize], e.Version, msgId, flags, data)
+	return nil
+}
+
+// UnpackFrame 还原帧的原始 data：压缩帧用 compressor 解压，解压结果同样受 maxFrameSize 限制。
+func UnpackFrame(frame Frame, compressor Compressor, maxFrameSize int) ([]byte, error) {
+	if frame.Flags&FrameFlagCompressed == 0 {
+		return frame.Payload, nil
+	}
+	if compressor == nil {
+		return nil, fmt.Errorf("msgId %v compressed but no compressor", frame.MsgId)
 	}
-	l := len(data)
-	pkt := make([]byte, PacketHeaderSize, PacketHeaderSize+l)
-	binary.BigEndian.PutUint32(pkt[:4], uint32(l))
-	pkt[4] = uint8(msgId)
-	pkt = append(pkt, data...)
-	return pkt, nil
+	return compressor.Decompress(frame.Payload, maxFrameSize)
 }
 
-// PacketSplitter 处理 TCP 粘包/半包，累积字节流并按帧切分。
+// PacketSplitter 处理 TCP 粘包/半包，累积字节流并按帧切分，v1/v2 帧可混合出现。
+//
+// 缓冲区为空时 Append 直接借用传入的 data（零拷贝），Next 返回 ok=false 时才把残留的半包
+// 转存到自有缓冲区；因此调用方须在每次 Append 后循环 Next 直到 ok=false 或出错，
+// 且 Next 返回的 Payload 只在下一次 Append 之前有效。
 type PacketSplitter struct {
-	buf []byte
+	buf          []byte // 未处理的字节
+	own          []byte // 自有存储，buf 未借用时指向其中
+	borrowed     bool
+	maxFrameSize int
+}
+
+// maxRetainedSplitBuffer 缓冲区清空后，超过该容量的自有存储被释放，避免大帧之后长期驻留。
+const maxRetainedSplitBuffer = 64 << 10
+
+// SetMaxFrameSize 设置允许的最大 data 长度，<= 0 使用 DefaultMaxFrameSize。
+// 帧头一到就检查，不会等超长 data 累积到缓冲区。
+func (p *PacketSplitter) SetMaxFrameSize(maxFrameSize int) {
+	p.maxFrameSize = maxFrameSize
 }
 
-// Append 追加收到的字节（内部拷贝，调用方可安全复用读缓冲）。
+// MaxFrameSize 返回生效的最大 data 长度。
+func (p *PacketSplitter) MaxFrameSize() int {
+	if p.maxFrameSize <= 0 {
+		return DefaultMaxFrameSize
+	}
+	return p.maxFrameSize
+}
+
+func (p *PacketSplitter) checkSize(size uint64) error {
+	maxFrameSize := p.MaxFrameSize()
+	if size > uint64(maxFrameSize) {
+		return &FrameTooLargeError{Size: size, Max: maxFrameSize}
+	}
+	return nil
+}
+
+// Append 追加收到的字节。data 在本轮 Next 循环结束（ok=false）之前必须保持不变。
 func (p *PacketSplitter) Append(data []byte) {
-	p.buf = append(p.buf, data...)
+	if len(p.buf) == 0 {
+		p.buf, p.borrowed = data, true
+		return
+	}
+	if !p.borrowed && cap(p.buf)-len(p.buf) >= len(data) {
+		p.buf = append(p.buf, data...)
+		return
+	}
+	// 借用的数据或尾部空间不足：残留字节挪到自有存储开头再追加
+	p.own = append(append(p.own[:0], p.buf...), data...)
+	p.buf, p.borrowed = p.own, false
+}
+
+// retain 把借用的残留字节转存到自有存储。
+func (p *PacketSplitter) retain() {
+	if !p.borrowed {
+		return
+	}
+	p.own = append(p.own[:0], p.buf...)
+	p.buf, p.borrowed = p.own, false
+}
+
+// Next 尝试取下一帧。ok=false 且 err=nil 表示数据不足，需等待更多字节；
+// err 非 nil 表示流已损坏（CRC 不符、未知标志位、超过最大帧长），调用方应断开连接。
+func (p *PacketSplitter) Next() (frame Frame, ok bool, err error) {
+	if len(p.buf) == 0 {
+		p.buf, p.borrowed = nil, false
+		return frame, false, nil
+	}
+	var frameLen int
+	if p.buf[0] == FrameV2Magic {
+		frame, frameLen, err = p.peekV2()
+	} else {
+		frame, frameLen, err = p.peekV1()
+	}
+	if err != nil {
+		return frame, false, err
+	}
+	if frameLen == 0 {
+		p.retain()
+		return frame, false, nil
+	}
+	p.buf = p.buf[frameLen:]
+	if len(p.buf) == 0 {
+		p.buf, p.borrowed = nil, false
+		if cap(p.own) > maxRetainedSplitBuffer {
+			p.own = nil
+		}
+	}
+	return frame, true, nil
 }
 
-// Next 尝试取下一帧。ok=false 表示数据不足，需等待更多字节。
-func (p *PacketSplitter) Next() (msgId uint32, payload []byte, ok bool) {
-	l := uint32(len(p.buf))
+// peekV1 解析缓冲区头部的 v1 帧，数据不足时 frameLen 为 0。
+func (p *PacketSplitter) peekV1() (frame Frame, frameLen int, err error) {
+	l := uint64(len(p.buf))
 	if l < PacketHeaderSize {
-		return 0, nil, false
+		return frame, 0, nil
+	}
+	dataLen := uint64(binary.BigEndian.Uint32(p.buf[0:4]))
+	if err = p.checkSize(dataLen); err != nil {
+		return frame, 0, err
 	}
-	dataLen := binary.BigEndian.Uint32(p.buf[0:4])
 	msgLen := dataLen + PacketHeaderSize
 	if l < msgLen {
-		return 0, nil, false
+		return frame, 0, nil
 	}
-	msgId = uint32(p.buf[4])
-	payload = p.buf[PacketHeaderSize:msgLen]
-	p.buf = p.buf[msgLen:]
-	if len(p.buf) == 0 {
-		p.buf = nil // 释放底层数组，避免长连接内存驻留
+	idByte := p.buf[4]
+	frame.MsgId = uint32(idByte &^ v1FlagCompressed)
+	if idByte&v1FlagCompressed != 0 {
+		frame.Flags = FrameFlagCompressed
+	}
+	frame.Payload = p.buf[PacketHeaderSize:msgLen]
+	return frame, int(msgLen), nil
+}
+
+// peekV2 解析缓冲区头部的 v2 帧，数据不足时 frameLen 为 0。
+func (p *PacketSplitter) peekV2() (frame Frame, frameLen int, err error) {
+	l := uint64(len(p.buf))
+	if l < FrameV2HeaderSize {
+		return frame, 0, nil
+	}
+	frame.Flags = p.buf[1]
+	if frame.Flags&^frameFlagsKnown != 0 {
+		return frame, 0, ErrFrameFlags
+	}
+	frame.MsgId = uint32(binary.BigEndian.Uint16(p.buf[2:4]))
+	headerSize := uint64(FrameV2HeaderSize)
+	if frame.Flags&FrameFlagCRC != 0 {
+		headerSize += FrameV2CRCSize
+	}
+	dataLen := uint64(binary.BigEndian.Uint32(p.buf[4:8]))
+	if err = p.checkSize(dataLen); err != nil {
+		return frame, 0, err
+	}
+	msgLen := dataLen + headerSize
+	if l < msgLen {
+		return frame, 0, nil
+	}
+	frame.Payload = p.buf[headerSize:msgLen]
+	if frame.Flags&FrameFlagCRC != 0 && binary.BigEndian.Uint32(p.buf[8:12]) != crc32.Checksum(frame.Payload, crc32cTable) {
+		return frame, 0, ErrFrameCRC
 	}
-	return msgId, payload, true
+	return frame, int(msgLen), nil
 }
@@ -0,0 +1,291 @@
+package netConnect
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	queueImpRing "github.com/kofplayer/dvactor/engine/queue/imp/ring"
+)
+
+// OverflowPolicy 发送队列超过高水位时的处理策略。
+type OverflowPolicy int
+
+const (
+	// OverflowBlock 阻塞调用方直到有空间，超过 BlockTimeout 返回 ErrSendQueueFull
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest 丢弃正在发送的帧，返回 ErrSendQueueDropped
+	OverflowDropNewest
+	// OverflowDropOldest 丢弃队首最旧的帧直到放得下，被丢的帧经 SendLimit.OnDrop 通知
+	OverflowDropOldest
+	// OverflowFail 直接返回 ErrSendQueueFull
+	OverflowFail
+)
+
+// DefaultSendBlockTimeout SendLimit.BlockTimeout 为 0 时的阻塞超时。
+const DefaultSendBlockTimeout = time.Second
+
+var (
+	ErrSendQueueFull   = errors.New("send queue full")
+	ErrSendQueueClosed = errors.New("closed")
+	// ErrSendQueueDropped OverflowDropNewest 丢弃了本帧；流未受影响，调用方可据此记录丢失
+	ErrSendQueueDropped = errors.New("send queue full, frame dropped")
+)
+
+// SendLimit 发送队列的高水位（按待写字节计）与溢出策略。零值表示不限制。
+type SendLimit struct {
+	// HighWatermark: 队列中待写字节上限；0 不限制。队列为空时单帧超过上限也会放行
+	HighWatermark int
+	Policy        OverflowPolicy
+	// BlockTimeout: OverflowBlock 的最长等待；0 使用 DefaultSendBlockTimeout
+	BlockTimeout time.Duration
+	// OnDrop: OverflowDropOldest 丢弃已入队的帧后调用，frames 为本次丢弃的帧数；
+	// 在 Enqueue 的调用方 goroutine 中执行，不持队列锁
+	OnDrop func(frames int)
+}
+
+// SendQueueStats 发送队列的当前深度与累计丢帧数。
+type SendQueueStats struct {
+	Frames  int
+	Bytes   int
+	Dropped uint64
+}
+
+// QueuedConn 由带发送队列的 Conn 额外实现，上层据此按链路设置上限并读取深度。
+type QueuedConn interface {
+	SetSendLimit(limit SendLimit)
+	SendQueueStats() SendQueueStats
+}
+
+// Priority 发送通道。高优先级通道的帧总是先于普通通道写出，且不受 SendLimit 限制，
+// 用于注册、watch、流信用等控制帧，避免排在大批数据之后。
+type Priority uint8
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+	priorityCount
+)
+
+// SendQueue 是 Conn 的发送队列：按优先级分通道，普通通道按字节记账并执行 SendLimit。
+// 深度在 sender 取出时扣减，已取出正在写的一批不计入。
+type SendQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	lanes    [priorityCount]*queueImpRing.RingBuffer[interface{}]
+	closed   bool
+	limit    SendLimit
+	frames   int
+	bytes    int
+	// limited 普通通道的字节数，只有它受 SendLimit 约束
+	limited int
+	dropped atomic.Uint64
+}
+
+func NewSendQueue() *SendQueue {
+	sq := &SendQueue{}
+	sq.notEmpty = sync.NewCond(&sq.mu)
+	sq.notFull = sync.NewCond(&sq.mu)
+	for i := range sq.lanes {
+		sq.lanes[i] = queueImpRing.NewRingBuffer[interface{}](32)
+	}
+	return sq
+}
+
+func itemSize(item interface{}) int {
+	if buf, ok := item.(*Buffer); ok {
+		return len(buf.Bytes())
+	}
+	return len(item.([]byte))
+}
+
+// itemPriority []byte 帧走普通通道，*Buffer 按其 Priority。
+func itemPriority(item interface{}) Priority {
+	if buf, ok := item.(*Buffer); ok && buf.Priority < priorityCount {
+		return buf.Priority
+	}
+	return PriorityNormal
+}
+
+func releaseItem(item interface{}) {
+	if buf, ok := item.(*Buffer); ok {
+		PutBuffer(buf)
+	}
+}
+
+// SetSendLimit 可在连接使用中修改，新上限对之后的 Enqueue 生效。
+func (sq *SendQueue) SetSendLimit(limit SendLimit) {
+	sq.mu.Lock()
+	sq.limit = limit
+	sq.mu.Unlock()
+	sq.notFull.Broadcast()
+}
+
+func (sq *SendQueue) Stats() SendQueueStats {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	return SendQueueStats{Frames: sq.frames, Bytes: sq.bytes, Dropped: sq.dropped.Load()}
+}
+
+func (sq *SendQueue) full(size int) bool {
+	return sq.limit.HighWatermark > 0 && sq.limited > 0 && sq.limited+size > sq.limit.HighWatermark
+}
+
+// Enqueue 放入一帧（[]byte 或 *Buffer）。入队失败或被丢弃时 *Buffer 已回收。
+func (sq *SendQueue) Enqueue(item interface{}) error {
+	size := itemSize(item)
+	priority := itemPriority(item)
+	var evicted int
+	var onDrop func(frames int)
+	sq.mu.Lock()
+	if priority == PriorityNormal && sq.full(size) {
+		switch sq.limit.Policy {
+		case OverflowDropNewest:
+			sq.mu.Unlock()
+			sq.dropped.Add(1)
+			releaseItem(item)
+			return ErrSendQueueDropped
+		case OverflowDropOldest:
+			lane := sq.lanes[PriorityNormal]
+			for sq.full(size) {
+				old, ok := lane.Pop()
+				if !ok {
+					break
+				}
+				sq.remove(old, PriorityNormal)
+				sq.dropped.Add(1)
+				releaseItem(old)
+				evicted++
+			}
+			onDrop = sq.limit.OnDrop
+		case OverflowFail:
+			sq.mu.Unlock()
+			releaseItem(item)
+			return ErrSendQueueFull
+		default:
+			if err := sq.waitLocked(size); err != nil {
+				sq.mu.Unlock()
+				releaseItem(item)
+				return err
+			}
+		}
+	}
+	if sq.closed {
+		sq.mu.Unlock()
+		releaseItem(item)
+		return ErrSendQueueClosed
+	}
+	sq.lanes[priority].Push(item)
+	sq.frames++
+	sq.bytes += size
+	if priority == PriorityNormal {
+		sq.limited += size
+	}
+	sq.mu.Unlock()
+	sq.notEmpty.Signal()
+	if evicted > 0 && onDrop != nil {
+		onDrop(evicted)
+	}
+	return nil
+}
+
+// waitLocked 持锁等待普通通道放得下 size 字节，超时返回 ErrSendQueueFull。
+func (sq *SendQueue) waitLocked(size int) error {
+	timeout := sq.limit.BlockTimeout
+	if timeout <= 0 {
+		timeout = DefaultSendBlockTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, sq.notFull.Broadcast)
+	defer timer.Stop()
+	for sq.full(size) && sq.limit.Policy == OverflowBlock {
+		if sq.closed {
+			return ErrSendQueueClosed
+		}
+		if !time.Now().Before(deadline) {
+			return ErrSendQueueFull
+		}
+		sq.notFull.Wait()
+	}
+	return nil
+}
+
+func (sq *SendQueue) remove(item interface{}, priority Priority) {
+	size := itemSize(item)
+	sq.frames--
+	sq.bytes -= size
+	if priority == PriorityNormal {
+		sq.limited -= size
+	}
+}
+
+// popLocked 按优先级从高到低取出帧；all 为 false 时只取一帧。
+func (sq *SendQueue) popLocked(all bool) []interface{} {
+	var items []interface{}
+	for priority := priorityCount - 1; ; priority-- {
+		lane := sq.lanes[priority]
+		for !lane.IsEmpty() {
+			item, _ := lane.Pop()
+			sq.remove(item, priority)
+			items = append(items, item)
+			if !all {
+				return items
+			}
+		}
+		if priority == 0 {
+			break
+		}
+	}
+	return items
+}
+
+// dequeue wait 为 true 时阻塞到有数据或关闭；关闭且为空时返回 false。
+func (sq *SendQueue) dequeue(all, wait bool) ([]interface{}, bool) {
+	sq.mu.Lock()
+	for wait && sq.frames == 0 && !sq.closed {
+		sq.notEmpty.Wait()
+	}
+	if sq.frames == 0 {
+		closed := sq.closed
+		sq.mu.Unlock()
+		return nil, !closed
+	}
+	items := sq.popLocked(all)
+	sq.mu.Unlock()
+	sq.notFull.Broadcast()
+	return items, true
+}
+
+func (sq *SendQueue) Dequeue() (interface{}, bool) {
+	items, ok := sq.dequeue(false, true)
+	if !ok {
+		return nil, false
+	}
+	return items[0], true
+}
+
+// DequeueBatch 取出全部帧（高优先级在前），队列为空时阻塞。
+func (sq *SendQueue) DequeueBatch() ([]interface{}, bool) {
+	return sq.dequeue(true, true)
+}
+
+func (sq *SendQueue) TryDequeueBatch() ([]interface{}, bool) {
+	return sq.dequeue(true, false)
+}
+
+func (sq *SendQueue) Close() error {
+	sq.mu.Lock()
+	sq.closed = true
+	sq.mu.Unlock()
+	sq.notEmpty.Broadcast()
+	sq.notFull.Broadcast()
+	return nil
+}
+
+func (sq *SendQueue) IsClose() bool {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	return sq.closed
+}
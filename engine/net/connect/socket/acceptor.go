@@ -1,6 +1,7 @@
 package socketNetConnect
 
 import (
+	"crypto/tls"
 	"net"
 	"strconv"
 	"time"
@@ -18,6 +19,10 @@ type AcceptorSocket struct {
 	host         string
 	port         uint16
 	listener     net.Listener
+	tlsConfig    *tls.Config
+	flush        netConnect.FlushPolicy
+	// TLS 握手超时，0 使用 TLSHandshakeTimeout
+	handshakeTimeout time.Duration
 }
 
 func (this *AcceptorSocket) Start() error {
@@ -36,7 +41,13 @@ func (this *AcceptorSocket) Start() error {
 			tcpConn.SetKeepAlive(true)
 			tcpConn.SetKeepAlivePeriod(30 * time.Second)
 		}
+		if this.tlsConfig != nil {
+			// 握手在 receiver goroutine 中带超时完成，不阻塞 Accept 循环
+			conn = tls.Server(conn, this.tlsConfig)
+		}
 		c := newConn(conn)
+		c.SetFlushPolicy(this.flush)
+		c.SetTLSHandshakeTimeout(this.handshakeTimeout)
 		this.onAcceptFunc(c)
 		go c.receiverRun()
 		go c.senderRun()
@@ -58,3 +69,18 @@ func (this *AcceptorSocket) SetAddress(host string, port uint16) {
 	this.host = host
 	this.port = port
 }
+
+// SetTLSConfig 设置后接入的连接走 TLS；nil 表示明文 TCP。
+func (this *AcceptorSocket) SetTLSConfig(tlsConfig *tls.Config) {
+	this.tlsConfig = tlsConfig
+}
+
+// SetFlushPolicy 设置接入连接的写合并策略。
+func (this *AcceptorSocket) SetFlushPolicy(policy netConnect.FlushPolicy) {
+	this.flush = policy
+}
+
+// SetTLSHandshakeTimeout 设置接入连接的 TLS 握手超时，0 使用 TLSHandshakeTimeout。
+func (this *AcceptorSocket) SetTLSHandshakeTimeout(timeout time.Duration) {
+	this.handshakeTimeout = timeout
+}
@@ -1,27 +1,37 @@
 package socketNetConnect
 
 import (
-	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"net"
+	"sort"
+	"sync"
+	"time"
 
 	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
-
-	"github.com/kofplayer/dvactor/engine/queue"
-	queueDef "github.com/kofplayer/dvactor/engine/queue/def"
 )
 
 func newConn(conn net.Conn) *ConnSocket {
 	v := new(ConnSocket)
-	v.q = queue.NewQueue(32)
+	v.q = netConnect.NewSendQueue()
 	v.conn = conn
 	return v
 }
 
 type ConnSocket struct {
-	q                queueDef.Queue
+	q                *netConnect.SendQueue
 	onDisconnectFunc netConnect.OnDisconnectFunc
 	onDataFunc       netConnect.OnDataFunc
 	conn             net.Conn
+	flush            netConnect.FlushPolicy
+	// TLS 握手超时，0 使用 TLSHandshakeTimeout
+	handshakeTimeout time.Duration
+	// receiver 与 sender 都可能发现连接断开，只回调一次 OnDisconnect
+	lostOnce sync.Once
+	// sender 复用的批次缓冲
+	bufs    net.Buffers
+	pending []*netConnect.Buffer
+	scratch []byte
 }
 
 func (this *ConnSocket) RemoteAddr() string {
@@ -31,6 +41,15 @@ func (this *ConnSocket) RemoteAddr() string {
 	return this.conn.RemoteAddr().String()
 }
 
+// PeerCertificates 实现 netConnect.SecureConn；明文连接返回 nil。
+func (this *ConnSocket) PeerCertificates() []*x509.Certificate {
+	tlsConn, ok := this.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	return tlsConn.ConnectionState().PeerCertificates
+}
+
 func (this *ConnSocket) Disconnect() error {
 	return this.q.Close()
 }
@@ -43,6 +62,20 @@ func (this *ConnSocket) SendData(data []byte) error {
 	return nil
 }
 
+// SendBuffer 实现 netConnect.BufferConn，写出后归还 buf。
+func (this *ConnSocket) SendBuffer(buf *netConnect.Buffer) error {
+	return this.q.Enqueue(buf)
+}
+
+// SetSendLimit 实现 netConnect.QueuedConn。
+func (this *ConnSocket) SetSendLimit(limit netConnect.SendLimit) {
+	this.q.SetSendLimit(limit)
+}
+
+func (this *ConnSocket) SendQueueStats() netConnect.SendQueueStats {
+	return this.q.Stats()
+}
+
 func (this *ConnSocket) SetOnDisconnect(onDisconnectFunc netConnect.OnDisconnectFunc) {
 	this.onDisconnectFunc = onDisconnectFunc
 }
@@ -52,42 +85,162 @@ func (this *ConnSocket) SetOnData(onDataFunc netConnect.OnDataFunc) {
 }
 
 func (this *ConnSocket) receiverRun() {
-	reader := bufio.NewReader(this.conn)
+	if tlsConn, ok := this.conn.(*tls.Conn); ok {
+		// 被动侧在这里完成握手（主动侧已在 Connect 中完成，此处立即返回），对端不完成握手时按超时断开
+		if err := handshake(tlsConn, this.handshakeTimeout); err != nil {
+			this.lost()
+			return
+		}
+	}
+	// 直接读入栈上缓冲，PacketSplitter 在整帧到齐时零拷贝切分
 	var buf [4096]byte
 	for {
-		n, err := reader.Read(buf[:])
+		n, err := this.conn.Read(buf[:])
 		if err != nil {
-			if !this.q.IsClose() {
-				this.Disconnect()
-				this.onDisconnectFunc()
-			}
+			this.lost()
 			return
 		}
 		err = this.onDataFunc(buf[:n])
 		if err != nil {
-			if !this.q.IsClose() {
-				this.Disconnect()
-				this.onDisconnectFunc()
-			}
+			this.lost()
 			return
 		}
 	}
 }
 
+// lost 连接异常断开：关闭发送队列并回调 OnDisconnect；本端主动 Disconnect 过时不回调。
+func (this *ConnSocket) lost() {
+	this.lostOnce.Do(func() {
+		if !this.q.IsClose() {
+			this.Disconnect()
+			this.onDisconnectFunc()
+		}
+	})
+}
+
+// SetFlushPolicy 设置写合并策略，须在连接开始收发前调用。
+func (this *ConnSocket) SetFlushPolicy(policy netConnect.FlushPolicy) {
+	this.flush = policy
+}
+
+// SetTLSHandshakeTimeout 设置 TLS 握手超时，0 使用 TLSHandshakeTimeout；须在 Connect 前调用。
+func (this *ConnSocket) SetTLSHandshakeTimeout(timeout time.Duration) {
+	this.handshakeTimeout = timeout
+}
+
 func (this *ConnSocket) senderRun() {
 	for {
-		data, ok := this.q.Dequeue()
+		items, ok := this.q.DequeueBatch()
 		if !ok {
 			this.conn.Close()
 			return
 		}
-		msg := data.([]byte)
-		for len(msg) > 0 {
-			n, err := this.conn.Write(msg)
-			if err != nil {
-				return
+		// 批次里有高优先级帧时不等待，控制帧不为攒批让路
+		if framePriority(items[0]) == netConnect.PriorityNormal && this.flush.ShouldWait(batchSize(items)) {
+			time.Sleep(this.flush.Delay)
+			if more, _ := this.q.TryDequeueBatch(); len(more) > 0 {
+				items = append(items, more...)
+				// 等待期间到达的高优先级帧排到已取出的普通帧之前，各通道内保持原顺序
+				sort.SliceStable(items, func(i, j int) bool {
+					return framePriority(items[i]) > framePriority(items[j])
+				})
+			}
+		}
+		if err := this.writeBatch(items); err != nil {
+			// 写失败后连接不可用：关闭队列与连接，让 receiver 退出，并回收仍在排队的帧
+			this.lost()
+			this.conn.Close()
+			for {
+				rest, _ := this.q.TryDequeueBatch()
+				if len(rest) == 0 {
+					return
+				}
+				releaseFrames(rest)
 			}
-			msg = msg[n:]
 		}
 	}
 }
+
+func framePriority(item interface{}) netConnect.Priority {
+	if buf, ok := item.(*netConnect.Buffer); ok {
+		return buf.Priority
+	}
+	return netConnect.PriorityNormal
+}
+
+func releaseFrames(items []interface{}) {
+	for _, item := range items {
+		if buf, ok := item.(*netConnect.Buffer); ok {
+			netConnect.PutBuffer(buf)
+		}
+	}
+}
+
+func frameBytes(item interface{}) []byte {
+	if buf, ok := item.(*netConnect.Buffer); ok {
+		return buf.Bytes()
+	}
+	return item.([]byte)
+}
+
+func batchSize(items []interface{}) int {
+	size := 0
+	for _, item := range items {
+		size += len(frameBytes(item))
+	}
+	return size
+}
+
+// writeBatch 按 FlushPolicy.MaxBatchBytes 分段写出一批帧，写完后回收池化缓冲；写失败时未写的帧同样回收。
+func (this *ConnSocket) writeBatch(items []interface{}) error {
+	size := 0
+	for i, item := range items {
+		msg := frameBytes(item)
+		if this.flush.Split(size, len(msg)) {
+			if err := this.flushBatch(); err != nil {
+				releaseFrames(items[i:])
+				return err
+			}
+			size = 0
+		}
+		this.bufs = append(this.bufs, msg)
+		if buf, ok := item.(*netConnect.Buffer); ok {
+			this.pending = append(this.pending, buf)
+		}
+		size += len(msg)
+	}
+	return this.flushBatch()
+}
+
+func (this *ConnSocket) flushBatch() error {
+	var err error
+	switch {
+	case len(this.bufs) == 1:
+		_, err = this.conn.Write(this.bufs[0])
+	case len(this.bufs) > 1:
+		switch this.conn.(type) {
+		case *net.TCPConn, *net.UnixConn:
+			// WriteTo 会消费切片本身，拷贝一份切片头以便复用底层数组
+			bufs := this.bufs
+			_, err = bufs.WriteTo(this.conn)
+		default:
+			// TLS 等不支持 writev 的连接：拼成一块写出，减少记录数与系统调用
+			this.scratch = this.scratch[:0]
+			for _, b := range this.bufs {
+				this.scratch = append(this.scratch, b...)
+			}
+			_, err = this.conn.Write(this.scratch)
+			if cap(this.scratch) > 1<<20 {
+				this.scratch = nil
+			}
+		}
+	}
+	clear(this.bufs)
+	this.bufs = this.bufs[:0]
+	for i, buf := range this.pending {
+		netConnect.PutBuffer(buf)
+		this.pending[i] = nil
+	}
+	this.pending = this.pending[:0]
+	return err
+}
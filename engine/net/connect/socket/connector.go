@@ -1,6 +1,7 @@
 package socketNetConnect
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"time"
@@ -18,10 +19,14 @@ func NewConnector() *ConnectorSocket {
 type ConnectorSocket struct {
 	onConnectFunc netConnect.OnConnectFunc
 	*ConnSocket
-	host string
-	port uint16
+	host      string
+	port      uint16
+	tlsConfig *tls.Config
 }
 
+// TLSHandshakeTimeout 默认的 TLS 握手超时时间，主动与被动两侧相同；可用 SetTLSHandshakeTimeout 单独设置。
+const TLSHandshakeTimeout = 10 * time.Second
+
 func (this *ConnectorSocket) Connect() error {
 	conn, err := net.Dial("tcp", fmt.Sprintf("%v:%v", this.host, this.port))
 	if err != nil {
@@ -34,6 +39,13 @@ func (this *ConnectorSocket) Connect() error {
 		tcpConn.SetKeepAlivePeriod(30 * time.Second)
 	}
 
+	if this.tlsConfig != nil {
+		conn, err = clientHandshake(conn, this.tlsConfig, this.handshakeTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
 	this.ConnSocket.conn = conn
 	go this.receiverRun()
 	go this.senderRun()
@@ -41,6 +53,28 @@ func (this *ConnectorSocket) Connect() error {
 	return nil
 }
 
+// clientHandshake 主动侧显式完成 TLS 握手，证书校验失败时 Connect 直接返回错误。
+func clientHandshake(conn net.Conn, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := handshake(tlsConn, timeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// handshake 在 timeout（0 为 TLSHandshakeTimeout）内完成 TLS 握手，之后清除读写截止时间。
+func handshake(tlsConn *tls.Conn, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = TLSHandshakeTimeout
+	}
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	return tlsConn.SetDeadline(time.Time{})
+}
+
 func (this *ConnectorSocket) SetOnConnect(onConnectFunc netConnect.OnConnectFunc) {
 	this.onConnectFunc = onConnectFunc
 }
@@ -49,3 +83,8 @@ func (this *ConnectorSocket) SetAddress(host string, port uint16) {
 	this.host = host
 	this.port = port
 }
+
+// SetTLSConfig 设置后 Connect 走 TLS；nil 表示明文 TCP。
+func (this *ConnectorSocket) SetTLSConfig(tlsConfig *tls.Config) {
+	this.tlsConfig = tlsConfig
+}
@@ -0,0 +1,155 @@
+package socketNetConnect
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
+)
+
+// Unix domain socket 实现，供同机节点互连，跳过 TCP 协议栈。收发逻辑与 TCP 共用 ConnSocket。
+
+func NewUnixAcceptor() *AcceptorUnix {
+	v := new(AcceptorUnix)
+	return v
+}
+
+type AcceptorUnix struct {
+	onAcceptFunc netConnect.OnAcceptFunc
+	path         string
+	listener     net.Listener
+	tlsConfig    *tls.Config
+	flush        netConnect.FlushPolicy
+	// TLS 握手超时，0 使用 TLSHandshakeTimeout
+	handshakeTimeout time.Duration
+}
+
+func (this *AcceptorUnix) Start() error {
+	if err := this.removeStale(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(this.path), 0755); err != nil {
+		return err
+	}
+	var err error
+	this.listener, err = net.Listen("unix", this.path)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := this.listener.Accept()
+		if err != nil {
+			return err
+		}
+		if this.tlsConfig != nil {
+			conn = tls.Server(conn, this.tlsConfig)
+		}
+		c := newConn(conn)
+		c.SetFlushPolicy(this.flush)
+		c.SetTLSHandshakeTimeout(this.handshakeTimeout)
+		this.onAcceptFunc(c)
+		go c.receiverRun()
+		go c.senderRun()
+	}
+}
+
+// removeStale 清理进程异常退出残留的 socket 文件；仍有进程在监听时返回错误而不是抢占。
+// 路径上不是 socket 的文件不删除，交给 Listen 报错。
+func (this *AcceptorUnix) removeStale() error {
+	fi, err := os.Stat(this.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%v exists and is not a unix socket", this.path)
+	}
+	if conn, err := net.Dial("unix", this.path); err == nil {
+		conn.Close()
+		return fmt.Errorf("unix socket %v is in use", this.path)
+	}
+	return os.Remove(this.path)
+}
+
+// Stop 关闭监听，net.UnixListener 关闭时会删除 socket 文件。
+func (this *AcceptorUnix) Stop() error {
+	if this.listener != nil {
+		this.listener.Close()
+	}
+	return nil
+}
+
+func (this *AcceptorUnix) SetOnAccept(onAcceptFunc netConnect.OnAcceptFunc) {
+	this.onAcceptFunc = onAcceptFunc
+}
+
+func (this *AcceptorUnix) SetAddress(path string) {
+	this.path = path
+}
+
+// SetTLSConfig 设置后接入的连接走 TLS；nil 表示明文。
+func (this *AcceptorUnix) SetTLSConfig(tlsConfig *tls.Config) {
+	this.tlsConfig = tlsConfig
+}
+
+// SetFlushPolicy 设置接入连接的写合并策略。
+func (this *AcceptorUnix) SetFlushPolicy(policy netConnect.FlushPolicy) {
+	this.flush = policy
+}
+
+// SetTLSHandshakeTimeout 设置接入连接的 TLS 握手超时，0 使用 TLSHandshakeTimeout。
+func (this *AcceptorUnix) SetTLSHandshakeTimeout(timeout time.Duration) {
+	this.handshakeTimeout = timeout
+}
+
+func NewUnixConnector() *ConnectorUnix {
+	v := &ConnectorUnix{
+		ConnSocket: newConn(nil),
+	}
+	return v
+}
+
+type ConnectorUnix struct {
+	onConnectFunc netConnect.OnConnectFunc
+	*ConnSocket
+	path      string
+	tlsConfig *tls.Config
+}
+
+func (this *ConnectorUnix) Connect() error {
+	conn, err := net.Dial("unix", this.path)
+	if err != nil {
+		return err
+	}
+	if this.tlsConfig != nil {
+		conn, err = clientHandshake(conn, this.tlsConfig, this.handshakeTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	this.ConnSocket.conn = conn
+	go this.receiverRun()
+	go this.senderRun()
+	this.onConnectFunc()
+	return nil
+}
+
+func (this *ConnectorUnix) SetOnConnect(onConnectFunc netConnect.OnConnectFunc) {
+	this.onConnectFunc = onConnectFunc
+}
+
+func (this *ConnectorUnix) SetAddress(path string) {
+	this.path = path
+}
+
+// SetTLSConfig 设置后 Connect 走 TLS；nil 表示明文。
+func (this *ConnectorUnix) SetTLSConfig(tlsConfig *tls.Config) {
+	this.tlsConfig = tlsConfig
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"errors"
+
 	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
 	netSession "github.com/kofplayer/dvactor/engine/net/session"
 )
@@ -19,6 +21,13 @@ type NetServer interface {
 	Start() error
 	Stop() error
 	GetSessionMgr() netSession.SessionMgr
+	// SetCompressor 设置帧压缩算法：所有 session 可解压收到的压缩帧，
+	// 发送侧按各 session 的 SetFrameEncoder 决定帧格式与是否压缩
+	SetCompressor(compressor netConnect.Compressor)
+	// SetMaxFrameSize 接收帧的最大 data 长度，<= 0 使用 netConnect.DefaultMaxFrameSize；须在 Start 前设置
+	SetMaxFrameSize(maxFrameSize int)
+	// SetOnFrameRejected 收到超长帧时回调（随后该 session 断开）
+	SetOnFrameRejected(func(remoteAddr string, err *netConnect.FrameTooLargeError))
 }
 
 type netServer struct {
@@ -27,6 +36,9 @@ type netServer struct {
 	onDisconnect func(netSession.NetSession)
 	onMessage    func(s netSession.NetSession, t uint32, data []byte) error
 	sessionMgr   netSession.SessionMgr
+	compressor   netConnect.Compressor
+	maxFrameSize int
+	onRejected   func(remoteAddr string, err *netConnect.FrameTooLargeError)
 }
 
 func (ns *netServer) SetAcceptor(acceptor netConnect.Acceptor) {
@@ -50,13 +62,21 @@ func (ns *netServer) Start() error {
 		s := ns.sessionMgr.NewSession()
 		s.SetConn(conn)
 		var splitter netConnect.PacketSplitter
+		splitter.SetMaxFrameSize(ns.maxFrameSize)
 		s.SetSendMessageFunc(func(msgId uint32, data []byte) error {
-			pkt, err := netConnect.PackMessage(msgId, data)
+			pkt, err := s.GetFrameEncoder().Pack(msgId, data)
 			if err != nil {
 				return err
 			}
 			return conn.SendData(pkt)
 		})
+		s.SetSendBufferFunc(func(msgId uint32, buf *netConnect.Buffer) error {
+			if err := s.GetFrameEncoder().PackBuffer(msgId, buf); err != nil {
+				netConnect.PutBuffer(buf)
+				return err
+			}
+			return netConnect.SendBuffer(conn, buf)
+		})
 		conn.SetOnDisconnect(func() {
 			ns.onDisconnect(s)
 			ns.sessionMgr.RemoveSession(s.GetID())
@@ -64,11 +84,26 @@ func (ns *netServer) Start() error {
 		conn.SetOnData(func(data []byte) error {
 			splitter.Append(data)
 			for {
-				msgId, payload, ok := splitter.Next()
+				frame, ok, err := splitter.Next()
+				if err != nil {
+					var tooLarge *netConnect.FrameTooLargeError
+					if errors.As(err, &tooLarge) && ns.onRejected != nil {
+						ns.onRejected(conn.RemoteAddr(), tooLarge)
+					}
+					return err
+				}
 				if !ok {
 					return nil
 				}
-				ns.onMessage(s, msgId, payload)
+				payload, err := netConnect.UnpackFrame(frame, ns.compressor, splitter.MaxFrameSize())
+				if err != nil {
+					var tooLarge *netConnect.FrameTooLargeError
+					if errors.As(err, &tooLarge) && ns.onRejected != nil {
+						ns.onRejected(conn.RemoteAddr(), tooLarge)
+					}
+					return err
+				}
+				ns.onMessage(s, frame.MsgId, payload)
 			}
 		})
 		ns.onConnect(s)
@@ -83,3 +118,15 @@ func (ns *netServer) Stop() error {
 func (ns *netServer) GetSessionMgr() netSession.SessionMgr {
 	return ns.sessionMgr
 }
+
+func (ns *netServer) SetCompressor(compressor netConnect.Compressor) {
+	ns.compressor = compressor
+}
+
+func (ns *netServer) SetMaxFrameSize(maxFrameSize int) {
+	ns.maxFrameSize = maxFrameSize
+}
+
+func (ns *netServer) SetOnFrameRejected(f func(remoteAddr string, err *netConnect.FrameTooLargeError)) {
+	ns.onRejected = f
+}
@@ -1,6 +1,8 @@
 package netSession
 
 import (
+	"sync/atomic"
+
 	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
 )
 
@@ -9,6 +11,7 @@ type SessionID uint32
 const SessionIDSize = 4
 
 type SendMessageFunc func(msgId uint32, data []byte) error
+type SendBufferFunc func(msgId uint32, buf *netConnect.Buffer) error
 
 type NetSession interface {
 	GetID() SessionID
@@ -16,9 +19,15 @@ type NetSession interface {
 	SetConn(conn netConnect.Conn)
 	SetSendMessageFunc(sendMessageFunc SendMessageFunc)
 	SendMessage(msgId uint32, data []byte) error
+	SetSendBufferFunc(sendBufferFunc SendBufferFunc)
+	// SendBuffer 发送 buf.Data()：帧头写进预留区，写出后回收 buf。调用后 buf 归 engine 所有，出错时也已回收
+	SendBuffer(msgId uint32, buf *netConnect.Buffer) error
 	GetBindObject() interface{}
 	SetBindObject(interface{})
 	Close() error
+	// SetFrameEncoder 设置发送侧帧编码（版本/压缩/CRC）；nil 为 v1 不压缩（默认）
+	SetFrameEncoder(encoder *netConnect.FrameEncoder)
+	GetFrameEncoder() *netConnect.FrameEncoder
 }
 
 type netSession struct {
@@ -26,6 +35,8 @@ type netSession struct {
 	bindObject      interface{}
 	conn            netConnect.Conn
 	sendMessageFunc SendMessageFunc
+	sendBufferFunc  SendBufferFunc
+	encoder         atomic.Pointer[netConnect.FrameEncoder]
 }
 
 func (s *netSession) GetBindObject() interface{} {
@@ -60,6 +71,14 @@ func (s *netSession) SendMessage(msgId uint32, data []byte) error {
 	return s.sendMessageFunc(msgId, data)
 }
 
+func (s *netSession) SetSendBufferFunc(sendBufferFunc SendBufferFunc) {
+	s.sendBufferFunc = sendBufferFunc
+}
+
+func (s *netSession) SendBuffer(msgId uint32, buf *netConnect.Buffer) error {
+	return s.sendBufferFunc(msgId, buf)
+}
+
 func (s *netSession) Close() error {
 	if s.conn != nil {
 		err := s.conn.Disconnect()
@@ -68,3 +87,11 @@ func (s *netSession) Close() error {
 	}
 	return nil
 }
+
+func (s *netSession) SetFrameEncoder(encoder *netConnect.FrameEncoder) {
+	s.encoder.Store(encoder)
+}
+
+func (s *netSession) GetFrameEncoder() *netConnect.FrameEncoder {
+	return s.encoder.Load()
+}
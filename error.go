@@ -1,6 +1,9 @@
 package dvactor
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/kofplayer/dvactor/protocol"
 	"github.com/kofplayer/vactor"
 )
@@ -12,9 +15,41 @@ const (
 	ErrorCodeMessageLenError        vactor.ErrorCode = vactor.ErrorCodeCustomStart + 4
 	ErrorCodeUnknownEnvelope        vactor.ErrorCode = vactor.ErrorCodeCustomStart + 5
 	ErrorCodeMessageSendFail        vactor.ErrorCode = vactor.ErrorCodeCustomStart + 6
+	ErrorCodeRegisterAuthFail       vactor.ErrorCode = vactor.ErrorCodeCustomStart + 7
+	ErrorCodeProtocolIncompatible   vactor.ErrorCode = vactor.ErrorCodeCustomStart + 8
+	ErrorCodeCapabilityNotSupported vactor.ErrorCode = vactor.ErrorCodeCustomStart + 9
+	ErrorCodeSendQueueFull          vactor.ErrorCode = vactor.ErrorCodeCustomStart + 10
+	ErrorCodeStreamNoCredit         vactor.ErrorCode = vactor.ErrorCodeCustomStart + 11
+	ErrorCodeStreamClosed           vactor.ErrorCode = vactor.ErrorCodeCustomStart + 12
+	ErrorCodeStreamBroken           vactor.ErrorCode = vactor.ErrorCodeCustomStart + 13
+	ErrorCodeMessageTypeConflict    vactor.ErrorCode = vactor.ErrorCodeCustomStart + 14
+	ErrorCodeMessageDecodeFail      vactor.ErrorCode = vactor.ErrorCodeCustomStart + 15
+	ErrorCodeActorTypeNotHosted     vactor.ErrorCode = vactor.ErrorCodeCustomStart + 16
+	ErrorCodeSendQueueDropped       vactor.ErrorCode = vactor.ErrorCodeCustomStart + 17
 	ErrorCodeCustomStart            vactor.ErrorCode = vactor.ErrorCodeCustomStart + 100
 )
 
+// DetailedError 带说明文字与可选详情的 VAError。handler 以它作为 Response 的错误时，
+// Message 与 Detail（需为已注册的消息类型）原样传到调用方；收到的远端错误也都还原为它。
+type DetailedError struct {
+	ErrorCode vactor.ErrorCode
+	Message   string
+	Detail    interface{}
+}
+
+func NewDetailedError(code vactor.ErrorCode, message string, detail interface{}) *DetailedError {
+	return &DetailedError{ErrorCode: code, Message: message, Detail: detail}
+}
+
+func (e *DetailedError) Code() vactor.ErrorCode { return e.ErrorCode }
+
+func (e *DetailedError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("vactor error %d", e.ErrorCode)
+	}
+	return fmt.Sprintf("vactor error %d: %s", e.ErrorCode, e.Message)
+}
+
 // errorCodeToVAError 把线协议错误码还原为 VAError；成功码返回 nil（保持 err == nil 语义）。
 func errorCodeToVAError(code protocol.ErrorCode) vactor.VAError {
 	if code == protocol.ErrorCode_ErrorCodeSuccess {
@@ -22,3 +57,47 @@ func errorCodeToVAError(code protocol.ErrorCode) vactor.VAError {
 	}
 	return vactor.NewVAError(vactor.ErrorCode(code))
 }
+
+// responseErrorToProto 把响应错误写入 rsp：旧字段 ErrorCode 照填，Code/ErrorMessage/ErrorDetail 供新节点还原。
+func (cn *clusterNet) responseErrorToProto(systemId vactor.SystemId, rsp *protocol.Response, err vactor.VAError) {
+	if err == nil {
+		rsp.ErrorCode = protocol.ErrorCode_ErrorCodeSuccess
+		return
+	}
+	rsp.ErrorCode = protocol.ErrorCode(err.Code())
+	rsp.Code = uint32(err.Code())
+	var detailed *DetailedError
+	if !errors.As(err, &detailed) {
+		// 普通 VAError 的默认文本只是错误码，不重复传
+		if text := err.Error(); text != vactor.NewVAError(err.Code()).Error() {
+			rsp.ErrorMessage = text
+		}
+		return
+	}
+	rsp.ErrorMessage = detailed.Message
+	if detailed.Detail != nil {
+		detail, e := cn.marshalFor(systemId, detailed.Detail)
+		if e != nil {
+			// 详情发不出去不影响错误本身
+			cn.localSystem.LogWarn("response error detail %T marshal fail: %v", detailed.Detail, e)
+			return
+		}
+		rsp.ErrorDetail = detail
+	}
+}
+
+// responseErrorFromProto 还原响应错误；旧节点只带 ErrorCode，还原为普通 VAError。
+func (cn *clusterNet) responseErrorFromProto(systemId vactor.SystemId, rsp *protocol.Response) vactor.VAError {
+	if rsp.Code == 0 {
+		return errorCodeToVAError(rsp.ErrorCode)
+	}
+	err := &DetailedError{ErrorCode: vactor.ErrorCode(rsp.Code), Message: rsp.ErrorMessage}
+	if rsp.ErrorDetail != nil {
+		detail, e := cn.unmarshalFrom(systemId, rsp.ErrorDetail)
+		if e != nil {
+			cn.localSystem.LogWarn("response error detail decode fail: %v", e)
+		}
+		err.Detail = detail
+	}
+	return err
+}
@@ -58,21 +58,21 @@ func TestPackAndSplit(t *testing.T) {
 	stream := append(pkt1, pkt2...)
 	// 模拟半包：先给 3 字节，再给剩余
 	sp.Append(stream[:3])
-	if _, _, ok := sp.Next(); ok {
+	if _, ok, _ := sp.Next(); ok {
 		t.Fatal("should not emit frame on partial header")
 	}
 	// 模拟粘包：剩余字节一次给齐（含两帧）
 	sp.Append(stream[3:])
 
-	id, payload, ok := sp.Next()
-	if !ok || id != 1 || string(payload) != "hello" {
-		t.Fatalf("frame1 mismatch: id=%v payload=%q ok=%v", id, payload, ok)
+	f, ok, err := sp.Next()
+	if err != nil || !ok || f.MsgId != 1 || string(f.Payload) != "hello" {
+		t.Fatalf("frame1 mismatch: id=%v payload=%q ok=%v err=%v", f.MsgId, f.Payload, ok, err)
 	}
-	id, payload, ok = sp.Next()
-	if !ok || id != 11 || string(payload) != "world!!" {
-		t.Fatalf("frame2 mismatch: id=%v payload=%q ok=%v", id, payload, ok)
+	f, ok, err = sp.Next()
+	if err != nil || !ok || f.MsgId != 11 || string(f.Payload) != "world!!" {
+		t.Fatalf("frame2 mismatch: id=%v payload=%q ok=%v err=%v", f.MsgId, f.Payload, ok, err)
 	}
-	if _, _, ok = sp.Next(); ok {
+	if _, ok, _ = sp.Next(); ok {
 		t.Fatal("no more frames expected")
 	}
 }
@@ -85,7 +85,7 @@ func TestRegisterMessageTypeDuplicate(t *testing.T) {
 	}).(*system)
 	s.RegisterMessageType(1, func() proto.Message { return &protocol.Message{} })
 	s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
-	if got := s.msgCreators[1](); got == nil {
+	if got := s.registry().creators[1](); got == nil {
 		t.Fatal("creator should exist")
 	} else if _, ok := got.(*protocol.ActorRef); !ok {
 		t.Fatalf("last registration should win, got %T", got)
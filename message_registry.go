@@ -0,0 +1,184 @@
+package dvactor
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"google.golang.org/protobuf/proto"
+)
+
+// msgRegistry 消息类型表的只读快照。注册/注销时在 registryLock 下复制修改后整体替换，
+// 收发路径（网络协程）无锁读取，运行期加载插件时注册不会与 UnmarshalMessage 竞争。
+type msgRegistry struct {
+	typeIds  map[reflect.Type]uint32
+	creators map[uint32]func() interface{}
+	// 按消息类型指定的编解码器，未指定的用 ClusterConfig.Codec
+	codecs map[uint32]Codec
+	// 各节点间可比较的类型名，用于一致性检查
+	names map[uint32]string
+	// 旧版本 msgType -> 升级到的新版本，见 RegisterMessageUpgrade
+	upgrades map[uint32]messageUpgrade
+}
+
+// messageUpgrade 把 from 版本的消息转换为 to 版本。
+type messageUpgrade struct {
+	to      uint32
+	convert func(msg interface{}) (interface{}, error)
+}
+
+func newMsgRegistry() *msgRegistry {
+	return &msgRegistry{
+		typeIds:  make(map[reflect.Type]uint32),
+		creators: make(map[uint32]func() interface{}),
+		codecs:   make(map[uint32]Codec),
+		names:    make(map[uint32]string),
+		upgrades: make(map[uint32]messageUpgrade),
+	}
+}
+
+func (r *msgRegistry) clone() *msgRegistry {
+	return &msgRegistry{
+		typeIds:  maps.Clone(r.typeIds),
+		creators: maps.Clone(r.creators),
+		codecs:   maps.Clone(r.codecs),
+		names:    maps.Clone(r.names),
+		upgrades: maps.Clone(r.upgrades),
+	}
+}
+
+// remove 删除 msgType 的全部映射；typeIds 只删仍指向它的那一项。
+func (r *msgRegistry) remove(msgType uint32) {
+	creator, ok := r.creators[msgType]
+	if !ok {
+		return
+	}
+	if t := reflect.TypeOf(creator()); r.typeIds[t] == msgType {
+		delete(r.typeIds, t)
+	}
+	delete(r.creators, msgType)
+	delete(r.codecs, msgType)
+	delete(r.names, msgType)
+	delete(r.upgrades, msgType)
+}
+
+// upgrade 沿升级链把 msgType 的消息转换到最新版本。
+func (r *msgRegistry) upgrade(msgType uint32, msg interface{}) (interface{}, error) {
+	for u, ok := r.upgrades[msgType]; ok; u, ok = r.upgrades[msgType] {
+		var err error
+		if msg, err = u.convert(msg); err != nil {
+			return nil, fmt.Errorf("upgrade msg type %v to %v: %w", msgType, u.to, err)
+		}
+		msgType = u.to
+	}
+	return msg, nil
+}
+
+func (s *system) registry() *msgRegistry {
+	return s.msgRegistry.Load()
+}
+
+func (s *system) RegisterMessageType(msgType uint32, creator func() proto.Message) {
+	s.RegisterMessageTypeCodec(msgType, func() interface{} { return creator() }, nil)
+}
+
+func (s *system) RegisterMessageTypeCodec(msgType uint32, creator func() interface{}, codec Codec) {
+	if s.autoProto != nil && msgType&AutoMessageTypeBit != 0 {
+		s.LogWarn("msgType %v overlaps auto msgType range", msgType)
+	}
+	msg := creator()
+	msgReflectType := reflect.TypeOf(msg)
+	s.registryLock.Lock()
+	defer s.registryLock.Unlock()
+	r := s.registry().clone()
+	if old, ok := r.creators[msgType]; ok && reflect.TypeOf(old()) != msgReflectType {
+		s.LogWarn("msgType %v re-registered: %v -> %v", msgType, reflect.TypeOf(old()), msgReflectType)
+		r.remove(msgType)
+	}
+	if oldType, ok := r.typeIds[msgReflectType]; ok && oldType != msgType {
+		s.LogWarn("message %v re-registered with msgType %v (was %v)", msgReflectType, msgType, oldType)
+	}
+	r.typeIds[msgReflectType] = msgType
+	r.creators[msgType] = creator
+	r.names[msgType] = messageTypeName(msg)
+	if codec != nil {
+		r.codecs[msgType] = codec
+	} else {
+		delete(r.codecs, msgType)
+	}
+	s.msgRegistry.Store(r)
+	s.onLocalMessageType(msgType, r.names[msgType])
+}
+
+func (s *system) UnregisterMessageType(msgType uint32) {
+	s.registryLock.Lock()
+	defer s.registryLock.Unlock()
+	r := s.registry()
+	if _, ok := r.creators[msgType]; !ok {
+		return
+	}
+	r = r.clone()
+	r.remove(msgType)
+	s.msgRegistry.Store(r)
+	s.onLocalMessageType(msgType, "")
+}
+
+// RegisterMessageUpgrade 注册 fromType 到 toType 的升级转换。两个版本各自用 RegisterMessageType 注册；
+// 从其他节点收到 fromType 的消息解码后先经 convert 转为 toType（可串联 v1→v2→v3）再投递，
+// 使 schema 变更可以先部署接收方、再切换发送方，而不必所有节点同时升级。本机发送不经序列化，不做转换。
+// 会形成环的注册记录错误后忽略，已有的升级链不变。
+func (s *system) RegisterMessageUpgrade(fromType, toType uint32, convert func(msg interface{}) (interface{}, error)) {
+	s.registryLock.Lock()
+	defer s.registryLock.Unlock()
+	r := s.registry().clone()
+	r.upgrades[fromType] = messageUpgrade{to: toType, convert: convert}
+	for msgType, steps := toType, 0; ; steps++ {
+		if msgType == fromType || steps > len(r.upgrades) {
+			s.LogError("msg type upgrade %v -> %v makes a cycle, ignored", fromType, toType)
+			return
+		}
+		u, ok := r.upgrades[msgType]
+		if !ok {
+			break
+		}
+		msgType = u.to
+	}
+	s.msgRegistry.Store(r)
+}
+
+// onLocalMessageType 本节点注册（name 非空）或注销 msgType 后，重新检查与各对端的一致性，
+// 并在开启 AnnounceMessageTypes 时通告已连接的对端。持有 registryLock 调用，通告顺序与注册顺序一致。
+func (s *system) onLocalMessageType(msgType uint32, name string) {
+	s.recheckMessageType(msgType)
+	if !s.clusterNet.clusterConfig.AnnounceMessageTypes {
+		return
+	}
+	pkg := &protocol.PkgMessageTypeAnnounce{
+		SystemId: uint32(s.clusterNet.clusterConfig.LocalSystemId),
+	}
+	if name != "" {
+		pkg.Registered = []*protocol.MessageTypeEntry{{MsgType: msgType, Name: name}}
+	} else {
+		pkg.Unregistered = []uint32{msgType}
+	}
+	for systemId := range s.clusterNet.systemInfos {
+		if systemId == s.clusterNet.clusterConfig.LocalSystemId || !s.clusterNet.hasCapability(systemId, CapabilityRegistryAnnounce) {
+			continue
+		}
+		if err := s.clusterNet.sendPkg(systemId, uint32(protocol.PkgType_PkgTypeMessageTypeAnnounce), pkg, 0); err != nil {
+			s.LogWarn("announce msgType %v to system %v: %v", msgType, systemId, err)
+		}
+	}
+}
+
+// codec 返回 msgType 在快照 r 中使用的编解码器。
+func (s *system) codec(r *msgRegistry, msgType uint32) Codec {
+	if codec, ok := r.codecs[msgType]; ok {
+		return codec
+	}
+	if codec := s.clusterNet.clusterConfig.Codec; codec != nil {
+		return codec
+	}
+	return ProtoCodec{}
+}
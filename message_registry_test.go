@@ -0,0 +1,197 @@
+package dvactor
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUnregisterMessageType(t *testing.T) {
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}},
+	}).(*system)
+	s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+	msg, err := s.MarshalMessage(&protocol.ActorRef{ActorId: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UnregisterMessageType(1)
+	if _, err := s.MarshalMessage(&protocol.ActorRef{}); err == nil || err.Code() != ErrorCodeMessageNotRegister {
+		t.Fatalf("expect not register, got %v", err)
+	}
+	if _, err := s.UnmarshalMessage(msg); err == nil {
+		t.Fatal("unregistered msgType should not decode")
+	}
+	// 注销后同一 msgType 可以换成别的类型，旧类型的反向映射不残留
+	s.RegisterMessageType(1, func() proto.Message { return &protocol.Message{} })
+	s.RegisterMessageType(2, func() proto.Message { return &protocol.ActorRef{} })
+	s.RegisterMessageType(2, func() proto.Message { return &protocol.PkgChunk{} })
+	if _, err := s.MarshalMessage(&protocol.ActorRef{}); err == nil {
+		t.Fatal("replaced message type should not marshal")
+	}
+	if msg, err := s.MarshalMessage(&protocol.PkgChunk{}); err != nil || msg.Type != 2 {
+		t.Fatalf("unexpected %v %v", msg, err)
+	}
+}
+
+// 运行期注册/注销与收发并发（配合 -race）
+func TestMessageRegistryConcurrent(t *testing.T) {
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}},
+	}).(*system)
+	s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+	msg, _ := s.MarshalMessage(&protocol.ActorRef{ActorId: "a"})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.MarshalMessage(&protocol.ActorRef{})
+				s.UnmarshalMessage(msg)
+			}
+		}()
+	}
+	for j := 0; j < 1000; j++ {
+		s.RegisterMessageType(2, func() proto.Message { return &protocol.Message{} })
+		s.UnregisterMessageType(2)
+	}
+	wg.Wait()
+	if out, err := s.UnmarshalMessage(msg); err != nil || out.(*protocol.ActorRef).ActorId != "a" {
+		t.Fatalf("unexpected %v %v", out, err)
+	}
+}
+
+// 运行期注册经通告传到对端，冲突在两边隔离，注销后解除
+func TestMessageTypeAnnounce(t *testing.T) {
+	systems := newInprocCluster(t, 2, []vactor.ActorType{ActorTypeStart + 1}, func(c *ClusterConfig) {
+		c.RegistryCheck = RegistryCheckQuarantine
+		c.AnnounceMessageTypes = true
+	}, nil)
+	waitConflicts := func(want int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for len(systems[0].MessageTypeConflicts()) != want || len(systems[1].MessageTypeConflicts()) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %v conflicts, got %+v / %+v", want, systems[0].MessageTypeConflicts(), systems[1].MessageTypeConflicts())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	systems[0].RegisterMessageType(5, func() proto.Message { return &protocol.Message{} })
+	systems[1].RegisterMessageType(6, func() proto.Message { return &protocol.Message{} })
+	time.Sleep(50 * time.Millisecond)
+	waitConflicts(0)
+	systems[1].RegisterMessageType(5, func() proto.Message { return &protocol.ActorRef{} })
+	waitConflicts(1)
+	if _, err := systems[0].(*system).clusterNet.marshalFor(2, &protocol.Message{}); err == nil || err.Code() != ErrorCodeMessageTypeConflict {
+		t.Fatalf("expect conflict, got %v", err)
+	}
+	systems[1].UnregisterMessageType(5)
+	waitConflicts(0)
+	if _, err := systems[0].(*system).clusterNet.marshalFor(2, &protocol.Message{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type loginV1 struct {
+	Name string
+}
+
+type loginV2 struct {
+	First string
+	Last  string
+}
+
+type loginV3 struct {
+	First, Last string
+	Source      string
+}
+
+func registerLoginVersions(s ClusterSystem, upgrade bool) {
+	s.RegisterMessageTypeCodec(7, func() interface{} { return &loginV1{} }, GobCodec{})
+	if !upgrade {
+		return
+	}
+	s.RegisterMessageTypeCodec(8, func() interface{} { return &loginV2{} }, GobCodec{})
+	s.RegisterMessageTypeCodec(9, func() interface{} { return &loginV3{} }, GobCodec{})
+	s.RegisterMessageUpgrade(7, 8, func(msg interface{}) (interface{}, error) {
+		first, last, _ := strings.Cut(msg.(*loginV1).Name, " ")
+		return &loginV2{First: first, Last: last}, nil
+	})
+	s.RegisterMessageUpgrade(8, 9, func(msg interface{}) (interface{}, error) {
+		v2 := msg.(*loginV2)
+		return &loginV3{First: v2.First, Last: v2.Last, Source: "upgrade"}, nil
+	})
+}
+
+func TestMessageUpgrade(t *testing.T) {
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}},
+	}).(*system)
+	registerLoginVersions(s, true)
+	msg, err := s.MarshalMessage(&loginV1{Name: "a b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, e := s.UnmarshalMessage(msg)
+	if v3, ok := out.(*loginV3); e != nil || !ok || *v3 != (loginV3{"a", "b", "upgrade"}) {
+		t.Fatalf("unexpected %#v %v", out, e)
+	}
+	// 最新版本不转换
+	msg, _ = s.MarshalMessage(&loginV3{First: "c"})
+	if out, e := s.UnmarshalMessage(msg); e != nil || out.(*loginV3).Source != "" {
+		t.Fatalf("unexpected %#v %v", out, e)
+	}
+
+	s.RegisterMessageUpgrade(9, 10, func(interface{}) (interface{}, error) { return nil, errors.New("bad") })
+	if _, e := s.UnmarshalMessage(msg); e == nil {
+		t.Fatal("converter error should fail decode")
+	}
+	// 成环的注册被拒绝，原有升级链不受影响
+	s.RegisterMessageUpgrade(10, 7, func(msg interface{}) (interface{}, error) { return msg, nil })
+	if _, ok := s.registry().upgrades[10]; ok {
+		t.Fatal("cyclic upgrade should be rejected")
+	}
+	if u := s.registry().upgrades[9]; u.to != 10 {
+		t.Fatalf("existing upgrade should be kept, got %v", u.to)
+	}
+}
+
+// 只认识 v1 的节点发出的消息在新节点上升级后投递
+func TestMessageUpgradeDelivery(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	received := make(chan interface{}, 1)
+	index := 0
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, nil, func(s ClusterSystem) {
+		index++
+		registerLoginVersions(s, index == 2)
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				switch ctx.GetMessage().(type) {
+				case *loginV1, *loginV3:
+					received <- ctx.GetMessage()
+				}
+			}
+		})
+	})
+	if err := systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "a"), &loginV1{Name: "x y"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-received:
+		if v3, ok := msg.(*loginV3); !ok || v3.First != "x" || v3.Last != "y" {
+			t.Fatalf("unexpected %#v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+}
@@ -0,0 +1,107 @@
+package dvactor
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// AutoMessageTypeBit 自动派生的 msgType 最高位为 1；手工注册的 msgType 须小于它，两者不会冲突。
+const AutoMessageTypeBit uint32 = 1 << 31
+
+// ProtoMessageType 由 proto 全名派生 msgType（FNV-1a 32 位并置 AutoMessageTypeBit），各节点算法一致，无需协商。
+func ProtoMessageType(name protoreflect.FullName) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32() | AutoMessageTypeBit
+}
+
+// protoAutoRegistry ClusterConfig.AutoRegisterProto 开启时按全名派生 msgType，
+// 接收侧通过 protoregistry.GlobalTypes 反查消息类型。哈希冲突的全名都不自动注册，须手工 RegisterMessageType。
+type protoAutoRegistry struct {
+	// msgType -> protoreflect.MessageType，读路径无锁
+	types sync.Map
+	lock  sync.Mutex
+	// 上次扫描时 GlobalTypes 中的消息数，变化时才重新扫描
+	scanned   int
+	conflicts map[uint32][]protoreflect.FullName
+	s         *system
+}
+
+func newProtoAutoRegistry(s *system) *protoAutoRegistry {
+	return &protoAutoRegistry{
+		s:         s,
+		conflicts: make(map[uint32][]protoreflect.FullName),
+	}
+}
+
+// typeOf 返回 mt 派生的 msgType；与其他全名哈希冲突时 ok 为 false。
+func (r *protoAutoRegistry) typeOf(mt protoreflect.MessageType) (uint32, bool) {
+	name := mt.Descriptor().FullName()
+	msgType := ProtoMessageType(name)
+	if v, ok := r.types.Load(msgType); ok {
+		return msgType, v.(protoreflect.MessageType).Descriptor().FullName() == name
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.scanLocked()
+	if !r.storeLocked(msgType, mt) {
+		return msgType, false
+	}
+	v, _ := r.types.Load(msgType)
+	return msgType, v.(protoreflect.MessageType).Descriptor().FullName() == name
+}
+
+// lookup 按 msgType 查找消息类型，未命中时重新扫描 GlobalTypes（运行期可能有新的 proto 包注册）。
+func (r *protoAutoRegistry) lookup(msgType uint32) (protoreflect.MessageType, bool) {
+	if v, ok := r.types.Load(msgType); ok {
+		return v.(protoreflect.MessageType), true
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.scanLocked()
+	if v, ok := r.types.Load(msgType); ok {
+		return v.(protoreflect.MessageType), true
+	}
+	return nil, false
+}
+
+func (r *protoAutoRegistry) scanLocked() {
+	n := protoregistry.GlobalTypes.NumMessages()
+	if n == r.scanned {
+		return
+	}
+	r.scanned = n
+	protoregistry.GlobalTypes.RangeMessages(func(mt protoreflect.MessageType) bool {
+		r.storeLocked(ProtoMessageType(mt.Descriptor().FullName()), mt)
+		return true
+	})
+}
+
+// storeLocked 记录 msgType -> mt；发现哈希冲突时两者都撤销并告警，返回 false。
+func (r *protoAutoRegistry) storeLocked(msgType uint32, mt protoreflect.MessageType) bool {
+	name := mt.Descriptor().FullName()
+	if names, ok := r.conflicts[msgType]; ok {
+		for _, n := range names {
+			if n == name {
+				return false
+			}
+		}
+		r.conflicts[msgType] = append(names, name)
+		return false
+	}
+	v, loaded := r.types.LoadOrStore(msgType, mt)
+	if !loaded {
+		return true
+	}
+	old := v.(protoreflect.MessageType).Descriptor().FullName()
+	if old == name {
+		return true
+	}
+	r.types.Delete(msgType)
+	r.conflicts[msgType] = []protoreflect.FullName{old, name}
+	r.s.LogWarn("auto msgType %v conflicts: %v and %v, register them manually", msgType, old, name)
+	return false
+}
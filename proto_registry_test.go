@@ -0,0 +1,70 @@
+package dvactor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+)
+
+func TestProtoAutoRegistry(t *testing.T) {
+	refType := (&protocol.ActorRef{}).ProtoReflect().Type()
+	msgType := ProtoMessageType(refType.Descriptor().FullName())
+	if msgType&AutoMessageTypeBit == 0 || msgType != ProtoMessageType("protocol.ActorRef") {
+		t.Fatalf("unexpected msgType %v", msgType)
+	}
+	r := newProtoAutoRegistry(NewSystem(&ClusterConfig{
+		LocalSystemId: 1,
+		SystemConfigs: []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}},
+	}).(*system))
+	if got, ok := r.typeOf(refType); !ok || got != msgType {
+		t.Fatalf("typeOf: %v %v", got, ok)
+	}
+	if mt, ok := r.lookup(ProtoMessageType((&protocol.PkgChunk{}).ProtoReflect().Descriptor().FullName())); !ok || mt.Descriptor().FullName() != (&protocol.PkgChunk{}).ProtoReflect().Descriptor().FullName() {
+		t.Fatal("lookup should resolve through GlobalTypes")
+	}
+	if _, ok := r.lookup(AutoMessageTypeBit); ok {
+		t.Fatal("unknown msgType should miss")
+	}
+
+	// 哈希冲突的两个全名都不可用
+	r.lock.Lock()
+	r.storeLocked(AutoMessageTypeBit|1, refType)
+	ok := r.storeLocked(AutoMessageTypeBit|1, (&protocol.Message{}).ProtoReflect().Type())
+	r.lock.Unlock()
+	if ok {
+		t.Fatal("conflict should be rejected")
+	}
+	if _, ok := r.lookup(AutoMessageTypeBit | 1); ok {
+		t.Fatal("conflicting msgType should be removed")
+	}
+}
+
+// 未注册的 proto 消息按全名跨节点送达
+func TestAutoRegisterProtoDelivery(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	received := make(chan string, 1)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+		c.AutoRegisterProto = true
+	}, func(s ClusterSystem) {
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				if msg, ok := ctx.GetMessage().(*protocol.ActorRef); ok {
+					received <- msg.ActorId
+				}
+			}
+		})
+	})
+	if err := systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "a"), &protocol.ActorRef{ActorId: "auto"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-received:
+		if id != "auto" {
+			t.Fatalf("got %v", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+}
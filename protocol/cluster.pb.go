@@ -86,6 +86,16 @@ const (
 	PkgType_PkgTypeEnvelopeFireNotify    PkgType = 9
 	PkgType_PkgTypeRegisterSystemReq     PkgType = 10
 	PkgType_PkgTypeRegisterSystemRsp     PkgType = 11
+	PkgType_PkgTypeRegisterChallenge     PkgType = 12
+	PkgType_PkgTypeRegisterAuth          PkgType = 13
+	PkgType_PkgTypeChunk                 PkgType = 14
+	PkgType_PkgTypeStreamOpen            PkgType = 15
+	PkgType_PkgTypeStreamData            PkgType = 16
+	PkgType_PkgTypeStreamCredit          PkgType = 17
+	PkgType_PkgTypeStreamClose           PkgType = 18
+	PkgType_PkgTypeEnvelopeBatch         PkgType = 19
+	PkgType_PkgTypeMessageTypeAnnounce   PkgType = 20
+	PkgType_PkgTypeCancelRequest         PkgType = 21
 )
 
 // Enum value maps for PkgType.
@@ -103,6 +113,16 @@ var (
 		9:  "PkgTypeEnvelopeFireNotify",
 		10: "PkgTypeRegisterSystemReq",
 		11: "PkgTypeRegisterSystemRsp",
+		12: "PkgTypeRegisterChallenge",
+		13: "PkgTypeRegisterAuth",
+		14: "PkgTypeChunk",
+		15: "PkgTypeStreamOpen",
+		16: "PkgTypeStreamData",
+		17: "PkgTypeStreamCredit",
+		18: "PkgTypeStreamClose",
+		19: "PkgTypeEnvelopeBatch",
+		20: "PkgTypeMessageTypeAnnounce",
+		21: "PkgTypeCancelRequest",
 	}
 	PkgType_value = map[string]int32{
 		"PkgTypeNone":                  0,
@@ -117,6 +137,16 @@ var (
 		"PkgTypeEnvelopeFireNotify":    9,
 		"PkgTypeRegisterSystemReq":     10,
 		"PkgTypeRegisterSystemRsp":     11,
+		"PkgTypeRegisterChallenge":     12,
+		"PkgTypeRegisterAuth":          13,
+		"PkgTypeChunk":                 14,
+		"PkgTypeStreamOpen":            15,
+		"PkgTypeStreamData":            16,
+		"PkgTypeStreamCredit":          17,
+		"PkgTypeStreamClose":           18,
+		"PkgTypeEnvelopeBatch":         19,
+		"PkgTypeMessageTypeAnnounce":   20,
+		"PkgTypeCancelRequest":         21,
 	}
 )
 
@@ -464,9 +494,14 @@ func (x *PkgEnvelopeRequestAsync) GetCallbackAddress() uint64 {
 }
 
 type Response struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ErrorCode     ErrorCode              `protobuf:"varint,1,opt,name=ErrorCode,proto3,enum=protocol.ErrorCode" json:"ErrorCode,omitempty"`
-	Message       *Message               `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ErrorCode ErrorCode              `protobuf:"varint,1,opt,name=ErrorCode,proto3,enum=protocol.ErrorCode" json:"ErrorCode,omitempty"`
+	Message   *Message               `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	// 完整的 vactor.ErrorCode，非 0 时优先于 ErrorCode
+	Code         uint32 `protobuf:"varint,3,opt,name=Code,proto3" json:"Code,omitempty"`
+	ErrorMessage string `protobuf:"bytes,4,opt,name=ErrorMessage,proto3" json:"ErrorMessage,omitempty"`
+	// 可选的错误详情，按已注册的 msgType 编码
+	ErrorDetail   *Message `protobuf:"bytes,5,opt,name=ErrorDetail,proto3" json:"ErrorDetail,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -515,6 +550,27 @@ func (x *Response) GetMessage() *Message {
 	return nil
 }
 
+func (x *Response) GetCode() uint32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Response) GetErrorMessage() string {
+	if x != nil {
+		return x.ErrorMessage
+	}
+	return ""
+}
+
+func (x *Response) GetErrorDetail() *Message {
+	if x != nil {
+		return x.ErrorDetail
+	}
+	return nil
+}
+
 type PkgEnvelopeResponseAsync struct {
 	state           protoimpl.MessageState `protogen:"open.v1"`
 	FromActorRef    *ActorRef              `protobuf:"bytes,1,opt,name=FromActorRef,proto3" json:"FromActorRef,omitempty"`
@@ -956,8 +1012,19 @@ func (x *PkgEnvelopeFireNotify) GetMessage() *Message {
 }
 
 type PkgRegisterSystemReq struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	SystemId      uint32                 `protobuf:"varint,1,opt,name=SystemId,proto3" json:"SystemId,omitempty"`
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	SystemId uint32                 `protobuf:"varint,1,opt,name=SystemId,proto3" json:"SystemId,omitempty"`
+	// 开启认证时 client 生成的随机数
+	ClientNonce []byte `protobuf:"bytes,2,opt,name=ClientNonce,proto3" json:"ClientNonce,omitempty"`
+	// 协议版本与能力位（旧节点不带，按 0 处理）
+	ProtocolVersion    uint32 `protobuf:"varint,3,opt,name=ProtocolVersion,proto3" json:"ProtocolVersion,omitempty"`
+	MinProtocolVersion uint32 `protobuf:"varint,4,opt,name=MinProtocolVersion,proto3" json:"MinProtocolVersion,omitempty"`
+	Capabilities       uint64 `protobuf:"varint,5,opt,name=Capabilities,proto3" json:"Capabilities,omitempty"`
+	// 多连接（CapabilityMultiConn）：本连接的序号与 client 打开的连接总数，主连接为 0
+	Stripe  uint32 `protobuf:"varint,6,opt,name=Stripe,proto3" json:"Stripe,omitempty"`
+	Stripes uint32 `protobuf:"varint,7,opt,name=Stripes,proto3" json:"Stripes,omitempty"`
+	// 本节点手工注册的消息类型（msgType → 类型名），主连接才带，用于一致性检查
+	MessageTypes  []*MessageTypeEntry `protobuf:"bytes,8,rep,name=MessageTypes,proto3" json:"MessageTypes,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -999,11 +1066,66 @@ func (x *PkgRegisterSystemReq) GetSystemId() uint32 {
 	return 0
 }
 
+func (x *PkgRegisterSystemReq) GetClientNonce() []byte {
+	if x != nil {
+		return x.ClientNonce
+	}
+	return nil
+}
+
+func (x *PkgRegisterSystemReq) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *PkgRegisterSystemReq) GetMinProtocolVersion() uint32 {
+	if x != nil {
+		return x.MinProtocolVersion
+	}
+	return 0
+}
+
+func (x *PkgRegisterSystemReq) GetCapabilities() uint64 {
+	if x != nil {
+		return x.Capabilities
+	}
+	return 0
+}
+
+func (x *PkgRegisterSystemReq) GetStripe() uint32 {
+	if x != nil {
+		return x.Stripe
+	}
+	return 0
+}
+
+func (x *PkgRegisterSystemReq) GetStripes() uint32 {
+	if x != nil {
+		return x.Stripes
+	}
+	return 0
+}
+
+func (x *PkgRegisterSystemReq) GetMessageTypes() []*MessageTypeEntry {
+	if x != nil {
+		return x.MessageTypes
+	}
+	return nil
+}
+
 type PkgRegisterSystemRsp struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ErrorCode     ErrorCode              `protobuf:"varint,1,opt,name=ErrorCode,proto3,enum=protocol.ErrorCode" json:"ErrorCode,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ErrorCode ErrorCode              `protobuf:"varint,1,opt,name=ErrorCode,proto3,enum=protocol.ErrorCode" json:"ErrorCode,omitempty"`
+	// 开启认证时 server 对 client 的应答证明
+	Mac                []byte              `protobuf:"bytes,2,opt,name=Mac,proto3" json:"Mac,omitempty"`
+	ProtocolVersion    uint32              `protobuf:"varint,3,opt,name=ProtocolVersion,proto3" json:"ProtocolVersion,omitempty"`
+	MinProtocolVersion uint32              `protobuf:"varint,4,opt,name=MinProtocolVersion,proto3" json:"MinProtocolVersion,omitempty"`
+	Capabilities       uint64              `protobuf:"varint,5,opt,name=Capabilities,proto3" json:"Capabilities,omitempty"`
+	MessageTypes       []*MessageTypeEntry `protobuf:"bytes,6,rep,name=MessageTypes,proto3" json:"MessageTypes,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
 }
 
 func (x *PkgRegisterSystemRsp) Reset() {
@@ -1043,100 +1165,924 @@ func (x *PkgRegisterSystemRsp) GetErrorCode() ErrorCode {
 	return ErrorCode_ErrorCodeSuccess
 }
 
-var File_protocol_cluster_proto protoreflect.FileDescriptor
+func (x *PkgRegisterSystemRsp) GetMac() []byte {
+	if x != nil {
+		return x.Mac
+	}
+	return nil
+}
 
-const file_protocol_cluster_proto_rawDesc = "" +
-	"\n" +
-	"\x16protocol/cluster.proto\x12\bprotocol\"1\n" +
-	"\aMessage\x12\x12\n" +
-	"\x04Type\x18\x01 \x01(\rR\x04Type\x12\x12\n" +
-	"\x04Data\x18\x02 \x01(\fR\x04Data\"|\n" +
-	"\bActorRef\x12\x1a\n" +
-	"\bSystemId\x18\x01 \x01(\rR\bSystemId\x12\x1c\n" +
-	"\tGroupSlot\x18\x02 \x01(\rR\tGroupSlot\x12\x1c\n" +
-	"\tActorType\x18\x03 \x01(\rR\tActorType\x12\x18\n" +
-	"\aActorId\x18\x04 \x01(\tR\aActorId\"\xaa\x01\n" +
-	"\x0fPkgEnvelopeSend\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
-	"\n" +
-	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
-	"ToActorRef\x12+\n" +
-	"\aMessage\x18\x03 \x01(\v2\x11.protocol.MessageR\aMessage\"\xb3\x01\n" +
-	"\x14PkgEnvelopeBatchSend\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x124\n" +
-	"\vToActorRefs\x18\x02 \x03(\v2\x12.protocol.ActorRefR\vToActorRefs\x12-\n" +
-	"\bMessages\x18\x03 \x03(\v2\x11.protocol.MessageR\bMessages\"\xfc\x01\n" +
-	"\x17PkgEnvelopeRequestAsync\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
-	"\n" +
-	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
-	"ToActorRef\x12+\n" +
-	"\aMessage\x18\x03 \x01(\v2\x11.protocol.MessageR\aMessage\x12\x1e\n" +
-	"\n" +
-	"CallbackId\x18\x04 \x01(\rR\n" +
-	"CallbackId\x12(\n" +
-	"\x0fCallbackAddress\x18\x05 \x01(\x04R\x0fCallbackAddress\"j\n" +
-	"\bResponse\x121\n" +
-	"\tErrorCode\x18\x01 \x01(\x0e2\x13.protocol.ErrorCodeR\tErrorCode\x12+\n" +
-	"\aMessage\x18\x02 \x01(\v2\x11.protocol.MessageR\aMessage\"\x80\x02\n" +
-	"\x18PkgEnvelopeResponseAsync\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
-	"\n" +
-	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
-	"ToActorRef\x12.\n" +
-	"\bResponse\x18\x03 \x01(\v2\x12.protocol.ResponseR\bResponse\x12\x1e\n" +
-	"\n" +
-	"CallbackId\x18\x04 \x01(\rR\n" +
-	"CallbackId\x12(\n" +
-	"\x0fCallbackAddress\x18\x05 \x01(\x04R\x0fCallbackAddress\"\xcb\x01\n" +
-	"\x12PkgEnvelopeRequest\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
-	"\n" +
-	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
-	"ToActorRef\x12+\n" +
-	"\aMessage\x18\x03 \x01(\v2\x11.protocol.MessageR\aMessage\x12\x1c\n" +
-	"\tRequestId\x18\x04 \x01(\rR\tRequestId\"\xcf\x01\n" +
-	"\x13PkgEnvelopeResponse\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
-	"\n" +
-	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
-	"ToActorRef\x12.\n" +
-	"\bResponse\x18\x03 \x01(\v2\x12.protocol.ResponseR\bResponse\x12\x1c\n" +
-	"\tRequestId\x18\x04 \x01(\rR\tRequestId\"\xb6\x01\n" +
-	"\x10PkgEnvelopeWatch\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
-	"\n" +
-	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
-	"ToActorRef\x12\x1c\n" +
-	"\tWatchType\x18\x03 \x01(\rR\tWatchType\x12\x18\n" +
-	"\aIsWatch\x18\x04 \x01(\bR\aIsWatch\"\x9c\x02\n" +
-	"\x11PkgEnvelopeNotify\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x124\n" +
-	"\vToActorRefs\x18\x02 \x03(\v2\x12.protocol.ActorRefR\vToActorRefs\x12\x1e\n" +
-	"\n" +
-	"NotifyType\x18\x03 \x01(\rR\n" +
-	"NotifyType\x12.\n" +
-	"\bActorRef\x18\x04 \x01(\v2\x12.protocol.ActorRefR\bActorRef\x12\x1c\n" +
-	"\tWatchType\x18\x05 \x01(\rR\tWatchType\x12+\n" +
-	"\aMessage\x18\x06 \x01(\v2\x11.protocol.MessageR\aMessage\"\xee\x01\n" +
-	"\x15PkgEnvelopeFireNotify\x126\n" +
-	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
-	"\n" +
-	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
-	"ToActorRef\x12\x1e\n" +
-	"\n" +
-	"NotifyType\x18\x03 \x01(\rR\n" +
-	"NotifyType\x12\x1c\n" +
-	"\tWatchType\x18\x04 \x01(\rR\tWatchType\x12+\n" +
-	"\aMessage\x18\x05 \x01(\v2\x11.protocol.MessageR\aMessage\"2\n" +
-	"\x14PkgRegisterSystemReq\x12\x1a\n" +
-	"\bSystemId\x18\x01 \x01(\rR\bSystemId\"I\n" +
-	"\x14PkgRegisterSystemRsp\x121\n" +
-	"\tErrorCode\x18\x01 \x01(\x0e2\x13.protocol.ErrorCodeR\tErrorCode*R\n" +
+func (x *PkgRegisterSystemRsp) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *PkgRegisterSystemRsp) GetMinProtocolVersion() uint32 {
+	if x != nil {
+		return x.MinProtocolVersion
+	}
+	return 0
+}
+
+func (x *PkgRegisterSystemRsp) GetCapabilities() uint64 {
+	if x != nil {
+		return x.Capabilities
+	}
+	return 0
+}
+
+func (x *PkgRegisterSystemRsp) GetMessageTypes() []*MessageTypeEntry {
+	if x != nil {
+		return x.MessageTypes
+	}
+	return nil
+}
+
+// 运行期注册/注销消息类型后向已连接的对端通告（CapabilityRegistryAnnounce），供对端做一致性检查
+type PkgMessageTypeAnnounce struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SystemId      uint32                 `protobuf:"varint,1,opt,name=SystemId,proto3" json:"SystemId,omitempty"`
+	Registered    []*MessageTypeEntry    `protobuf:"bytes,2,rep,name=Registered,proto3" json:"Registered,omitempty"`
+	Unregistered  []uint32               `protobuf:"varint,3,rep,packed,name=Unregistered,proto3" json:"Unregistered,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgMessageTypeAnnounce) Reset() {
+	*x = PkgMessageTypeAnnounce{}
+	mi := &file_protocol_cluster_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgMessageTypeAnnounce) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgMessageTypeAnnounce) ProtoMessage() {}
+
+func (x *PkgMessageTypeAnnounce) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgMessageTypeAnnounce.ProtoReflect.Descriptor instead.
+func (*PkgMessageTypeAnnounce) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *PkgMessageTypeAnnounce) GetSystemId() uint32 {
+	if x != nil {
+		return x.SystemId
+	}
+	return 0
+}
+
+func (x *PkgMessageTypeAnnounce) GetRegistered() []*MessageTypeEntry {
+	if x != nil {
+		return x.Registered
+	}
+	return nil
+}
+
+func (x *PkgMessageTypeAnnounce) GetUnregistered() []uint32 {
+	if x != nil {
+		return x.Unregistered
+	}
+	return nil
+}
+
+type MessageTypeEntry struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	MsgType uint32                 `protobuf:"varint,1,opt,name=MsgType,proto3" json:"MsgType,omitempty"`
+	// proto 消息为 FullName，其余为 Go 的包路径.类型名
+	Name          string `protobuf:"bytes,2,opt,name=Name,proto3" json:"Name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageTypeEntry) Reset() {
+	*x = MessageTypeEntry{}
+	mi := &file_protocol_cluster_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageTypeEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageTypeEntry) ProtoMessage() {}
+
+func (x *MessageTypeEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageTypeEntry.ProtoReflect.Descriptor instead.
+func (*MessageTypeEntry) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *MessageTypeEntry) GetMsgType() uint32 {
+	if x != nil {
+		return x.MsgType
+	}
+	return 0
+}
+
+func (x *MessageTypeEntry) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// 开启认证时 server 收到 RegisterSystemReq 后下发的挑战
+type PkgRegisterChallenge struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServerNonce   []byte                 `protobuf:"bytes,1,opt,name=ServerNonce,proto3" json:"ServerNonce,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgRegisterChallenge) Reset() {
+	*x = PkgRegisterChallenge{}
+	mi := &file_protocol_cluster_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgRegisterChallenge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgRegisterChallenge) ProtoMessage() {}
+
+func (x *PkgRegisterChallenge) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgRegisterChallenge.ProtoReflect.Descriptor instead.
+func (*PkgRegisterChallenge) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *PkgRegisterChallenge) GetServerNonce() []byte {
+	if x != nil {
+		return x.ServerNonce
+	}
+	return nil
+}
+
+// client 对挑战的应答
+type PkgRegisterAuth struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mac           []byte                 `protobuf:"bytes,1,opt,name=Mac,proto3" json:"Mac,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgRegisterAuth) Reset() {
+	*x = PkgRegisterAuth{}
+	mi := &file_protocol_cluster_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgRegisterAuth) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgRegisterAuth) ProtoMessage() {}
+
+func (x *PkgRegisterAuth) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgRegisterAuth.ProtoReflect.Descriptor instead.
+func (*PkgRegisterAuth) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PkgRegisterAuth) GetMac() []byte {
+	if x != nil {
+		return x.Mac
+	}
+	return nil
+}
+
+// 大包分片（CapabilityChunking）：序列化后超过 ChunkConfig.Size 的包按顺序拆成 Count 片，
+// 接收侧在同一连接上按 MessageId 重组后再按 PkgType 处理
+type PkgChunk struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	MessageId uint64                 `protobuf:"varint,1,opt,name=MessageId,proto3" json:"MessageId,omitempty"`
+	Index     uint32                 `protobuf:"varint,2,opt,name=Index,proto3" json:"Index,omitempty"`
+	Count     uint32                 `protobuf:"varint,3,opt,name=Count,proto3" json:"Count,omitempty"`
+	// 原包的 PkgType 与总长度
+	PkgType       uint32 `protobuf:"varint,4,opt,name=PkgType,proto3" json:"PkgType,omitempty"`
+	Size          uint64 `protobuf:"varint,5,opt,name=Size,proto3" json:"Size,omitempty"`
+	Data          []byte `protobuf:"bytes,6,opt,name=Data,proto3" json:"Data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgChunk) Reset() {
+	*x = PkgChunk{}
+	mi := &file_protocol_cluster_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgChunk) ProtoMessage() {}
+
+func (x *PkgChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgChunk.ProtoReflect.Descriptor instead.
+func (*PkgChunk) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *PkgChunk) GetMessageId() uint64 {
+	if x != nil {
+		return x.MessageId
+	}
+	return 0
+}
+
+func (x *PkgChunk) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *PkgChunk) GetCount() uint32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *PkgChunk) GetPkgType() uint32 {
+	if x != nil {
+		return x.PkgType
+	}
+	return 0
+}
+
+func (x *PkgChunk) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *PkgChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// actor 间的流（CapabilityStream）：StreamId 高位为打开方 SystemId
+type PkgStreamOpen struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	StreamId     uint64                 `protobuf:"varint,1,opt,name=StreamId,proto3" json:"StreamId,omitempty"`
+	FromActorRef *ActorRef              `protobuf:"bytes,2,opt,name=FromActorRef,proto3" json:"FromActorRef,omitempty"`
+	ToActorRef   *ActorRef              `protobuf:"bytes,3,opt,name=ToActorRef,proto3" json:"ToActorRef,omitempty"`
+	// 写端的初始信用（条数）
+	Window        uint32 `protobuf:"varint,4,opt,name=Window,proto3" json:"Window,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgStreamOpen) Reset() {
+	*x = PkgStreamOpen{}
+	mi := &file_protocol_cluster_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgStreamOpen) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgStreamOpen) ProtoMessage() {}
+
+func (x *PkgStreamOpen) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgStreamOpen.ProtoReflect.Descriptor instead.
+func (*PkgStreamOpen) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *PkgStreamOpen) GetStreamId() uint64 {
+	if x != nil {
+		return x.StreamId
+	}
+	return 0
+}
+
+func (x *PkgStreamOpen) GetFromActorRef() *ActorRef {
+	if x != nil {
+		return x.FromActorRef
+	}
+	return nil
+}
+
+func (x *PkgStreamOpen) GetToActorRef() *ActorRef {
+	if x != nil {
+		return x.ToActorRef
+	}
+	return nil
+}
+
+func (x *PkgStreamOpen) GetWindow() uint32 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
+type PkgStreamData struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	StreamId uint64                 `protobuf:"varint,1,opt,name=StreamId,proto3" json:"StreamId,omitempty"`
+	// 从 1 开始连续递增
+	Seq           uint64   `protobuf:"varint,2,opt,name=Seq,proto3" json:"Seq,omitempty"`
+	Message       *Message `protobuf:"bytes,3,opt,name=Message,proto3" json:"Message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgStreamData) Reset() {
+	*x = PkgStreamData{}
+	mi := &file_protocol_cluster_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgStreamData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgStreamData) ProtoMessage() {}
+
+func (x *PkgStreamData) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgStreamData.ProtoReflect.Descriptor instead.
+func (*PkgStreamData) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *PkgStreamData) GetStreamId() uint64 {
+	if x != nil {
+		return x.StreamId
+	}
+	return 0
+}
+
+func (x *PkgStreamData) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *PkgStreamData) GetMessage() *Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+// 读端追加授予的信用
+type PkgStreamCredit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StreamId      uint64                 `protobuf:"varint,1,opt,name=StreamId,proto3" json:"StreamId,omitempty"`
+	Credit        uint32                 `protobuf:"varint,2,opt,name=Credit,proto3" json:"Credit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgStreamCredit) Reset() {
+	*x = PkgStreamCredit{}
+	mi := &file_protocol_cluster_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgStreamCredit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgStreamCredit) ProtoMessage() {}
+
+func (x *PkgStreamCredit) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgStreamCredit.ProtoReflect.Descriptor instead.
+func (*PkgStreamCredit) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *PkgStreamCredit) GetStreamId() uint64 {
+	if x != nil {
+		return x.StreamId
+	}
+	return 0
+}
+
+func (x *PkgStreamCredit) GetCredit() uint32 {
+	if x != nil {
+		return x.Credit
+	}
+	return 0
+}
+
+type PkgStreamClose struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	StreamId uint64                 `protobuf:"varint,1,opt,name=StreamId,proto3" json:"StreamId,omitempty"`
+	// true 表示读端取消，false 表示写端结束
+	FromReader    bool      `protobuf:"varint,2,opt,name=FromReader,proto3" json:"FromReader,omitempty"`
+	ErrorCode     ErrorCode `protobuf:"varint,3,opt,name=ErrorCode,proto3,enum=protocol.ErrorCode" json:"ErrorCode,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgStreamClose) Reset() {
+	*x = PkgStreamClose{}
+	mi := &file_protocol_cluster_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgStreamClose) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgStreamClose) ProtoMessage() {}
+
+func (x *PkgStreamClose) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgStreamClose.ProtoReflect.Descriptor instead.
+func (*PkgStreamClose) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *PkgStreamClose) GetStreamId() uint64 {
+	if x != nil {
+		return x.StreamId
+	}
+	return 0
+}
+
+func (x *PkgStreamClose) GetFromReader() bool {
+	if x != nil {
+		return x.FromReader
+	}
+	return false
+}
+
+func (x *PkgStreamClose) GetErrorCode() ErrorCode {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return ErrorCode_ErrorCodeSuccess
+}
+
+// 多个包合并成一帧（CapabilityEnvelopeBatch），接收侧按顺序逐个处理
+type PkgEnvelopeBatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         []*BatchItem           `protobuf:"bytes,1,rep,name=Items,proto3" json:"Items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PkgEnvelopeBatch) Reset() {
+	*x = PkgEnvelopeBatch{}
+	mi := &file_protocol_cluster_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgEnvelopeBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgEnvelopeBatch) ProtoMessage() {}
+
+func (x *PkgEnvelopeBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgEnvelopeBatch.ProtoReflect.Descriptor instead.
+func (*PkgEnvelopeBatch) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *PkgEnvelopeBatch) GetItems() []*BatchItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type BatchItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PkgType       uint32                 `protobuf:"varint,1,opt,name=PkgType,proto3" json:"PkgType,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchItem) Reset() {
+	*x = BatchItem{}
+	mi := &file_protocol_cluster_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchItem) ProtoMessage() {}
+
+func (x *BatchItem) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchItem.ProtoReflect.Descriptor instead.
+func (*BatchItem) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *BatchItem) GetPkgType() uint32 {
+	if x != nil {
+		return x.PkgType
+	}
+	return 0
+}
+
+func (x *BatchItem) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// 调用方不再等待的请求。FromActorRef 为发起请求的 actor；Async 时按 CallbackId/CallbackAddress，否则按 RequestId
+type PkgCancelRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	FromActorRef    *ActorRef              `protobuf:"bytes,1,opt,name=FromActorRef,proto3" json:"FromActorRef,omitempty"`
+	ToActorRef      *ActorRef              `protobuf:"bytes,2,opt,name=ToActorRef,proto3" json:"ToActorRef,omitempty"`
+	Async           bool                   `protobuf:"varint,3,opt,name=Async,proto3" json:"Async,omitempty"`
+	RequestId       uint32                 `protobuf:"varint,4,opt,name=RequestId,proto3" json:"RequestId,omitempty"`
+	CallbackId      uint32                 `protobuf:"varint,5,opt,name=CallbackId,proto3" json:"CallbackId,omitempty"`
+	CallbackAddress uint64                 `protobuf:"varint,6,opt,name=CallbackAddress,proto3" json:"CallbackAddress,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *PkgCancelRequest) Reset() {
+	*x = PkgCancelRequest{}
+	mi := &file_protocol_cluster_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PkgCancelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PkgCancelRequest) ProtoMessage() {}
+
+func (x *PkgCancelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_protocol_cluster_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PkgCancelRequest.ProtoReflect.Descriptor instead.
+func (*PkgCancelRequest) Descriptor() ([]byte, []int) {
+	return file_protocol_cluster_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *PkgCancelRequest) GetFromActorRef() *ActorRef {
+	if x != nil {
+		return x.FromActorRef
+	}
+	return nil
+}
+
+func (x *PkgCancelRequest) GetToActorRef() *ActorRef {
+	if x != nil {
+		return x.ToActorRef
+	}
+	return nil
+}
+
+func (x *PkgCancelRequest) GetAsync() bool {
+	if x != nil {
+		return x.Async
+	}
+	return false
+}
+
+func (x *PkgCancelRequest) GetRequestId() uint32 {
+	if x != nil {
+		return x.RequestId
+	}
+	return 0
+}
+
+func (x *PkgCancelRequest) GetCallbackId() uint32 {
+	if x != nil {
+		return x.CallbackId
+	}
+	return 0
+}
+
+func (x *PkgCancelRequest) GetCallbackAddress() uint64 {
+	if x != nil {
+		return x.CallbackAddress
+	}
+	return 0
+}
+
+var File_protocol_cluster_proto protoreflect.FileDescriptor
+
+const file_protocol_cluster_proto_rawDesc = "" +
+	"\n" +
+	"\x16protocol/cluster.proto\x12\bprotocol\"1\n" +
+	"\aMessage\x12\x12\n" +
+	"\x04Type\x18\x01 \x01(\rR\x04Type\x12\x12\n" +
+	"\x04Data\x18\x02 \x01(\fR\x04Data\"|\n" +
+	"\bActorRef\x12\x1a\n" +
+	"\bSystemId\x18\x01 \x01(\rR\bSystemId\x12\x1c\n" +
+	"\tGroupSlot\x18\x02 \x01(\rR\tGroupSlot\x12\x1c\n" +
+	"\tActorType\x18\x03 \x01(\rR\tActorType\x12\x18\n" +
+	"\aActorId\x18\x04 \x01(\tR\aActorId\"\xaa\x01\n" +
+	"\x0fPkgEnvelopeSend\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12+\n" +
+	"\aMessage\x18\x03 \x01(\v2\x11.protocol.MessageR\aMessage\"\xb3\x01\n" +
+	"\x14PkgEnvelopeBatchSend\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x124\n" +
+	"\vToActorRefs\x18\x02 \x03(\v2\x12.protocol.ActorRefR\vToActorRefs\x12-\n" +
+	"\bMessages\x18\x03 \x03(\v2\x11.protocol.MessageR\bMessages\"\xfc\x01\n" +
+	"\x17PkgEnvelopeRequestAsync\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12+\n" +
+	"\aMessage\x18\x03 \x01(\v2\x11.protocol.MessageR\aMessage\x12\x1e\n" +
+	"\n" +
+	"CallbackId\x18\x04 \x01(\rR\n" +
+	"CallbackId\x12(\n" +
+	"\x0fCallbackAddress\x18\x05 \x01(\x04R\x0fCallbackAddress\"\xd7\x01\n" +
+	"\bResponse\x121\n" +
+	"\tErrorCode\x18\x01 \x01(\x0e2\x13.protocol.ErrorCodeR\tErrorCode\x12+\n" +
+	"\aMessage\x18\x02 \x01(\v2\x11.protocol.MessageR\aMessage\x12\x12\n" +
+	"\x04Code\x18\x03 \x01(\rR\x04Code\x12\"\n" +
+	"\fErrorMessage\x18\x04 \x01(\tR\fErrorMessage\x123\n" +
+	"\vErrorDetail\x18\x05 \x01(\v2\x11.protocol.MessageR\vErrorDetail\"\x80\x02\n" +
+	"\x18PkgEnvelopeResponseAsync\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12.\n" +
+	"\bResponse\x18\x03 \x01(\v2\x12.protocol.ResponseR\bResponse\x12\x1e\n" +
+	"\n" +
+	"CallbackId\x18\x04 \x01(\rR\n" +
+	"CallbackId\x12(\n" +
+	"\x0fCallbackAddress\x18\x05 \x01(\x04R\x0fCallbackAddress\"\xcb\x01\n" +
+	"\x12PkgEnvelopeRequest\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12+\n" +
+	"\aMessage\x18\x03 \x01(\v2\x11.protocol.MessageR\aMessage\x12\x1c\n" +
+	"\tRequestId\x18\x04 \x01(\rR\tRequestId\"\xcf\x01\n" +
+	"\x13PkgEnvelopeResponse\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12.\n" +
+	"\bResponse\x18\x03 \x01(\v2\x12.protocol.ResponseR\bResponse\x12\x1c\n" +
+	"\tRequestId\x18\x04 \x01(\rR\tRequestId\"\xb6\x01\n" +
+	"\x10PkgEnvelopeWatch\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12\x1c\n" +
+	"\tWatchType\x18\x03 \x01(\rR\tWatchType\x12\x18\n" +
+	"\aIsWatch\x18\x04 \x01(\bR\aIsWatch\"\x9c\x02\n" +
+	"\x11PkgEnvelopeNotify\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x124\n" +
+	"\vToActorRefs\x18\x02 \x03(\v2\x12.protocol.ActorRefR\vToActorRefs\x12\x1e\n" +
+	"\n" +
+	"NotifyType\x18\x03 \x01(\rR\n" +
+	"NotifyType\x12.\n" +
+	"\bActorRef\x18\x04 \x01(\v2\x12.protocol.ActorRefR\bActorRef\x12\x1c\n" +
+	"\tWatchType\x18\x05 \x01(\rR\tWatchType\x12+\n" +
+	"\aMessage\x18\x06 \x01(\v2\x11.protocol.MessageR\aMessage\"\xee\x01\n" +
+	"\x15PkgEnvelopeFireNotify\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12\x1e\n" +
+	"\n" +
+	"NotifyType\x18\x03 \x01(\rR\n" +
+	"NotifyType\x12\x1c\n" +
+	"\tWatchType\x18\x04 \x01(\rR\tWatchType\x12+\n" +
+	"\aMessage\x18\x05 \x01(\v2\x11.protocol.MessageR\aMessage\"\xc4\x02\n" +
+	"\x14PkgRegisterSystemReq\x12\x1a\n" +
+	"\bSystemId\x18\x01 \x01(\rR\bSystemId\x12 \n" +
+	"\vClientNonce\x18\x02 \x01(\fR\vClientNonce\x12(\n" +
+	"\x0fProtocolVersion\x18\x03 \x01(\rR\x0fProtocolVersion\x12.\n" +
+	"\x12MinProtocolVersion\x18\x04 \x01(\rR\x12MinProtocolVersion\x12\"\n" +
+	"\fCapabilities\x18\x05 \x01(\x04R\fCapabilities\x12\x16\n" +
+	"\x06Stripe\x18\x06 \x01(\rR\x06Stripe\x12\x18\n" +
+	"\aStripes\x18\a \x01(\rR\aStripes\x12>\n" +
+	"\fMessageTypes\x18\b \x03(\v2\x1a.protocol.MessageTypeEntryR\fMessageTypes\"\x99\x02\n" +
+	"\x14PkgRegisterSystemRsp\x121\n" +
+	"\tErrorCode\x18\x01 \x01(\x0e2\x13.protocol.ErrorCodeR\tErrorCode\x12\x10\n" +
+	"\x03Mac\x18\x02 \x01(\fR\x03Mac\x12(\n" +
+	"\x0fProtocolVersion\x18\x03 \x01(\rR\x0fProtocolVersion\x12.\n" +
+	"\x12MinProtocolVersion\x18\x04 \x01(\rR\x12MinProtocolVersion\x12\"\n" +
+	"\fCapabilities\x18\x05 \x01(\x04R\fCapabilities\x12>\n" +
+	"\fMessageTypes\x18\x06 \x03(\v2\x1a.protocol.MessageTypeEntryR\fMessageTypes\"\x94\x01\n" +
+	"\x16PkgMessageTypeAnnounce\x12\x1a\n" +
+	"\bSystemId\x18\x01 \x01(\rR\bSystemId\x12:\n" +
+	"\n" +
+	"Registered\x18\x02 \x03(\v2\x1a.protocol.MessageTypeEntryR\n" +
+	"Registered\x12\"\n" +
+	"\fUnregistered\x18\x03 \x03(\rR\fUnregistered\"@\n" +
+	"\x10MessageTypeEntry\x12\x18\n" +
+	"\aMsgType\x18\x01 \x01(\rR\aMsgType\x12\x12\n" +
+	"\x04Name\x18\x02 \x01(\tR\x04Name\"8\n" +
+	"\x14PkgRegisterChallenge\x12 \n" +
+	"\vServerNonce\x18\x01 \x01(\fR\vServerNonce\"#\n" +
+	"\x0fPkgRegisterAuth\x12\x10\n" +
+	"\x03Mac\x18\x01 \x01(\fR\x03Mac\"\x96\x01\n" +
+	"\bPkgChunk\x12\x1c\n" +
+	"\tMessageId\x18\x01 \x01(\x04R\tMessageId\x12\x14\n" +
+	"\x05Index\x18\x02 \x01(\rR\x05Index\x12\x14\n" +
+	"\x05Count\x18\x03 \x01(\rR\x05Count\x12\x18\n" +
+	"\aPkgType\x18\x04 \x01(\rR\aPkgType\x12\x12\n" +
+	"\x04Size\x18\x05 \x01(\x04R\x04Size\x12\x12\n" +
+	"\x04Data\x18\x06 \x01(\fR\x04Data\"\xaf\x01\n" +
+	"\rPkgStreamOpen\x12\x1a\n" +
+	"\bStreamId\x18\x01 \x01(\x04R\bStreamId\x126\n" +
+	"\fFromActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x03 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12\x16\n" +
+	"\x06Window\x18\x04 \x01(\rR\x06Window\"j\n" +
+	"\rPkgStreamData\x12\x1a\n" +
+	"\bStreamId\x18\x01 \x01(\x04R\bStreamId\x12\x10\n" +
+	"\x03Seq\x18\x02 \x01(\x04R\x03Seq\x12+\n" +
+	"\aMessage\x18\x03 \x01(\v2\x11.protocol.MessageR\aMessage\"E\n" +
+	"\x0fPkgStreamCredit\x12\x1a\n" +
+	"\bStreamId\x18\x01 \x01(\x04R\bStreamId\x12\x16\n" +
+	"\x06Credit\x18\x02 \x01(\rR\x06Credit\"\x7f\n" +
+	"\x0ePkgStreamClose\x12\x1a\n" +
+	"\bStreamId\x18\x01 \x01(\x04R\bStreamId\x12\x1e\n" +
+	"\n" +
+	"FromReader\x18\x02 \x01(\bR\n" +
+	"FromReader\x121\n" +
+	"\tErrorCode\x18\x03 \x01(\x0e2\x13.protocol.ErrorCodeR\tErrorCode\"=\n" +
+	"\x10PkgEnvelopeBatch\x12)\n" +
+	"\x05Items\x18\x01 \x03(\v2\x13.protocol.BatchItemR\x05Items\"9\n" +
+	"\tBatchItem\x12\x18\n" +
+	"\aPkgType\x18\x01 \x01(\rR\aPkgType\x12\x12\n" +
+	"\x04Data\x18\x02 \x01(\fR\x04Data\"\xfc\x01\n" +
+	"\x10PkgCancelRequest\x126\n" +
+	"\fFromActorRef\x18\x01 \x01(\v2\x12.protocol.ActorRefR\fFromActorRef\x122\n" +
+	"\n" +
+	"ToActorRef\x18\x02 \x01(\v2\x12.protocol.ActorRefR\n" +
+	"ToActorRef\x12\x14\n" +
+	"\x05Async\x18\x03 \x01(\bR\x05Async\x12\x1c\n" +
+	"\tRequestId\x18\x04 \x01(\rR\tRequestId\x12\x1e\n" +
+	"\n" +
+	"CallbackId\x18\x05 \x01(\rR\n" +
+	"CallbackId\x12(\n" +
+	"\x0fCallbackAddress\x18\x06 \x01(\x04R\x0fCallbackAddress*R\n" +
 	"\tErrorCode\x12\x14\n" +
 	"\x10ErrorCodeSuccess\x10\x00\x12\x14\n" +
 	"\x10ErrorCodeTimeout\x10\x01\x12\x19\n" +
-	"\x15ErrorCodeInvalidActor\x10\x02*\xdd\x02\n" +
+	"\x15ErrorCodeInvalidActor\x10\x02*\xd9\x04\n" +
 	"\aPkgType\x12\x0f\n" +
 	"\vPkgTypeNone\x10\x00\x12\x17\n" +
 	"\x13PkgTypeEnvelopeSend\x10\x01\x12\x1c\n" +
@@ -1150,7 +2096,17 @@ const file_protocol_cluster_proto_rawDesc = "" +
 	"\x19PkgTypeEnvelopeFireNotify\x10\t\x12\x1c\n" +
 	"\x18PkgTypeRegisterSystemReq\x10\n" +
 	"\x12\x1c\n" +
-	"\x18PkgTypeRegisterSystemRsp\x10\vB'Z%github.com/kofplayer/dvactor/protocolb\x06proto3"
+	"\x18PkgTypeRegisterSystemRsp\x10\v\x12\x1c\n" +
+	"\x18PkgTypeRegisterChallenge\x10\f\x12\x17\n" +
+	"\x13PkgTypeRegisterAuth\x10\r\x12\x10\n" +
+	"\fPkgTypeChunk\x10\x0e\x12\x15\n" +
+	"\x11PkgTypeStreamOpen\x10\x0f\x12\x15\n" +
+	"\x11PkgTypeStreamData\x10\x10\x12\x17\n" +
+	"\x13PkgTypeStreamCredit\x10\x11\x12\x16\n" +
+	"\x12PkgTypeStreamClose\x10\x12\x12\x18\n" +
+	"\x14PkgTypeEnvelopeBatch\x10\x13\x12\x1e\n" +
+	"\x1aPkgTypeMessageTypeAnnounce\x10\x14\x12\x18\n" +
+	"\x14PkgTypeCancelRequest\x10\x15B'Z%github.com/kofplayer/dvactor/protocolb\x06proto3"
 
 var (
 	file_protocol_cluster_proto_rawDescOnce sync.Once
@@ -1165,7 +2121,7 @@ func file_protocol_cluster_proto_rawDescGZIP() []byte {
 }
 
 var file_protocol_cluster_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_protocol_cluster_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_protocol_cluster_proto_msgTypes = make([]protoimpl.MessageInfo, 26)
 var file_protocol_cluster_proto_goTypes = []any{
 	(ErrorCode)(0),                   // 0: protocol.ErrorCode
 	(PkgType)(0),                     // 1: protocol.PkgType
@@ -1183,6 +2139,18 @@ var file_protocol_cluster_proto_goTypes = []any{
 	(*PkgEnvelopeFireNotify)(nil),    // 13: protocol.PkgEnvelopeFireNotify
 	(*PkgRegisterSystemReq)(nil),     // 14: protocol.PkgRegisterSystemReq
 	(*PkgRegisterSystemRsp)(nil),     // 15: protocol.PkgRegisterSystemRsp
+	(*PkgMessageTypeAnnounce)(nil),   // 16: protocol.PkgMessageTypeAnnounce
+	(*MessageTypeEntry)(nil),         // 17: protocol.MessageTypeEntry
+	(*PkgRegisterChallenge)(nil),     // 18: protocol.PkgRegisterChallenge
+	(*PkgRegisterAuth)(nil),          // 19: protocol.PkgRegisterAuth
+	(*PkgChunk)(nil),                 // 20: protocol.PkgChunk
+	(*PkgStreamOpen)(nil),            // 21: protocol.PkgStreamOpen
+	(*PkgStreamData)(nil),            // 22: protocol.PkgStreamData
+	(*PkgStreamCredit)(nil),          // 23: protocol.PkgStreamCredit
+	(*PkgStreamClose)(nil),           // 24: protocol.PkgStreamClose
+	(*PkgEnvelopeBatch)(nil),         // 25: protocol.PkgEnvelopeBatch
+	(*BatchItem)(nil),                // 26: protocol.BatchItem
+	(*PkgCancelRequest)(nil),         // 27: protocol.PkgCancelRequest
 }
 var file_protocol_cluster_proto_depIdxs = []int32{
 	3,  // 0: protocol.PkgEnvelopeSend.FromActorRef:type_name -> protocol.ActorRef
@@ -1196,30 +2164,41 @@ var file_protocol_cluster_proto_depIdxs = []int32{
 	2,  // 8: protocol.PkgEnvelopeRequestAsync.Message:type_name -> protocol.Message
 	0,  // 9: protocol.Response.ErrorCode:type_name -> protocol.ErrorCode
 	2,  // 10: protocol.Response.Message:type_name -> protocol.Message
-	3,  // 11: protocol.PkgEnvelopeResponseAsync.FromActorRef:type_name -> protocol.ActorRef
-	3,  // 12: protocol.PkgEnvelopeResponseAsync.ToActorRef:type_name -> protocol.ActorRef
-	7,  // 13: protocol.PkgEnvelopeResponseAsync.Response:type_name -> protocol.Response
-	3,  // 14: protocol.PkgEnvelopeRequest.FromActorRef:type_name -> protocol.ActorRef
-	3,  // 15: protocol.PkgEnvelopeRequest.ToActorRef:type_name -> protocol.ActorRef
-	2,  // 16: protocol.PkgEnvelopeRequest.Message:type_name -> protocol.Message
-	3,  // 17: protocol.PkgEnvelopeResponse.FromActorRef:type_name -> protocol.ActorRef
-	3,  // 18: protocol.PkgEnvelopeResponse.ToActorRef:type_name -> protocol.ActorRef
-	7,  // 19: protocol.PkgEnvelopeResponse.Response:type_name -> protocol.Response
-	3,  // 20: protocol.PkgEnvelopeWatch.FromActorRef:type_name -> protocol.ActorRef
-	3,  // 21: protocol.PkgEnvelopeWatch.ToActorRef:type_name -> protocol.ActorRef
-	3,  // 22: protocol.PkgEnvelopeNotify.FromActorRef:type_name -> protocol.ActorRef
-	3,  // 23: protocol.PkgEnvelopeNotify.ToActorRefs:type_name -> protocol.ActorRef
-	3,  // 24: protocol.PkgEnvelopeNotify.ActorRef:type_name -> protocol.ActorRef
-	2,  // 25: protocol.PkgEnvelopeNotify.Message:type_name -> protocol.Message
-	3,  // 26: protocol.PkgEnvelopeFireNotify.FromActorRef:type_name -> protocol.ActorRef
-	3,  // 27: protocol.PkgEnvelopeFireNotify.ToActorRef:type_name -> protocol.ActorRef
-	2,  // 28: protocol.PkgEnvelopeFireNotify.Message:type_name -> protocol.Message
-	0,  // 29: protocol.PkgRegisterSystemRsp.ErrorCode:type_name -> protocol.ErrorCode
-	30, // [30:30] is the sub-list for method output_type
-	30, // [30:30] is the sub-list for method input_type
-	30, // [30:30] is the sub-list for extension type_name
-	30, // [30:30] is the sub-list for extension extendee
-	0,  // [0:30] is the sub-list for field type_name
+	2,  // 11: protocol.Response.ErrorDetail:type_name -> protocol.Message
+	3,  // 12: protocol.PkgEnvelopeResponseAsync.FromActorRef:type_name -> protocol.ActorRef
+	3,  // 13: protocol.PkgEnvelopeResponseAsync.ToActorRef:type_name -> protocol.ActorRef
+	7,  // 14: protocol.PkgEnvelopeResponseAsync.Response:type_name -> protocol.Response
+	3,  // 15: protocol.PkgEnvelopeRequest.FromActorRef:type_name -> protocol.ActorRef
+	3,  // 16: protocol.PkgEnvelopeRequest.ToActorRef:type_name -> protocol.ActorRef
+	2,  // 17: protocol.PkgEnvelopeRequest.Message:type_name -> protocol.Message
+	3,  // 18: protocol.PkgEnvelopeResponse.FromActorRef:type_name -> protocol.ActorRef
+	3,  // 19: protocol.PkgEnvelopeResponse.ToActorRef:type_name -> protocol.ActorRef
+	7,  // 20: protocol.PkgEnvelopeResponse.Response:type_name -> protocol.Response
+	3,  // 21: protocol.PkgEnvelopeWatch.FromActorRef:type_name -> protocol.ActorRef
+	3,  // 22: protocol.PkgEnvelopeWatch.ToActorRef:type_name -> protocol.ActorRef
+	3,  // 23: protocol.PkgEnvelopeNotify.FromActorRef:type_name -> protocol.ActorRef
+	3,  // 24: protocol.PkgEnvelopeNotify.ToActorRefs:type_name -> protocol.ActorRef
+	3,  // 25: protocol.PkgEnvelopeNotify.ActorRef:type_name -> protocol.ActorRef
+	2,  // 26: protocol.PkgEnvelopeNotify.Message:type_name -> protocol.Message
+	3,  // 27: protocol.PkgEnvelopeFireNotify.FromActorRef:type_name -> protocol.ActorRef
+	3,  // 28: protocol.PkgEnvelopeFireNotify.ToActorRef:type_name -> protocol.ActorRef
+	2,  // 29: protocol.PkgEnvelopeFireNotify.Message:type_name -> protocol.Message
+	17, // 30: protocol.PkgRegisterSystemReq.MessageTypes:type_name -> protocol.MessageTypeEntry
+	0,  // 31: protocol.PkgRegisterSystemRsp.ErrorCode:type_name -> protocol.ErrorCode
+	17, // 32: protocol.PkgRegisterSystemRsp.MessageTypes:type_name -> protocol.MessageTypeEntry
+	17, // 33: protocol.PkgMessageTypeAnnounce.Registered:type_name -> protocol.MessageTypeEntry
+	3,  // 34: protocol.PkgStreamOpen.FromActorRef:type_name -> protocol.ActorRef
+	3,  // 35: protocol.PkgStreamOpen.ToActorRef:type_name -> protocol.ActorRef
+	2,  // 36: protocol.PkgStreamData.Message:type_name -> protocol.Message
+	0,  // 37: protocol.PkgStreamClose.ErrorCode:type_name -> protocol.ErrorCode
+	26, // 38: protocol.PkgEnvelopeBatch.Items:type_name -> protocol.BatchItem
+	3,  // 39: protocol.PkgCancelRequest.FromActorRef:type_name -> protocol.ActorRef
+	3,  // 40: protocol.PkgCancelRequest.ToActorRef:type_name -> protocol.ActorRef
+	41, // [41:41] is the sub-list for method output_type
+	41, // [41:41] is the sub-list for method input_type
+	41, // [41:41] is the sub-list for extension type_name
+	41, // [41:41] is the sub-list for extension extendee
+	0,  // [0:41] is the sub-list for field type_name
 }
 
 func init() { file_protocol_cluster_proto_init() }
@@ -1233,7 +2212,7 @@ func file_protocol_cluster_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_protocol_cluster_proto_rawDesc), len(file_protocol_cluster_proto_rawDesc)),
 			NumEnums:      2,
-			NumMessages:   14,
+			NumMessages:   26,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,242 @@
+package dvactor
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+// RegistryCheckMode 注册握手时对双方消息类型表的一致性检查方式。
+// 双方交换手工注册的 msgType → 类型名，同一 msgType 名字不同即冲突；只在一方注册的不算冲突。
+type RegistryCheckMode int
+
+const (
+	// RegistryCheckOff 不检查（旧行为）
+	RegistryCheckOff RegistryCheckMode = iota
+	// RegistryCheckQuarantine 逐个记录并告警，冲突的 msgType 只在与该对端之间隔离：本节点不再向它发送、
+	// 也不接收它发来的这些类型，发送返回 ErrorCodeMessageTypeConflict；对端以一致的类型表重新注册后解除
+	RegistryCheckQuarantine
+	// RegistryCheckRefuse 有冲突即拒绝该链路（server 回 ErrorCodeMessageTypeConflict，client 断开重试）
+	RegistryCheckRefuse
+)
+
+// MessageTypeConflict 与某个对端不一致的 msgType。
+type MessageTypeConflict struct {
+	SystemId vactor.SystemId
+	MsgType  uint32
+	Local    string
+	Remote   string
+}
+
+// typeConflicts 各对端声明的消息类型表，以及与之的冲突记录；有冲突记录的 (对端, msgType) 即被隔离。
+// 对端握手、通告或本节点注册/注销时按 msgType 增量重新检查。
+type typeConflicts struct {
+	lock sync.RWMutex
+	// 对端 -> msgType -> 类型名
+	peers    map[vactor.SystemId]map[uint32]string
+	bySystem map[vactor.SystemId]map[uint32]MessageTypeConflict
+	// bySystem 非空，收发路径据此跳过加锁
+	active atomic.Bool
+}
+
+func newTypeConflicts() *typeConflicts {
+	return &typeConflicts{
+		peers:    make(map[vactor.SystemId]map[uint32]string),
+		bySystem: make(map[vactor.SystemId]map[uint32]MessageTypeConflict),
+	}
+}
+
+// isQuarantined msgType 是否因与 systemId 的类型表冲突而被隔离。
+func (c *typeConflicts) isQuarantined(systemId vactor.SystemId, msgType uint32) bool {
+	if !c.active.Load() {
+		return false
+	}
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.bySystem[systemId][msgType]
+	return ok
+}
+
+func (c *typeConflicts) all() []MessageTypeConflict {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	var conflicts []MessageTypeConflict
+	for _, cs := range c.bySystem {
+		for _, conflict := range cs {
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].SystemId != conflicts[j].SystemId {
+			return conflicts[i].SystemId < conflicts[j].SystemId
+		}
+		return conflicts[i].MsgType < conflicts[j].MsgType
+	})
+	return conflicts
+}
+
+// recheckLocked 按本地快照 r 重新判断 systemId 的 msgType 是否冲突，更新冲突记录。
+func (s *system) recheckLocked(systemId vactor.SystemId, msgType uint32, r *msgRegistry) {
+	c := s.typeConflicts
+	remote, remoteOk := c.peers[systemId][msgType]
+	local, localOk := r.names[msgType]
+	old, had := c.bySystem[systemId][msgType]
+	if remoteOk && localOk && local != remote {
+		conflict := MessageTypeConflict{SystemId: systemId, MsgType: msgType, Local: local, Remote: remote}
+		if had && old == conflict {
+			return
+		}
+		if c.bySystem[systemId] == nil {
+			c.bySystem[systemId] = make(map[uint32]MessageTypeConflict)
+		}
+		c.bySystem[systemId][msgType] = conflict
+		s.LogError("system %v msgType %v conflicts: local %v, remote %v", systemId, msgType, local, remote)
+	} else if had {
+		delete(c.bySystem[systemId], msgType)
+		if len(c.bySystem[systemId]) == 0 {
+			delete(c.bySystem, systemId)
+		}
+		s.LogInfo("system %v msgType %v conflict resolved", systemId, msgType)
+	}
+	c.active.Store(len(c.bySystem) > 0)
+}
+
+// messageTypeName 消息类型在各节点间可比较的名字：proto 消息用 FullName，其余用包路径.类型名。
+func messageTypeName(msg interface{}) string {
+	if m, ok := msg.(proto.Message); ok {
+		return string(m.ProtoReflect().Descriptor().FullName())
+	}
+	t := reflect.TypeOf(msg)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.PkgPath() == "" {
+		return fmt.Sprint(t)
+	}
+	return t.PkgPath() + "." + t.Name()
+}
+
+// messageTypeEntries 本节点手工注册的消息类型表，按 msgType 排序。自动派生的 msgType 由全名决定，无需交换。
+func (s *system) messageTypeEntries() []*protocol.MessageTypeEntry {
+	r := s.registry()
+	entries := make([]*protocol.MessageTypeEntry, 0, len(r.names))
+	for msgType, name := range r.names {
+		entries = append(entries, &protocol.MessageTypeEntry{
+			MsgType: msgType,
+			Name:    name,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].MsgType < entries[j].MsgType })
+	return entries
+}
+
+// checkMessageTypes 注册握手时用对端的完整类型表替换旧表并重新检查；
+// RegistryCheckRefuse 且有冲突时不记录、返回错误，调用方应拒绝该链路。
+func (s *system) checkMessageTypes(systemId vactor.SystemId, entries []*protocol.MessageTypeEntry) error {
+	mode := s.clusterNet.clusterConfig.RegistryCheck
+	if mode == RegistryCheckOff {
+		return nil
+	}
+	r := s.registry()
+	table := make(map[uint32]string, len(entries))
+	conflicts := 0
+	for _, entry := range entries {
+		table[entry.MsgType] = entry.Name
+		if local, ok := r.names[entry.MsgType]; ok && local != entry.Name {
+			conflicts++
+			if mode == RegistryCheckRefuse {
+				s.LogError("system %v msgType %v conflicts: local %v, remote %v", systemId, entry.MsgType, local, entry.Name)
+			}
+		}
+	}
+	if mode == RegistryCheckRefuse && conflicts > 0 {
+		return fmt.Errorf("system %v has %v conflicting msgTypes", systemId, conflicts)
+	}
+	c := s.typeConflicts
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// 在锁内取快照，与并发的本地注册按同一顺序生效
+	r = s.registry()
+	old := c.bySystem[systemId]
+	c.peers[systemId] = table
+	for msgType := range old {
+		s.recheckLocked(systemId, msgType, r)
+	}
+	for msgType := range table {
+		s.recheckLocked(systemId, msgType, r)
+	}
+	return nil
+}
+
+// onMessageTypeAnnounce 处理 systemId 运行期注册/注销的通告。systemId 取自收到通告的已注册会话，
+// 不信任包里自报的 SystemId。链路已建立，RegistryCheckRefuse 下新出现的冲突同样只隔离，不断开链路。
+func (s *system) onMessageTypeAnnounce(systemId vactor.SystemId, pkg *protocol.PkgMessageTypeAnnounce) {
+	if s.clusterNet.clusterConfig.RegistryCheck == RegistryCheckOff {
+		return
+	}
+	if pkg.SystemId != uint32(systemId) {
+		s.LogWarn("system %v announces msgTypes as system %v", systemId, pkg.SystemId)
+	}
+	c := s.typeConflicts
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	r := s.registry()
+	table := c.peers[systemId]
+	if table == nil {
+		table = make(map[uint32]string)
+		c.peers[systemId] = table
+	}
+	for _, entry := range pkg.Registered {
+		table[entry.MsgType] = entry.Name
+		s.recheckLocked(systemId, entry.MsgType, r)
+	}
+	for _, msgType := range pkg.Unregistered {
+		delete(table, msgType)
+		s.recheckLocked(systemId, msgType, r)
+	}
+}
+
+// recheckMessageType 本节点注册/注销 msgType 后与各对端重新检查。
+func (s *system) recheckMessageType(msgType uint32) {
+	if s.clusterNet.clusterConfig.RegistryCheck == RegistryCheckOff {
+		return
+	}
+	c := s.typeConflicts
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	r := s.registry()
+	for systemId := range c.peers {
+		s.recheckLocked(systemId, msgType, r)
+	}
+}
+
+// marshalFor 序列化发往 systemId 的消息；msgType 与该对端冲突被隔离时返回 ErrorCodeMessageTypeConflict。
+func (cn *clusterNet) marshalFor(systemId vactor.SystemId, msg interface{}) (*protocol.Message, vactor.VAError) {
+	protoMsg, err := cn.localSystem.MarshalMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	if cn.localSystem.typeConflicts.isQuarantined(systemId, protoMsg.Type) {
+		cn.localSystem.LogError("msgType %v of %v is quarantined for system %v", protoMsg.Type, reflect.TypeOf(msg), systemId)
+		return nil, vactor.NewVAError(ErrorCodeMessageTypeConflict)
+	}
+	return protoMsg, nil
+}
+
+// unmarshalFrom 反序列化 systemId 发来的消息；msgType 与该对端冲突被隔离时返回 ErrMessageTypeQuarantined。
+func (cn *clusterNet) unmarshalFrom(systemId vactor.SystemId, protoMsg *protocol.Message) (interface{}, error) {
+	if cn.localSystem.typeConflicts.isQuarantined(systemId, protoMsg.Type) {
+		return nil, fmt.Errorf("%w: %v", ErrMessageTypeQuarantined, protoMsg.Type)
+	}
+	return cn.localSystem.UnmarshalMessage(protoMsg)
+}
+
+func (s *system) MessageTypeConflicts() []MessageTypeConflict {
+	return s.typeConflicts.all()
+}
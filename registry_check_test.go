@@ -0,0 +1,116 @@
+package dvactor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCheckMessageTypes(t *testing.T) {
+	newChecked := func(mode RegistryCheckMode) *system {
+		s := NewSystem(&ClusterConfig{
+			LocalSystemId: 1,
+			SystemConfigs: []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}},
+			RegistryCheck: mode,
+		}).(*system)
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterMessageTypeCodec(2, func() interface{} { return &codecPing{} }, GobCodec{})
+		return s
+	}
+	s := newChecked(RegistryCheckQuarantine)
+	entries := s.messageTypeEntries()
+	if len(entries) != 2 || entries[0].Name != "protocol.ActorRef" || entries[1].Name != "github.com/kofplayer/dvactor.codecPing" {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if err := s.checkMessageTypes(2, entries); err != nil || len(s.MessageTypeConflicts()) != 0 {
+		t.Fatalf("identical tables should not conflict: %v", err)
+	}
+
+	// 只在对端注册的 msgType 不算冲突
+	remote := []*protocol.MessageTypeEntry{{MsgType: 1, Name: "protocol.Message"}, {MsgType: 3, Name: "x"}}
+	if err := s.checkMessageTypes(2, remote); err != nil {
+		t.Fatal(err)
+	}
+	conflicts := s.MessageTypeConflicts()
+	if len(conflicts) != 1 || conflicts[0] != (MessageTypeConflict{SystemId: 2, MsgType: 1, Local: "protocol.ActorRef", Remote: "protocol.Message"}) {
+		t.Fatalf("unexpected conflicts %+v", conflicts)
+	}
+	cn := s.clusterNet
+	if _, err := cn.marshalFor(2, &protocol.ActorRef{}); err == nil || err.Code() != ErrorCodeMessageTypeConflict {
+		t.Fatalf("quarantined msgType should not be sent, got %v", err)
+	}
+	if _, err := cn.marshalFor(2, &codecPing{}); err != nil {
+		t.Fatal(err)
+	}
+	// 只隔离与冲突对端之间的收发，其它对端照常
+	msg, err := s.MarshalMessage(&protocol.ActorRef{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cn.marshalFor(3, &protocol.ActorRef{}); err != nil {
+		t.Fatalf("other peers should not be quarantined, got %v", err)
+	}
+	if _, err := cn.unmarshalFrom(2, msg); !errors.Is(err, ErrMessageTypeQuarantined) {
+		t.Fatalf("expect quarantined, got %v", err)
+	}
+	if _, err := cn.unmarshalFrom(3, msg); err != nil {
+		t.Fatal(err)
+	}
+	// 通告按收到它的会话归属，包里自报的 SystemId 不影响别的对端
+	s.onMessageTypeAnnounce(2, &protocol.PkgMessageTypeAnnounce{SystemId: 3, Registered: []*protocol.MessageTypeEntry{{MsgType: 2, Name: "x"}}})
+	if _, err := cn.marshalFor(3, &codecPing{}); err != nil {
+		t.Fatalf("spoofed announce should not quarantine system 3, got %v", err)
+	}
+	if _, err := cn.marshalFor(2, &codecPing{}); err == nil || err.Code() != ErrorCodeMessageTypeConflict {
+		t.Fatalf("announce should apply to the session peer, got %v", err)
+	}
+	// 对端改正后解除隔离
+	s.checkMessageTypes(2, entries)
+	if _, err := cn.marshalFor(2, &protocol.ActorRef{}); err != nil {
+		t.Fatalf("quarantine should be lifted, got %v", err)
+	}
+
+	s = newChecked(RegistryCheckRefuse)
+	if err := s.checkMessageTypes(2, remote); err == nil {
+		t.Fatal("refuse mode should reject conflicting link")
+	}
+	if _, err := s.clusterNet.marshalFor(2, &protocol.ActorRef{}); err != nil {
+		t.Fatalf("refuse mode should not quarantine, got %v", err)
+	}
+	if err := newChecked(RegistryCheckOff).checkMessageTypes(2, remote); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 两个节点对 msgType 1 的映射不同，握手后双方都隔离它
+func TestRegistryCheckHandshake(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	index := 0
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, func(c *ClusterConfig) {
+		c.RegistryCheck = RegistryCheckQuarantine
+	}, func(s ClusterSystem) {
+		index++
+		if index == 1 {
+			s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		} else {
+			s.RegisterMessageType(1, func() proto.Message { return &protocol.Message{} })
+		}
+		s.RegisterMessageType(2, func() proto.Message { return &protocol.PkgChunk{} })
+	})
+	for i, s := range systems {
+		conflicts := s.MessageTypeConflicts()
+		if len(conflicts) != 1 || conflicts[0].MsgType != 1 || conflicts[0].SystemId != vactor.SystemId(2-i) {
+			t.Fatalf("system %v: unexpected conflicts %+v", i+1, conflicts)
+		}
+	}
+	err := systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "a"), &protocol.ActorRef{})
+	if err == nil || err.Code() != ErrorCodeMessageTypeConflict {
+		t.Fatalf("expect conflict, got %v", err)
+	}
+	if err := systems[0].Send(systems[0].CreateActorRefEx(2, actorType, "a"), &protocol.PkgChunk{}); err != nil {
+		t.Fatal(err)
+	}
+}
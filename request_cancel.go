@@ -0,0 +1,410 @@
+package dvactor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+)
+
+// requestKey 标识一个跨节点请求：发起方 actor 加 RequestId，异步请求为 CallbackId/CallbackAddress。
+type requestKey struct {
+	from    vactor.ActorRefImpl
+	async   bool
+	id      vactor.CallbackId
+	address uint64
+}
+
+func actorRefKey(ref vactor.ActorRef) vactor.ActorRefImpl {
+	return vactor.ActorRefImpl{SystemId: ref.GetSystemId(), ActorType: ref.GetActorType(), ActorId: ref.GetActorId()}
+}
+
+// requestKeyOf 取请求/响应信封对应的请求；from 为发起方。节点外的 system.Request 经 RequestProxy 转发，
+// 发起方是代理 actor，不会出现 from 为 nil 的跨节点请求。
+func requestKeyOf(e vactor.Envelope) (requestKey, bool) {
+	switch e := e.(type) {
+	case *vactor.EnvelopeRequest:
+		if e.FromActorRef != nil {
+			return requestKey{from: actorRefKey(e.FromActorRef), id: e.RequestId}, true
+		}
+	case *vactor.EnvelopeRequestAsync:
+		if e.FromActorRef != nil {
+			return requestKey{from: actorRefKey(e.FromActorRef), async: true, id: e.CallbackId, address: e.CallbackAddress}, true
+		}
+	case *vactor.EnvelopeResponse:
+		if e.ToActorRef != nil {
+			return requestKey{from: actorRefKey(e.ToActorRef), id: e.RequestId}, true
+		}
+	case *vactor.EnvelopeResponseAsync:
+		if e.ToActorRef != nil {
+			return requestKey{from: actorRefKey(e.ToActorRef), async: true, id: e.CallbackId, address: e.CallbackAddress}, true
+		}
+	}
+	return requestKey{}, false
+}
+
+// DefaultRequestTrackTTL ClusterConfig.RequestTrackTTL 为 0 时的跟踪时间。
+const DefaultRequestTrackTTL = time.Minute
+
+// outgoingRequest 本节点发出、尚未收到响应的请求。
+type outgoingRequest struct {
+	systemId vactor.SystemId
+	from     vactor.ActorRef
+	to       vactor.ActorRef
+	at       time.Time
+}
+
+// incomingRequest 本节点收到、尚未响应的请求。它代替原消息放进投递的信封，
+// actor 包装层（wrapActor）取出原消息交给 handler，并把自己挂在 EnvelopeContext 上。
+type incomingRequest struct {
+	key       requestKey
+	systemId  vactor.SystemId
+	message   interface{}
+	cancelled bool
+	done      chan struct{}
+	at        time.Time
+}
+
+// requestCanceller 跟踪两个方向上未完成的跨节点请求。对端不响应、调用方也不取消的请求
+// 最多跟踪 ttl：登记新请求时顺带清扫，间隔不小于 ttl/2，因此表里最多是约 1.5 个 ttl 内的请求。
+type requestCanceller struct {
+	s         *system
+	lock      sync.Mutex
+	outgoing  map[requestKey]*outgoingRequest
+	incoming  map[requestKey]*incomingRequest
+	capturing map[vactor.ActorRefImpl]*capturedRequest
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+// capturedRequest 记下 actor 一次 Request/RequestAsync 调用发出的跨节点请求。
+type capturedRequest struct {
+	key requestKey
+	ok  bool
+}
+
+func newRequestCanceller(s *system) *requestCanceller {
+	ttl := s.clusterNet.clusterConfig.RequestTrackTTL
+	if ttl <= 0 {
+		ttl = DefaultRequestTrackTTL
+	}
+	return &requestCanceller{
+		s:         s,
+		outgoing:  make(map[requestKey]*outgoingRequest),
+		incoming:  make(map[requestKey]*incomingRequest),
+		capturing: make(map[vactor.ActorRefImpl]*capturedRequest),
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}
+}
+
+// sweepLocked 丢弃跟踪超过 ttl 的请求：发出的不再能取消；收到的调用方早已超时，视为已取消。
+func (c *requestCanceller) sweepLocked(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl/2 {
+		return
+	}
+	c.lastSweep = now
+	for key, req := range c.outgoing {
+		if now.Sub(req.at) >= c.ttl {
+			delete(c.outgoing, key)
+		}
+	}
+	for key, r := range c.incoming {
+		if now.Sub(r.at) >= c.ttl {
+			if !r.cancelled {
+				r.cancelled = true
+				close(r.done)
+			}
+			c.removeIncomingLocked(key, r)
+		}
+	}
+}
+
+// onSend 在请求或响应的包序列化完成、发往 systemId 之前调用。发出请求时开始跟踪；发出响应时结束跟踪，
+// 返回 false 表示请求已被调用方取消，响应不必再发。
+func (c *requestCanceller) onSend(systemId vactor.SystemId, e vactor.Envelope) bool {
+	key, ok := requestKeyOf(e)
+	if !ok {
+		return true
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	switch e := e.(type) {
+	case *vactor.EnvelopeRequest:
+		c.trackLocked(systemId, key, e.FromActorRef, e.ToActorRef)
+	case *vactor.EnvelopeRequestAsync:
+		c.trackLocked(systemId, key, e.FromActorRef, e.ToActorRef)
+	default:
+		if r, ok := c.incoming[key]; ok {
+			c.removeIncomingLocked(key, r)
+			return !r.cancelled
+		}
+	}
+	return true
+}
+
+func (c *requestCanceller) trackLocked(systemId vactor.SystemId, key requestKey, from, to vactor.ActorRef) {
+	now := time.Now()
+	c.sweepLocked(now)
+	c.outgoing[key] = &outgoingRequest{systemId: systemId, from: from, to: to, at: now}
+	if slot, ok := c.capturing[key.from]; ok && !slot.ok {
+		slot.key, slot.ok = key, true
+	}
+}
+
+// capture 执行 call，返回其间 from 发出的跨节点请求。vactor 在调用方 goroutine 上同步经过 Router，
+// 同一 actor 的调用不会并发，所以按发起方识别即可。请求发往本节点或没能发出时 ok 为 false。
+func (c *requestCanceller) capture(from vactor.ActorRef, call func()) (requestKey, bool) {
+	fromKey := actorRefKey(from)
+	slot := &capturedRequest{}
+	c.lock.Lock()
+	c.capturing[fromKey] = slot
+	c.lock.Unlock()
+	call()
+	c.lock.Lock()
+	delete(c.capturing, fromKey)
+	c.lock.Unlock()
+	return slot.key, slot.ok
+}
+
+// forget 请求已收到响应或没能发出，不再需要取消。
+func (c *requestCanceller) forget(e vactor.Envelope) {
+	if key, ok := requestKeyOf(e); ok {
+		c.lock.Lock()
+		delete(c.outgoing, key)
+		c.lock.Unlock()
+	}
+}
+
+// onRequest 收到远端请求，投递给 handler 之前登记，返回代替原消息投递的记录。
+func (c *requestCanceller) onRequest(e vactor.Envelope, message interface{}) *incomingRequest {
+	key, ok := requestKeyOf(e)
+	if !ok {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	c.sweepLocked(now)
+	if old, ok := c.incoming[key]; ok {
+		c.removeIncomingLocked(key, old)
+	}
+	r := &incomingRequest{key: key, systemId: key.from.SystemId, message: message, done: make(chan struct{}), at: now}
+	c.incoming[key] = r
+	return r
+}
+
+// onCancel 调用方取消了请求：标记并通知 handler，之后的响应被丢弃。请求已响应或未登记时忽略。
+func (c *requestCanceller) onCancel(key requestKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if r, ok := c.incoming[key]; ok && !r.cancelled {
+		r.cancelled = true
+		close(r.done)
+	}
+}
+
+func (c *requestCanceller) removeIncomingLocked(key requestKey, r *incomingRequest) {
+	if c.incoming[key] == r {
+		delete(c.incoming, key)
+	}
+}
+
+// cancel 取消 key 对应的未完成请求，向对端发 PkgCancelRequest。请求已响应、已取消或未跟踪时返回 false。
+func (c *requestCanceller) cancel(key requestKey) bool {
+	c.lock.Lock()
+	req, ok := c.outgoing[key]
+	delete(c.outgoing, key)
+	c.lock.Unlock()
+	if !ok {
+		return false
+	}
+	return c.sendCancel(key, req)
+}
+
+// cancelFrom 取消 from 发出的全部未完成请求，用于发起方停止、回调不会再执行时。返回发出的取消数。
+func (c *requestCanceller) cancelFrom(from vactor.ActorRef) int {
+	fromKey := actorRefKey(from)
+	type pending struct {
+		key requestKey
+		req *outgoingRequest
+	}
+	var cancels []pending
+	c.lock.Lock()
+	for key, req := range c.outgoing {
+		if key.from == fromKey {
+			cancels = append(cancels, pending{key, req})
+			delete(c.outgoing, key)
+		}
+	}
+	c.lock.Unlock()
+	count := 0
+	for _, p := range cancels {
+		if c.sendCancel(p.key, p.req) {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *requestCanceller) sendCancel(key requestKey, req *outgoingRequest) bool {
+	pkg := &protocol.PkgCancelRequest{
+		FromActorRef:    ActorRefToProto(req.from),
+		ToActorRef:      ActorRefToProto(req.to),
+		Async:           key.async,
+		CallbackAddress: key.address,
+	}
+	if key.async {
+		pkg.CallbackId = uint32(key.id)
+	} else {
+		pkg.RequestId = uint32(key.id)
+	}
+	// 与请求走同一条连接，保证取消排在请求之后
+	if err := c.s.clusterNet.sendPkg(req.systemId, uint32(protocol.PkgType_PkgTypeCancelRequest), pkg, req.to.GetGroupSlot()); err != nil {
+		c.s.LogWarn("cancel request to system %v fail: %v", req.systemId, err)
+		return false
+	}
+	return true
+}
+
+// peerLost 与 systemId 的链路断开：发往它的请求不再跟踪；它发来的请求无人等待，视为取消。
+func (c *requestCanceller) peerLost(systemId vactor.SystemId) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, req := range c.outgoing {
+		if req.systemId == systemId {
+			delete(c.outgoing, key)
+		}
+	}
+	// 收到的请求只标记，handler 响应或跳过时才移除
+	for _, r := range c.incoming {
+		if r.systemId == systemId && !r.cancelled {
+			r.cancelled = true
+			close(r.done)
+		}
+	}
+}
+
+func cancelRequestKey(pkg *protocol.PkgCancelRequest) requestKey {
+	key := requestKey{from: actorRefKey(ActorRefFromProto(pkg.FromActorRef)), async: pkg.Async}
+	if pkg.Async {
+		key.id = vactor.CallbackId(pkg.CallbackId)
+		key.address = pkg.CallbackAddress
+	} else {
+		key.id = vactor.CallbackId(pkg.RequestId)
+	}
+	return key
+}
+
+// requestContext 是 dvactor 交给 actor 的 EnvelopeContext：跨节点请求换回原消息并带上跟踪记录；
+// 发往远端的 Request/RequestAsync 超时后取消对端的这一个请求。
+type requestContext struct {
+	vactor.EnvelopeContext
+	s       *system
+	message interface{}
+	request *incomingRequest
+}
+
+func (ctx *requestContext) GetMessage() interface{} {
+	return ctx.message
+}
+
+func (ctx *requestContext) Request(to vactor.ActorRef, message interface{}, timeout time.Duration) (interface{}, vactor.VAError) {
+	var rsp interface{}
+	var err vactor.VAError
+	key, ok := ctx.s.requests.capture(ctx.GetActorRef(), func() {
+		rsp, err = ctx.EnvelopeContext.Request(to, message, timeout)
+	})
+	if ok && isTimeout(err) {
+		ctx.s.requests.cancel(key)
+	}
+	return rsp, err
+}
+
+func (ctx *requestContext) RequestAsync(to vactor.ActorRef, message interface{}, timeout time.Duration, cb func(interface{}, vactor.VAError)) {
+	var key requestKey
+	var ok bool
+	key, ok = ctx.s.requests.capture(ctx.GetActorRef(), func() {
+		ctx.EnvelopeContext.RequestAsync(to, message, timeout, func(rsp interface{}, err vactor.VAError) {
+			// 回调与 actor 处理消息串行，此时 capture 已经返回
+			if ok && isTimeout(err) {
+				ctx.s.requests.cancel(key)
+			}
+			cb(rsp, err)
+		})
+	})
+}
+
+func isTimeout(err vactor.VAError) bool {
+	return err != nil && err.Code() == vactor.ErrorCodeTimeout
+}
+
+// wrapActor 包装 dvactor 注册的每个 actor：换上 requestContext；actor 停止时取消它发出、还没收到响应的请求。
+func (s *system) wrapActor(actor vactor.Actor) vactor.Actor {
+	return func(ctx vactor.EnvelopeContext) {
+		rc := &requestContext{EnvelopeContext: ctx, s: s, message: ctx.GetMessage()}
+		switch m := rc.message.(type) {
+		case *incomingRequest:
+			rc.message, rc.request = m.message, m
+		case *vactor.MsgOnStop:
+			defer s.requests.cancelFrom(ctx.GetActorRef())
+		}
+		actor(rc)
+	}
+}
+
+// incomingRequestOf 取 ctx 当前处理的跨节点请求，不是跨节点请求返回 nil。
+func incomingRequestOf(ctx vactor.EnvelopeContext) *incomingRequest {
+	if rc, ok := ctx.(*requestContext); ok {
+		return rc.request
+	}
+	return nil
+}
+
+func (s *system) CancelRequest(e vactor.Envelope) bool {
+	switch e.(type) {
+	case *vactor.EnvelopeRequest, *vactor.EnvelopeRequestAsync:
+	default:
+		return false
+	}
+	key, ok := requestKeyOf(e)
+	if !ok {
+		return false
+	}
+	return s.requests.cancel(key)
+}
+
+func (s *system) RequestCancelled(ctx vactor.EnvelopeContext) bool {
+	r := incomingRequestOf(ctx)
+	if r == nil {
+		return false
+	}
+	s.requests.lock.Lock()
+	defer s.requests.lock.Unlock()
+	return r.cancelled
+}
+
+func (s *system) RequestDone(ctx vactor.EnvelopeContext) <-chan struct{} {
+	if r := incomingRequestOf(ctx); r != nil {
+		return r.done
+	}
+	return nil
+}
+
+func (s *system) SkipCancelled(actor vactor.Actor) vactor.Actor {
+	return func(ctx vactor.EnvelopeContext) {
+		if r := incomingRequestOf(ctx); r != nil {
+			s.requests.lock.Lock()
+			cancelled := r.cancelled
+			if cancelled {
+				s.requests.removeIncomingLocked(r.key, r)
+			}
+			s.requests.lock.Unlock()
+			if cancelled {
+				return
+			}
+		}
+		actor(ctx)
+	}
+}
@@ -0,0 +1,241 @@
+package dvactor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+func requestCounts(s ClusterSystem) (int, int) {
+	c := s.(*system).requests
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.outgoing), len(c.incoming)
+}
+
+// 调用方取消后，正在处理的请求收到通知，排队中的请求被跳过，响应不再发回
+func TestCancelRequest(t *testing.T) {
+	actorType := ActorTypeStart + 1
+	handled := make(chan string, 4)
+	started := make(chan struct{}, 1)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, nil, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return s.SkipCancelled(func(ctx vactor.EnvelopeContext) {
+				msg, ok := ctx.GetMessage().(*protocol.ActorRef)
+				if !ok {
+					return
+				}
+				if msg.ActorId == "block" {
+					started <- struct{}{}
+					select {
+					case <-s.RequestDone(ctx):
+					case <-time.After(5 * time.Second):
+					}
+				}
+				if s.RequestCancelled(ctx) {
+					handled <- msg.ActorId + " cancelled"
+				} else {
+					handled <- msg.ActorId
+				}
+				ctx.Response(&protocol.ActorRef{ActorId: msg.ActorId}, nil)
+			})
+		})
+	})
+	caller := systems[0].CreateActorRefEx(1, actorType, "caller")
+	to := systems[0].CreateActorRefEx(2, actorType, "a")
+	request := func(id vactor.CallbackId, actorId string) *vactor.EnvelopeRequest {
+		e := &vactor.EnvelopeRequest{FromActorRef: caller, ToActorRef: to, RequestId: id, Message: &protocol.ActorRef{ActorId: actorId}}
+		if err := systems[0].(*system).clusterNet.Send(2, e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	waitCounts := func(s ClusterSystem, outgoing, incoming int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			o, i := requestCounts(s)
+			if o == outgoing && i == incoming {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expect %v/%v requests, got %v/%v", outgoing, incoming, o, i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 正常响应后两端都不再跟踪
+	request(1, "ok")
+	if got := <-handled; got != "ok" {
+		t.Fatalf("got %v", got)
+	}
+	waitCounts(systems[0], 0, 0)
+	waitCounts(systems[1], 0, 0)
+
+	block := request(2, "block")
+	<-started
+	queued := request(3, "queued")
+	waitCounts(systems[1], 0, 2)
+	// 只取消 block，同一发起方排在后面的 queued 照常处理
+	if !systems[0].CancelRequest(block) {
+		t.Fatal("block should be cancelled")
+	}
+	for _, want := range []string{"block cancelled", "queued"} {
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Fatalf("expect %v, got %v", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v not handled", want)
+		}
+	}
+	waitCounts(systems[0], 0, 0)
+	waitCounts(systems[1], 0, 0)
+	if systems[0].CancelRequest(queued) {
+		t.Fatal("answered request should not be cancelled")
+	}
+
+	// 排队期间被取消的请求被跳过
+	block = request(4, "block")
+	<-started
+	queued = request(5, "queued")
+	waitCounts(systems[1], 0, 2)
+	if !systems[0].CancelRequest(queued) || !systems[0].CancelRequest(block) {
+		t.Fatal("requests should be cancelled")
+	}
+	select {
+	case got := <-handled:
+		if got != "block cancelled" {
+			t.Fatalf("got %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancel not delivered")
+	}
+	waitCounts(systems[1], 0, 0)
+	select {
+	case got := <-handled:
+		t.Fatalf("cancelled request should be skipped, got %v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// 外部 system.Request 与 actor 的 Request 超时、RequestAsync 的发起方停止时，对端的请求自动取消
+func TestRequestAutoCancel(t *testing.T) {
+	handlerType, ownerType := ActorTypeStart+1, ActorTypeStart+2
+	handled := make(chan string, 4)
+	callbacks := make(chan vactor.VAError, 4)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{handlerType, ownerType}, nil, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(handlerType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				msg, ok := ctx.GetMessage().(*protocol.ActorRef)
+				if !ok {
+					return
+				}
+				select {
+				case <-s.RequestDone(ctx):
+					handled <- msg.ActorId + " cancelled"
+				case <-time.After(5 * time.Second):
+					handled <- msg.ActorId
+				}
+				ctx.Response(msg, nil)
+			}
+		})
+		s.RegisterActorType(ownerType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				msg, ok := ctx.GetMessage().(*protocol.ActorRef)
+				if !ok {
+					return
+				}
+				to := s.CreateActorRefEx(2, handlerType, "a")
+				switch msg.ActorId {
+				case "sync":
+					_, err := ctx.Request(to, &protocol.ActorRef{ActorId: "sync"}, 20*time.Millisecond)
+					callbacks <- err
+				case "async":
+					ctx.RequestAsync(to, &protocol.ActorRef{ActorId: "async"}, 5*time.Second, func(_ interface{}, err vactor.VAError) {
+						callbacks <- err
+					})
+				}
+			}
+		})
+	})
+	to := systems[0].CreateActorRefEx(2, handlerType, "a")
+	owner := systems[0].CreateActorRefEx(1, ownerType, "owner")
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Fatalf("expect %v, got %v", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v not handled", want)
+		}
+	}
+
+	if _, err := systems[0].Request(to, &protocol.ActorRef{ActorId: "outer"}, 20*time.Millisecond); err == nil || err.Code() != vactor.ErrorCodeTimeout {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+	expect("outer cancelled")
+
+	systems[0].Send(owner, &protocol.ActorRef{ActorId: "sync"})
+	if err := <-callbacks; err == nil || err.Code() != vactor.ErrorCodeTimeout {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+	expect("sync cancelled")
+
+	systems[0].Send(owner, &protocol.ActorRef{ActorId: "async"})
+	deadline := time.Now().Add(5 * time.Second)
+	for out, _ := requestCounts(systems[0]); out != 1; out, _ = requestCounts(systems[0]) {
+		if time.Now().After(deadline) {
+			t.Fatal("async request not sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	systems[0].LocalRouter(&vactor.EnvelopeSend{ToActorRef: owner, Message: &vactor.MsgOnStop{}})
+	expect("async cancelled")
+	if out, _ := requestCounts(systems[0]); out != 0 {
+		t.Fatalf("cancelled requests should not be tracked, got %v", out)
+	}
+}
+
+// 对端不响应、调用方也不取消的请求超过 RequestTrackTTL 后不再跟踪；序列化失败的请求不登记
+func TestRequestTrackTTL(t *testing.T) {
+	s := NewSystem(&ClusterConfig{
+		LocalSystemId:   1,
+		SystemConfigs:   []*SystemConfig{{SystemId: 1, ActorTypes: []vactor.ActorType{}}, {SystemId: 2}},
+		RequestTrackTTL: 20 * time.Millisecond,
+	}).(*system)
+	from, to := s.CreateActorRefEx(1, ActorTypeStart+1, "a"), s.CreateActorRefEx(2, ActorTypeStart+1, "b")
+	if err := s.clusterNet.Send(2, &vactor.EnvelopeRequest{FromActorRef: from, ToActorRef: to, Message: &codecPing{}, RequestId: 1}); err == nil {
+		t.Fatal("unregistered message should fail")
+	}
+	if out, _ := requestCounts(s); out != 0 {
+		t.Fatalf("failed request should not be tracked, got %v", out)
+	}
+
+	c := s.requests
+	c.onSend(2, &vactor.EnvelopeRequest{FromActorRef: from, ToActorRef: to, RequestId: 2})
+	in := &vactor.EnvelopeRequest{FromActorRef: to, ToActorRef: from, RequestId: 3}
+	done := c.onRequest(in, &protocol.ActorRef{}).done
+	if out, incoming := requestCounts(s); out != 1 || incoming != 1 {
+		t.Fatalf("expect 1/1 tracked, got %v/%v", out, incoming)
+	}
+	time.Sleep(30 * time.Millisecond)
+	// 登记新请求时清扫过期的
+	c.onSend(2, &vactor.EnvelopeRequest{FromActorRef: from, ToActorRef: to, RequestId: 4})
+	if out, incoming := requestCounts(s); out != 1 || incoming != 0 {
+		t.Fatalf("expired requests should be swept, got %v/%v", out, incoming)
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("expired incoming request should be cancelled")
+	}
+}
@@ -0,0 +1,401 @@
+package dvactor
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+)
+
+// StreamId 流标识，高 24 位为打开方 SystemId，全集群唯一。
+type StreamId uint64
+
+const streamIdSystemShift = 40
+
+// DefaultStreamWindow OpenStream 的 window 为 0 时写端的初始信用（条数）。
+const DefaultStreamWindow = 32
+
+func newStreamId(systemId vactor.SystemId, seq uint64) StreamId {
+	return StreamId(uint64(systemId)<<streamIdSystemShift | seq&(1<<streamIdSystemShift-1))
+}
+
+// SystemId 打开该流的节点，即写端所在节点。
+func (id StreamId) SystemId() vactor.SystemId {
+	return vactor.SystemId(uint64(id) >> streamIdSystemShift)
+}
+
+// StreamOpen 读端 actor 收到的开流通知，写端 actor 见 Reader.From()。
+type StreamOpen struct {
+	Reader *StreamReader
+}
+
+// StreamData 读端 actor 收到的一条流数据，Seq 从 1 开始连续递增。
+type StreamData struct {
+	Reader  *StreamReader
+	Seq     uint64
+	Message interface{}
+}
+
+// StreamCredit 写端 actor 收到的信用通知，Credit 为当前可发送的条数。
+type StreamCredit struct {
+	Writer *StreamWriter
+	Credit uint32
+}
+
+// StreamEnd 流结束通知：读端在写端 Close 后收到，写端在读端取消后收到；链路断开时两端都会收到。
+// Error 为 nil 表示正常结束。
+type StreamEnd struct {
+	Id    StreamId
+	Error vactor.VAError
+}
+
+// StreamWriter 流的写端。每条消息消耗 1 个信用，信用由读端 Grant 补充。
+type StreamWriter struct {
+	m      *streamManager
+	id     StreamId
+	from   vactor.ActorRef
+	to     vactor.ActorRef
+	lock   sync.Mutex
+	credit uint32
+	seq    uint64
+	closed bool
+}
+
+func (w *StreamWriter) Id() StreamId {
+	return w.id
+}
+
+// Credit 当前可发送的条数。
+func (w *StreamWriter) Credit() uint32 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.credit
+}
+
+// Send 按序发送一条消息。信用耗尽返回 ErrorCodeStreamNoCredit，写端 actor 收到 StreamCredit 后再重试；
+// 流已结束返回 ErrorCodeStreamClosed。跨节点时 msg 须是已注册的 proto 消息。
+func (w *StreamWriter) Send(msg interface{}) vactor.VAError {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return vactor.NewVAError(ErrorCodeStreamClosed)
+	}
+	if w.credit == 0 {
+		return vactor.NewVAError(ErrorCodeStreamNoCredit)
+	}
+	if err := w.m.sendData(w, w.seq+1, msg); err != nil {
+		return err
+	}
+	w.seq++
+	w.credit--
+	return nil
+}
+
+// Close 正常结束流，已发送的数据仍会先于 StreamEnd 送达读端。
+func (w *StreamWriter) Close() vactor.VAError {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError 以 err 结束流，读端的 StreamEnd.Error 为 err。
+func (w *StreamWriter) CloseWithError(err vactor.VAError) vactor.VAError {
+	if !w.m.endWriter(w.id, false, nil) {
+		return vactor.NewVAError(ErrorCodeStreamClosed)
+	}
+	return w.m.sendClose(w.id, false, err, w.to)
+}
+
+// StreamReader 流的读端。
+type StreamReader struct {
+	m    *streamManager
+	id   StreamId
+	from vactor.ActorRef
+	to   vactor.ActorRef
+	lock sync.Mutex
+	// 已授予、尚未收到的信用
+	window uint32
+	next   uint64
+	closed bool
+}
+
+func (r *StreamReader) Id() StreamId {
+	return r.id
+}
+
+// From 写端 actor，外部打开的流为 nil。
+func (r *StreamReader) From() vactor.ActorRef {
+	return r.from
+}
+
+// Grant 再授予写端 n 条信用，通常在处理完若干条 StreamData 后调用。
+func (r *StreamReader) Grant(n uint32) vactor.VAError {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return vactor.NewVAError(ErrorCodeStreamClosed)
+	}
+	r.window += n
+	r.lock.Unlock()
+	if r.m.isLocal(r.id.SystemId()) {
+		r.m.onCredit(r.id, n)
+		return nil
+	}
+	return r.m.s.clusterNet.sendPkg(r.id.SystemId(), uint32(protocol.PkgType_PkgTypeStreamCredit), &protocol.PkgStreamCredit{
+		StreamId: uint64(r.id),
+		Credit:   n,
+	}, streamSlot(r.from))
+}
+
+// Close 取消流，写端收到 StreamEnd，之后的 Send 返回 ErrorCodeStreamClosed。
+func (r *StreamReader) Close() vactor.VAError {
+	return r.CloseWithError(nil)
+}
+
+// CloseWithError 以 err 取消流，写端的 StreamEnd.Error 为 err。
+func (r *StreamReader) CloseWithError(err vactor.VAError) vactor.VAError {
+	if !r.m.endReader(r.id, false, nil) {
+		return vactor.NewVAError(ErrorCodeStreamClosed)
+	}
+	return r.m.sendClose(r.id, true, err, r.from)
+}
+
+// streamSlot 流的包按对端 actor 的 GroupSlot 选连接，同一条流的包始终走同一条连接。
+func streamSlot(ref vactor.ActorRef) vactor.GroupSlot {
+	if ref == nil {
+		return 0
+	}
+	return ref.GetGroupSlot()
+}
+
+// streamManager 管理本节点上所有流的两端。本机流不经网络，直接调用对端的处理函数。
+type streamManager struct {
+	s       *system
+	seq     atomic.Uint64
+	lock    sync.Mutex
+	writers map[StreamId]*StreamWriter
+	readers map[StreamId]*StreamReader
+}
+
+func newStreamManager(s *system) *streamManager {
+	return &streamManager{
+		s:       s,
+		writers: make(map[StreamId]*StreamWriter),
+		readers: make(map[StreamId]*StreamReader),
+	}
+}
+
+func (m *streamManager) isLocal(systemId vactor.SystemId) bool {
+	return systemId == m.s.clusterNet.clusterConfig.LocalSystemId
+}
+
+// deliver 把流通知投递给本机 actor，to 为 nil（外部打开的流）时忽略。
+func (m *streamManager) deliver(from, to vactor.ActorRef, msg interface{}) {
+	if to == nil {
+		return
+	}
+	m.s.LocalRouter(&vactor.EnvelopeSend{
+		FromActorRef: from,
+		ToActorRef:   to,
+		Message:      msg,
+	})
+}
+
+func (m *streamManager) open(from, to vactor.ActorRef, window uint32) (*StreamWriter, vactor.VAError) {
+	if window == 0 {
+		window = DefaultStreamWindow
+	}
+	w := &StreamWriter{
+		m:      m,
+		id:     newStreamId(m.s.clusterNet.clusterConfig.LocalSystemId, m.seq.Add(1)),
+		from:   from,
+		to:     to,
+		credit: window,
+	}
+	m.lock.Lock()
+	m.writers[w.id] = w
+	m.lock.Unlock()
+	if m.isLocal(to.GetSystemId()) {
+		m.onOpen(w.id, from, to, window)
+		return w, nil
+	}
+	err := m.s.clusterNet.sendPkg(to.GetSystemId(), uint32(protocol.PkgType_PkgTypeStreamOpen), &protocol.PkgStreamOpen{
+		StreamId:     uint64(w.id),
+		FromActorRef: ActorRefToProto(from),
+		ToActorRef:   ActorRefToProto(to),
+		Window:       window,
+	}, streamSlot(to))
+	if err != nil {
+		m.lock.Lock()
+		delete(m.writers, w.id)
+		m.lock.Unlock()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (m *streamManager) sendData(w *StreamWriter, seq uint64, msg interface{}) vactor.VAError {
+	if m.isLocal(w.to.GetSystemId()) {
+		m.onData(w.id, seq, msg)
+		return nil
+	}
+	message, err := m.s.clusterNet.marshalFor(w.to.GetSystemId(), msg)
+	if err != nil {
+		return err
+	}
+	return m.s.clusterNet.sendPkg(w.to.GetSystemId(), uint32(protocol.PkgType_PkgTypeStreamData), &protocol.PkgStreamData{
+		StreamId: uint64(w.id),
+		Seq:      seq,
+		Message:  message,
+	}, streamSlot(w.to))
+}
+
+// sendClose 通知另一端结束，to 为另一端 actor。
+func (m *streamManager) sendClose(id StreamId, fromReader bool, err vactor.VAError, to vactor.ActorRef) vactor.VAError {
+	systemId := id.SystemId()
+	if !fromReader {
+		systemId = to.GetSystemId()
+	}
+	if m.isLocal(systemId) {
+		m.onClose(id, fromReader, err)
+		return nil
+	}
+	pkg := &protocol.PkgStreamClose{
+		StreamId:   uint64(id),
+		FromReader: fromReader,
+	}
+	if err != nil {
+		pkg.ErrorCode = protocol.ErrorCode(err.Code())
+	}
+	return m.s.clusterNet.sendPkg(systemId, uint32(protocol.PkgType_PkgTypeStreamClose), pkg, streamSlot(to))
+}
+
+func (m *streamManager) onOpen(id StreamId, from, to vactor.ActorRef, window uint32) {
+	r := &StreamReader{
+		m:      m,
+		id:     id,
+		from:   from,
+		to:     to,
+		window: window,
+		next:   1,
+	}
+	m.lock.Lock()
+	m.readers[id] = r
+	m.lock.Unlock()
+	m.deliver(from, to, &StreamOpen{Reader: r})
+}
+
+// onData 校验序号与信用后投递给读端；违反流控的流以 ErrorCodeStreamBroken 结束。
+func (m *streamManager) onData(id StreamId, seq uint64, msg interface{}) {
+	m.lock.Lock()
+	r, ok := m.readers[id]
+	m.lock.Unlock()
+	if !ok {
+		// 读端已取消，取消通知到达写端之前的数据直接丢弃
+		m.s.LogDebug("stream %v not found, drop data %v", id, seq)
+		return
+	}
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return
+	}
+	if seq != r.next || r.window == 0 {
+		r.lock.Unlock()
+		m.s.LogError("stream %v expect seq %v window %v, got %v", id, r.next, r.window, seq)
+		broken := vactor.NewVAError(ErrorCodeStreamBroken)
+		if m.endReader(id, true, broken) {
+			m.sendClose(id, true, broken, r.from)
+		}
+		return
+	}
+	r.next++
+	r.window--
+	r.lock.Unlock()
+	m.deliver(r.from, r.to, &StreamData{Reader: r, Seq: seq, Message: msg})
+}
+
+func (m *streamManager) onCredit(id StreamId, credit uint32) {
+	m.lock.Lock()
+	w, ok := m.writers[id]
+	m.lock.Unlock()
+	if !ok {
+		return
+	}
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return
+	}
+	w.credit += credit
+	current := w.credit
+	w.lock.Unlock()
+	m.deliver(w.to, w.from, &StreamCredit{Writer: w, Credit: current})
+}
+
+func (m *streamManager) onClose(id StreamId, fromReader bool, err vactor.VAError) {
+	if fromReader {
+		m.endWriter(id, true, err)
+	} else {
+		m.endReader(id, true, err)
+	}
+}
+
+// peerLost 在与 systemId 的链路断开时结束所有以它为对端的流，两端各自收到 ErrorCodeStreamBroken。
+func (m *streamManager) peerLost(systemId vactor.SystemId) {
+	var writers, readers []StreamId
+	m.lock.Lock()
+	for id, w := range m.writers {
+		if w.to.GetSystemId() == systemId {
+			writers = append(writers, id)
+		}
+	}
+	for id := range m.readers {
+		if id.SystemId() == systemId {
+			readers = append(readers, id)
+		}
+	}
+	m.lock.Unlock()
+	broken := vactor.NewVAError(ErrorCodeStreamBroken)
+	for _, id := range writers {
+		m.endWriter(id, true, broken)
+	}
+	for _, id := range readers {
+		m.endReader(id, true, broken)
+	}
+}
+
+// endWriter 结束写端并从表中移除，notify 时向写端 actor 投递 StreamEnd；已结束返回 false。
+func (m *streamManager) endWriter(id StreamId, notify bool, err vactor.VAError) bool {
+	m.lock.Lock()
+	w, ok := m.writers[id]
+	delete(m.writers, id)
+	m.lock.Unlock()
+	if !ok {
+		return false
+	}
+	w.lock.Lock()
+	w.closed = true
+	w.lock.Unlock()
+	if notify {
+		m.deliver(w.to, w.from, &StreamEnd{Id: id, Error: err})
+	}
+	return true
+}
+
+// endReader 同 endWriter，作用于读端。
+func (m *streamManager) endReader(id StreamId, notify bool, err vactor.VAError) bool {
+	m.lock.Lock()
+	r, ok := m.readers[id]
+	delete(m.readers, id)
+	m.lock.Unlock()
+	if !ok {
+		return false
+	}
+	r.lock.Lock()
+	r.closed = true
+	r.lock.Unlock()
+	if notify {
+		m.deliver(r.from, r.to, &StreamEnd{Id: id, Error: err})
+	}
+	return true
+}
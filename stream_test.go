@@ -0,0 +1,145 @@
+package dvactor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kofplayer/dvactor/protocol"
+	"github.com/kofplayer/vactor"
+	"google.golang.org/protobuf/proto"
+)
+
+type streamEvent struct {
+	open   *StreamReader
+	seq    uint64
+	data   string
+	end    bool
+	endErr vactor.VAError
+}
+
+// newStreamCluster 两节点集群，读端 actor 把收到的流通知转给 events；autoGrant 时每收到一条数据补 1 个信用
+func newStreamCluster(t *testing.T, autoGrant bool) ([]ClusterSystem, vactor.ActorType, chan streamEvent) {
+	actorType := ActorTypeStart + 1
+	events := make(chan streamEvent, 1024)
+	systems := newInprocCluster(t, 2, []vactor.ActorType{actorType}, nil, func(s ClusterSystem) {
+		s.RegisterMessageType(1, func() proto.Message { return &protocol.ActorRef{} })
+		s.RegisterActorType(actorType, func() vactor.Actor {
+			return func(ctx vactor.EnvelopeContext) {
+				switch m := ctx.GetMessage().(type) {
+				case *StreamOpen:
+					events <- streamEvent{open: m.Reader}
+				case *StreamData:
+					events <- streamEvent{seq: m.Seq, data: m.Message.(*protocol.ActorRef).ActorId}
+					if autoGrant {
+						m.Reader.Grant(1)
+					}
+				case *StreamEnd:
+					events <- streamEvent{end: true, endErr: m.Error}
+				}
+			}
+		})
+	})
+	return systems, actorType, events
+}
+
+func waitStreamEvent(t *testing.T, events chan streamEvent) streamEvent {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream event timeout")
+	}
+	return streamEvent{}
+}
+
+// 本机与跨节点的流都按序送达全部数据，Close 后读端收到正常结束
+func TestStreamDelivery(t *testing.T) {
+	systems, actorType, events := newStreamCluster(t, true)
+	for _, systemId := range []vactor.SystemId{1, 2} {
+		to := systems[0].CreateActorRefEx(systemId, actorType, "reader")
+		w, err := systems[0].OpenStream(nil, to, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := waitStreamEvent(t, events); e.open == nil || e.open.Id() != w.Id() {
+			t.Fatalf("system %v: expect open event, got %+v", systemId, e)
+		}
+		const count = 100
+		for seq := 1; seq <= count; seq++ {
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				err := w.Send(&protocol.ActorRef{ActorId: fmt.Sprint(seq)})
+				if err == nil {
+					break
+				}
+				if err.Code() != ErrorCodeStreamNoCredit || time.Now().After(deadline) {
+					t.Fatalf("system %v: send %v: %v", systemId, seq, err)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got := 0
+		for ended := false; !ended || got < count; {
+			e := waitStreamEvent(t, events)
+			switch {
+			case e.end:
+				if e.endErr != nil {
+					t.Fatalf("system %v: unexpected end error %v", systemId, e.endErr)
+				}
+				ended = true
+			case e.data != fmt.Sprint(e.seq):
+				t.Fatalf("system %v: seq %v carries %v", systemId, e.seq, e.data)
+			default:
+				got++
+			}
+		}
+		if err := w.Send(&protocol.ActorRef{}); err == nil || err.Code() != ErrorCodeStreamClosed {
+			t.Fatalf("send after close should fail, got %v", err)
+		}
+	}
+}
+
+// 信用耗尽后 Send 失败，读端 Grant 后恢复；读端取消后写端不能再发送
+func TestStreamFlowControl(t *testing.T) {
+	systems, actorType, events := newStreamCluster(t, false)
+	w, err := systems[0].OpenStream(nil, systems[0].CreateActorRefEx(2, actorType, "reader"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := waitStreamEvent(t, events).open
+	for i := 0; i < 2; i++ {
+		if err := w.Send(&protocol.ActorRef{ActorId: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Send(&protocol.ActorRef{ActorId: "x"}); err == nil || err.Code() != ErrorCodeStreamNoCredit {
+		t.Fatalf("expect no credit, got %v", err)
+	}
+	if err := reader.Grant(3); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Credit() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("credit not granted, got %v", w.Credit())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for w.Send(&protocol.ActorRef{ActorId: "x"}) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("writer should be closed after reader cancel")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := w.Send(&protocol.ActorRef{}); err.Code() != ErrorCodeStreamClosed {
+		t.Fatalf("expect stream closed, got %v", err)
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	netConnect "github.com/kofplayer/dvactor/engine/net/connect"
 	"github.com/kofplayer/dvactor/protocol"
 	"github.com/kofplayer/vactor"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 const ActorTypeStart vactor.ActorType = vactor.ActorTypeStart + 10
@@ -17,6 +21,35 @@ const ActorTypeStart vactor.ActorType = vactor.ActorTypeStart + 10
 type ClusterSystem interface {
 	vactor.System
 	RegisterMessageType(msgType uint32, creator func() proto.Message)
+	// RegisterMessageTypeCodec 注册任意 Go 类型的消息，creator 须返回指针；codec 为 nil 使用 ClusterConfig.Codec。
+	// 所有节点上同一 msgType 的类型与 codec 必须一致
+	RegisterMessageTypeCodec(msgType uint32, creator func() interface{}, codec Codec)
+	// UnregisterMessageType 注销 msgType；注册与注销都可在 Start 之后并发调用
+	UnregisterMessageType(msgType uint32)
+	// RegisterMessageUpgrade 注册消息版本升级：收到 fromType 的远端消息先经 convert 转为 toType 再投递，可串联
+	RegisterMessageUpgrade(fromType, toType uint32, convert func(msg interface{}) (interface{}, error))
+	// FrameRejects 返回因超过 MaxFrameSize 被拒绝的帧数，按对端地址（TCP 为 host）统计
+	FrameRejects() map[string]uint64
+	// SendQueueStats 返回各已连接节点的发送队列深度与丢帧数（多连接时为各连接之和）
+	SendQueueStats() map[vactor.SystemId]netConnect.SendQueueStats
+	// OpenStream 打开从 from 到 to 的流，to 收到 StreamOpen；window 为写端初始信用，0 使用 DefaultStreamWindow。
+	// from 为 nil 时写端不接收 StreamCredit/StreamEnd 通知，需自行轮询 StreamWriter.Credit
+	OpenStream(from, to vactor.ActorRef, window uint32) (*StreamWriter, vactor.VAError)
+	// DeadLetterStats 返回按原因统计的死信数
+	DeadLetterStats() map[DeadLetterReason]uint64
+	// ReplayDeadLetter 重放死信：入站的按当前类型表重新解码投递，出站的重新发往原目标节点
+	ReplayDeadLetter(dl *DeadLetter) vactor.VAError
+	// MessageTypeConflicts 返回注册握手时发现的、与各对端不一致的 msgType（ClusterConfig.RegistryCheck 开启时）
+	MessageTypeConflicts() []MessageTypeConflict
+	// CancelRequest 取消 e（EnvelopeRequest/EnvelopeRequestAsync）对应的、尚未收到响应的跨节点请求，通知对端不必再处理；
+	// 请求已响应、已取消或未跟踪时返回 false。actor 经 ctx 发出的请求超时、RequestAsync 的发起方停止时自动取消
+	CancelRequest(e vactor.Envelope) bool
+	// RequestCancelled 报告 ctx 正在处理的跨节点请求是否已被调用方取消（或调用方节点已断开）
+	RequestCancelled(ctx vactor.EnvelopeContext) bool
+	// RequestDone 返回 ctx 正在处理的跨节点请求被取消时关闭的 channel；不是跨节点请求返回 nil
+	RequestDone(ctx vactor.EnvelopeContext) <-chan struct{}
+	// SkipCancelled 包装 actor：排队期间已被取消的跨节点请求不再交给 actor 处理
+	SkipCancelled(actor vactor.Actor) vactor.Actor
 }
 
 func NewSystem(clusterConfig *ClusterConfig, cfgFuncs ...vactor.SystemConfigFunc) ClusterSystem {
@@ -25,28 +58,38 @@ func NewSystem(clusterConfig *ClusterConfig, cfgFuncs ...vactor.SystemConfigFunc
 	})
 	_system := vactor.NewSystem(cfgFuncs...)
 	s := &system{
-		System:      _system,
-		msgTypeIds:  make(map[reflect.Type]uint32),
-		msgCreators: make(map[uint32]func() proto.Message),
+		System:        _system,
+		typeConflicts: newTypeConflicts(),
+	}
+	s.msgRegistry.Store(newMsgRegistry())
+	if clusterConfig.AutoRegisterProto {
+		s.autoProto = newProtoAutoRegistry(s)
 	}
 	s.clusterNet = NewClusterNet(s, clusterConfig)
+	s.streams = newStreamManager(s)
+	s.requests = newRequestCanceller(s)
 	s.router = NewRouter(_system, clusterConfig, s.clusterNet)
 	s.SetRouter(s.router.Router)
 	s.SetCreateActorRefExFunc(s.router.CreateActorRefEx)
 	s.System.RegisterActorType(WatchProxyActorType, func() vactor.Actor {
-		return NewWatchProxy().OnMessage
+		return s.wrapActor(NewWatchProxy().OnMessage)
 	})
 	s.System.RegisterActorType(RequestProxyActorType, func() vactor.Actor {
-		return NewRequestProxy().OnMessage
+		return s.wrapActor(NewRequestProxy().OnMessage)
 	})
 	return s
 }
 
 type SystemConfig struct {
-	SystemId   vactor.SystemId
-	Host       string
-	Port       uint16
+	SystemId vactor.SystemId
+	Host     string
+	Port     uint16
+	// Address: 非空时优先于 Host/Port，如 "tcp://10.0.0.2:8001"、"unix:///run/dvactor/2.sock"（仅同机节点可达）、
+	// "inproc://node2"（仅同进程可达，用于在一个测试进程里跑整个集群）。
+	Address    string
 	ActorTypes []vactor.ActorType
+	// SendLimit: 发往该节点的发送队列上限，nil 使用 ClusterConfig.SendLimit
+	SendLimit *netConnect.SendLimit
 }
 
 type ClusterConfig struct {
@@ -54,14 +97,66 @@ type ClusterConfig struct {
 	SystemConfigs []*SystemConfig
 	// ConnectTimeout: 启动时等待集群全员互连的超时时间；0 表示无限等待（保持旧行为）。
 	ConnectTimeout time.Duration
+	// TLS: 集群链路 TLS 配置；nil 表示明文 TCP。所有节点须一致开启或关闭。
+	TLS *TLSConfig
+	// AuthKeys: 注册握手的共享密钥（HMAC-SHA256 挑战应答）；为空表示不认证。
+	// 用 AuthKeys[0] 签名，任意一个校验通过即可；轮换时依次部署 [旧,新] → [新,旧] → [新]。
+	AuthKeys [][]byte
+	// Compression: 帧压缩配置；nil 表示不压缩。按链路协商，只在双方都开启时生效。
+	Compression *CompressionConfig
+	// FrameCRC: 在 v2 帧上附加 payload 的 CRC32C 校验，收到校验失败的帧即断开连接。
+	// 只对双方都支持 v2 帧的链路生效；TLS 链路自带完整性校验，通常无需开启。
+	FrameCRC bool
+	// MaxFrameSize: 接收帧的最大 data 长度（字节，压缩帧按压缩后计）；0 使用 netConnect.DefaultMaxFrameSize。
+	// 帧头声明的长度超限即断开该连接，防止损坏或恶意的长度字段让节点无限缓冲。
+	MaxFrameSize int
+	// Flush: TCP/unix 链路的写合并策略；零值为有多少合并多少、立即写出。
+	// 吞吐优先的场景可设置 Delay（如 200µs）以少量延迟换取更大的批次。
+	Flush netConnect.FlushPolicy
+	// SendLimit: 每条链路发送队列的高水位（待写字节）与溢出策略，零值不限制。
+	// 对端卡住时队列不再无限增长；OverflowBlock 超时与 OverflowFail 返回 ErrorCodeSendQueueFull。
+	SendLimit netConnect.SendLimit
+	// ConnectionsPerPeer: 本节点主动连接的每个对端打开的连接数，0 或 1 为单连接。
+	// 信封按目标 actor 的 GroupSlot 选择连接，同一 actor 的消息始终走同一条，顺序不变；
+	// 该连接未就绪时发送失败而不改道。对端须支持 CapabilityMultiConn，否则只用主连接。
+	ConnectionsPerPeer int
+	// Chunking: 大包分片配置；nil 表示整包发送。按链路协商，只在双方都开启时生效。
+	// 分片逐片入队，大包不再独占链路，接收侧也不必按整包缓冲一个巨帧。
+	Chunking *ChunkConfig
+	// Batching: 跨信封合批配置；nil 表示每个信封一帧。按链路协商，只在双方都开启时生效。
+	// 高负载时把同一连接上短时间内的多个信封合成一帧 PkgEnvelopeBatch，低负载时不增加延迟。
+	Batching *BatchConfig
+	// Codec: 未单独指定编解码器的消息类型所用的 Codec；nil 使用 ProtoCodec。所有节点须一致。
+	Codec Codec
+	// AutoRegisterProto: 未手工注册的 proto 消息按全名派生 msgType（ProtoMessageType），
+	// 接收侧从 protoregistry.GlobalTypes 反查，任何链接进二进制的生成消息都可直接跨节点收发。
+	// 手工注册优先；所有节点须一致开启。
+	AutoRegisterProto bool
+	// RegistryCheck: 注册握手时检查双方手工注册的消息类型表是否一致，默认不检查。
+	RegistryCheck RegistryCheckMode
+	// AnnounceMessageTypes: 运行期注册/注销消息类型时通告已连接的对端，对端按 RegistryCheck 检查。
+	AnnounceMessageTypes bool
+	// DeadLetter: 无法投递的跨节点信封的去向；nil 时只计数（DeadLetterStats）并记日志。
+	DeadLetter *DeadLetterConfig
+	// RequestTrackTTL: 请求取消对未完成跨节点请求的最长跟踪时间，应不小于最长的请求超时；
+	// 0 使用 DefaultRequestTrackTTL。超过后不再能取消，收到的请求视为已取消。
+	RequestTrackTTL time.Duration
 }
 
 type system struct {
 	vactor.System
-	router      *Router
-	clusterNet  *clusterNet
-	msgTypeIds  map[reflect.Type]uint32
-	msgCreators map[uint32]func() proto.Message
+	router     *Router
+	clusterNet *clusterNet
+	// 消息类型表，写时复制，见 message_registry.go
+	registryLock sync.Mutex
+	msgRegistry  atomic.Pointer[msgRegistry]
+	// 未开启 AutoRegisterProto 时为 nil
+	autoProto *protoAutoRegistry
+	// 与各对端的 msgType 冲突及隔离状态
+	typeConflicts *typeConflicts
+	deadLetters   deadLetters
+	streams       *streamManager
+	requests      *requestCanceller
 }
 
 func (s *system) Start() {
@@ -75,41 +170,93 @@ func (s *system) RegisterActorType(actorType vactor.ActorType, actorCreator func
 	if actorType < ActorTypeStart {
 		panic(fmt.Sprintf("actor type %v is less than %v", actorType, ActorTypeStart))
 	}
-	s.System.RegisterActorType(actorType, actorCreator)
+	s.System.RegisterActorType(actorType, func() vactor.Actor {
+		return s.wrapActor(actorCreator())
+	})
 }
 
-func (s *system) RegisterMessageType(msgType uint32, creator func() proto.Message) {
-	msg := creator()
-	msgReflectType := reflect.TypeOf(msg)
-	if old, ok := s.msgCreators[msgType]; ok && reflect.TypeOf(old()) != msgReflectType {
-		s.LogWarn("msgType %v re-registered: %v -> %v", msgType, reflect.TypeOf(old()), msgReflectType)
+// Request 目标在远端时经 RequestProxy 转发，代理请求的超时与调用方一致，超时后由代理取消对端的请求。
+func (s *system) Request(to vactor.ActorRef, message interface{}, timeout time.Duration) (interface{}, vactor.VAError) {
+	localSystemId := s.clusterNet.clusterConfig.LocalSystemId
+	if to == nil || to.GetSystemId() == localSystemId || timeout <= 0 {
+		return s.System.Request(to, message, timeout)
+	}
+	rspChan := make(chan *vactor.Response, 1)
+	err := s.LocalRouter(&vactor.EnvelopeSend{
+		Message: &OuterRequest{
+			ToActorRef: to,
+			Message:    message,
+			RspChan:    rspChan,
+			Timeout:    timeout,
+		},
+		ToActorRef: GetRequestProxyActorRef(s, localSystemId, to),
+	})
+	if err != nil {
+		return nil, err
 	}
-	if oldType, ok := s.msgTypeIds[msgReflectType]; ok && oldType != msgType {
-		s.LogWarn("message %v re-registered with msgType %v (was %v)", msgReflectType, msgType, oldType)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case rsp := <-rspChan:
+		return rsp.Message, rsp.Error
+	case <-timer.C:
+		return nil, vactor.NewVAError(vactor.ErrorCodeTimeout)
 	}
-	s.msgTypeIds[msgReflectType] = msgType
-	s.msgCreators[msgType] = creator
+}
+
+func (s *system) FrameRejects() map[string]uint64 {
+	return s.clusterNet.FrameRejects()
+}
+
+func (s *system) SendQueueStats() map[vactor.SystemId]netConnect.SendQueueStats {
+	return s.clusterNet.SendQueueStats()
+}
+
+func (s *system) OpenStream(from, to vactor.ActorRef, window uint32) (*StreamWriter, vactor.VAError) {
+	return s.streams.open(from, to, window)
 }
 
 func (s *system) MarshalMessage(msg interface{}) (*protocol.Message, vactor.VAError) {
-	protoMsg, ok := msg.(proto.Message)
+	r := s.registry()
+	msgType, ok := r.typeIds[reflect.TypeOf(msg)]
 	if !ok {
-		s.LogError("msg %v is not proto message", reflect.TypeOf(msg))
-		return nil, vactor.NewVAError(ErrorCodeMessageCannotSerialize)
+		protoMsg, isProto := msg.(proto.Message)
+		if !isProto {
+			s.LogError("msg %v is not registered and not proto message", reflect.TypeOf(msg))
+			return nil, vactor.NewVAError(ErrorCodeMessageCannotSerialize)
+		}
+		if s.autoProto == nil {
+			s.LogError("can not find msg type")
+			return nil, vactor.NewVAError(ErrorCodeMessageNotRegister)
+		}
+		if msgType, ok = s.autoProto.typeOf(protoMsg.ProtoReflect().Type()); !ok {
+			s.LogError("auto msgType %v of %v conflicts", msgType, reflect.TypeOf(msg))
+			return nil, vactor.NewVAError(ErrorCodeMessageNotRegister)
+		}
 	}
-	msgType, ok := s.msgTypeIds[reflect.TypeOf(msg)]
-	if !ok {
-		s.LogError("can not find msg type")
-		return nil, vactor.NewVAError(ErrorCodeMessageNotRegister)
+	codec := s.codec(r, msgType)
+	// 预留 4 字节类型头后直接序列化到同一块内存，codec 能预估长度时省去扩容
+	size := 0
+	if sizer, ok := codec.(CodecSizer); ok {
+		size = sizer.Size(msg)
+	}
+	data := make([]byte, 4, 4+size)
+	binary.BigEndian.PutUint32(data[:4], msgType)
+	var err error
+	if m, ok := msg.(proto.Message); ok && size > 0 && codec == Codec(ProtoCodec{}) {
+		// 默认 codec 刚算过 Size，直接复用缓存的长度，不再遍历一遍消息
+		data, err = proto.MarshalOptions{UseCachedSize: true}.MarshalAppend(data, m)
+	} else {
+		data, err = codec.Marshal(data, msg)
+	}
+	if errors.Is(err, ErrCodecUnsupported) {
+		s.LogError("msg %v is not supported by codec %T", reflect.TypeOf(msg), codec)
+		return nil, vactor.NewVAError(ErrorCodeMessageCannotSerialize)
 	}
-	_data, err := proto.Marshal(protoMsg)
 	if err != nil {
-		s.LogError("proto.Marshal %v", err)
+		s.LogError("marshal %v: %v", reflect.TypeOf(msg), err)
 		return nil, vactor.NewVAError(ErrorCodeMessageSerializeFail)
 	}
-	data := make([]byte, 4, 4+len(_data))
-	binary.BigEndian.PutUint32(data[:4], msgType)
-	data = append(data, _data...)
 	return &protocol.Message{
 		Type: msgType,
 		Data: data,
@@ -120,14 +267,26 @@ func (s *system) UnmarshalMessage(protoMsg *protocol.Message) (interface{}, erro
 	if len(protoMsg.Data) < 4 {
 		return nil, errors.New("len error")
 	}
-	creator, ok := s.msgCreators[protoMsg.Type]
-	if !ok {
-		return nil, fmt.Errorf("can not find msg type %v creator", protoMsg.Type)
+	r := s.registry()
+	var msg interface{}
+	if creator, ok := r.creators[protoMsg.Type]; ok {
+		msg = creator()
+	} else if mt, ok := s.autoLookup(protoMsg.Type); ok {
+		msg = mt.New().Interface()
+	} else {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownMessageType, protoMsg.Type)
 	}
-	msg := creator()
-	err := proto.Unmarshal(protoMsg.Data[4:], msg)
+	err := s.codec(r, protoMsg.Type).Unmarshal(protoMsg.Data[4:], msg)
 	if err != nil {
 		return nil, err
 	}
-	return msg, nil
+	return r.upgrade(protoMsg.Type, msg)
+}
+
+// autoLookup 按自动派生的 msgType 查找 proto 消息类型。
+func (s *system) autoLookup(msgType uint32) (protoreflect.MessageType, bool) {
+	if s.autoProto == nil || msgType&AutoMessageTypeBit == 0 {
+		return nil, false
+	}
+	return s.autoProto.lookup(msgType)
 }